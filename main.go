@@ -4,18 +4,20 @@ import (
 	"github.com/thk-im/thk-im-base-server/conf"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/handler"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/task"
 )
 
 func main() {
 	configPath := "etc/msg_api_server.yaml"
-	config := &conf.Config{}
+	config := &app.ServerConfig{}
 	if err := conf.LoadConfig(configPath, config); err != nil {
 		panic(err)
 	}
 
 	appCtx := &app.Context{}
-	appCtx.Init(config)
+	appCtx.Init(config.Config, config.MsgApiConfig)
 	handler.RegisterMsgApiHandlers(appCtx)
+	task.StartMsgApiTasks(appCtx)
 
 	appCtx.StartServe()
 }
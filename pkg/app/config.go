@@ -0,0 +1,207 @@
+package app
+
+import (
+	"github.com/thk-im/thk-im-base-server/conf"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMaxPinMessage   = 20
+	defaultRevokeTimeLimit = 120
+
+	defaultPromotionHistoryCount = 1000
+	defaultRetentionBatchCount   = 500
+
+	MsgSchemaUnknownTypeAllow = "allow"
+	MsgSchemaUnknownTypeDeny  = "deny"
+)
+
+type (
+	// RevokeTimeLimit 普通成员撤回消息的时间窗口(秒), 按会话类型配置, 0表示不限制, 未配置使用默认值
+	RevokeTimeLimit struct {
+		Single     *int64 `yaml:"Single"`
+		Group      *int64 `yaml:"Group"`
+		SuperGroup *int64 `yaml:"SuperGroup"`
+	}
+
+	// TokenBucket 令牌桶, Rate为每秒生成的令牌数, Burst为桶容量, Rate或Burst不大于0表示不限制
+	TokenBucket struct {
+		Rate  float64 `yaml:"Rate"`
+		Burst int64   `yaml:"Burst"`
+	}
+
+	// SendRateLimitRule 一种会话类型下的发送限流规则
+	SendRateLimitRule struct {
+		User          *TokenBucket `yaml:"User"`          // 单个发送人
+		Session       *TokenBucket `yaml:"Session"`       // 单个会话
+		UserInSession *TokenBucket `yaml:"UserInSession"` // 单个发送人在单个会话内
+	}
+
+	// SendRateLimit 发送消息限流, 按会话类型配置, 未配置的会话类型不限流
+	SendRateLimit struct {
+		Single     *SendRateLimitRule `yaml:"Single"`
+		Group      *SendRateLimitRule `yaml:"Group"`
+		SuperGroup *SendRateLimitRule `yaml:"SuperGroup"`
+	}
+
+	// SuperGroupPromotion 群升级为超级群的配置, 升级时把最近的历史消息迁移到会话消息表
+	SuperGroupPromotion struct {
+		MemberThreshold int `yaml:"MemberThreshold"` // 增员后成员数超过阈值时自动升级, 0表示不自动升级
+		HistoryCount    int `yaml:"HistoryCount"`    // 迁移的最近消息数
+	}
+
+	// RetentionRule 消息保留规则, Days为保留天数, Count为每个会话保留的最近消息数, 0表示不限制
+	RetentionRule struct {
+		Days  int   `yaml:"Days"`
+		Count int64 `yaml:"Count"`
+	}
+
+	// MessageRetention 消息保留策略, 按会话类型配置, 会话可单独覆盖; 清理任务定期物理删除超出保留范围和已软删除的消息
+	MessageRetention struct {
+		Interval        int64          `yaml:"Interval"`        // 清理间隔(秒), 0表示不启动清理任务; 单次清理最多执行一个间隔, 未完成的分表下次继续
+		BatchCount      int            `yaml:"BatchCount"`      // 每批删除的行数
+		DeletedKeepDays int            `yaml:"DeletedKeepDays"` // 软删除的消息保留天数
+		Single          *RetentionRule `yaml:"Single"`
+		Group           *RetentionRule `yaml:"Group"`
+		SuperGroup      *RetentionRule `yaml:"SuperGroup"`
+	}
+
+	// IM msgapi服务自有的IM配置, 与基础服务的IM配置位于同一节点下
+	IM struct {
+		MaxPinMessage       int                  `yaml:"MaxPinMessage"`       // 每个会话最多置顶消息数
+		RevokeTimeLimit     *RevokeTimeLimit     `yaml:"RevokeTimeLimit"`     // 普通成员撤回消息的时间窗口
+		SendRateLimit       *SendRateLimit       `yaml:"SendRateLimit"`       // 发送消息限流
+		MsgTypeFuncFlag     map[int]int64        `yaml:"MsgTypeFuncFlag"`     // 消息类型需要会话开启的功能位, 未配置的消息类型不校验
+		SuperGroupPromotion *SuperGroupPromotion `yaml:"SuperGroupPromotion"` // 群自动升级为超级群
+		MessageRetention    *MessageRetention    `yaml:"MessageRetention"`    // 消息保留策略
+	}
+
+	// MsgChecker 本地敏感词检测配置, 本地检测先于msg_check_api远程检测执行
+	MsgChecker struct {
+		WordFile       string `yaml:"WordFile"`       // 敏感词库文件, 为空不启用本地检测
+		ReloadInterval int64  `yaml:"ReloadInterval"` // 词库文件变更检查间隔(秒), 0表示不热加载
+		MessageTypes   []int  `yaml:"MessageTypes"`   // 需要检测的消息类型, 为空检测所有类型
+	}
+
+	// MsgSchema 消息体schema校验配置
+	MsgSchema struct {
+		Dir         string `yaml:"Dir"`         // schema文件目录, 为空不启用校验
+		UnknownType string `yaml:"UnknownType"` // 未注册schema的消息类型处理策略 allow/deny
+	}
+
+	// MsgApiConfig msgapi服务自有配置, 与基础服务配置从同一配置文件加载
+	MsgApiConfig struct {
+		IM         *IM         `yaml:"IM"`
+		MsgChecker *MsgChecker `yaml:"MsgChecker"`
+		MsgSchema  *MsgSchema  `yaml:"MsgSchema"`
+	}
+
+	// ServerConfig 基础服务配置和msgapi服务自有配置, 两者都有IM配置项, 加载一次后分别解析
+	ServerConfig struct {
+		Config       *conf.Config
+		MsgApiConfig *MsgApiConfig
+	}
+)
+
+func (c *ServerConfig) UnmarshalYAML(value *yaml.Node) error {
+	c.Config = &conf.Config{}
+	if err := value.Decode(c.Config); err != nil {
+		return err
+	}
+	c.MsgApiConfig = &MsgApiConfig{}
+	return value.Decode(c.MsgApiConfig)
+}
+
+// RevokeTimeLimitMs 返回会话类型对应的撤回时间窗口(毫秒), 0表示不限制
+func (i *IM) RevokeTimeLimitMs(sessionType int) int64 {
+	switch sessionType {
+	case model.SingleSessionType:
+		return *i.RevokeTimeLimit.Single * 1000
+	case model.GroupSessionType:
+		return *i.RevokeTimeLimit.Group * 1000
+	case model.SuperGroupSessionType:
+		return *i.RevokeTimeLimit.SuperGroup * 1000
+	default:
+		return 0
+	}
+}
+
+// SendRateLimitRule 返回会话类型对应的发送限流规则, 未配置返回nil
+func (i *IM) SendRateLimitRule(sessionType int) *SendRateLimitRule {
+	if i.SendRateLimit == nil {
+		return nil
+	}
+	switch sessionType {
+	case model.SingleSessionType:
+		return i.SendRateLimit.Single
+	case model.GroupSessionType:
+		return i.SendRateLimit.Group
+	case model.SuperGroupSessionType:
+		return i.SendRateLimit.SuperGroup
+	default:
+		return nil
+	}
+}
+
+// Rule 返回会话类型对应的保留规则, 未配置返回nil
+func (r *MessageRetention) Rule(sessionType int) *RetentionRule {
+	switch sessionType {
+	case model.SingleSessionType:
+		return r.Single
+	case model.GroupSessionType:
+		return r.Group
+	case model.SuperGroupSessionType:
+		return r.SuperGroup
+	default:
+		return nil
+	}
+}
+
+// RequiredFunctionFlag 返回发送该类型消息需要会话开启的功能位, 0表示不校验
+func (i *IM) RequiredFunctionFlag(msgType int) int64 {
+	return i.MsgTypeFuncFlag[msgType]
+}
+
+// ShouldPromote 群成员数增加到memberCount后是否需要自动升级为超级群
+func (p *SuperGroupPromotion) ShouldPromote(memberCount int) bool {
+	return p.MemberThreshold > 0 && memberCount > p.MemberThreshold
+}
+
+// Enabled 令牌桶配置是否有效
+func (t *TokenBucket) Enabled() bool {
+	return t != nil && t.Rate > 0 && t.Burst > 0
+}
+
+func (c *MsgApiConfig) setDefaults() {
+	if c.IM == nil {
+		c.IM = &IM{}
+	}
+	if c.IM.MaxPinMessage <= 0 {
+		c.IM.MaxPinMessage = defaultMaxPinMessage
+	}
+	if c.IM.RevokeTimeLimit == nil {
+		c.IM.RevokeTimeLimit = &RevokeTimeLimit{}
+	}
+	for _, limit := range []**int64{&c.IM.RevokeTimeLimit.Single, &c.IM.RevokeTimeLimit.Group, &c.IM.RevokeTimeLimit.SuperGroup} {
+		if *limit == nil {
+			defaultLimit := int64(defaultRevokeTimeLimit)
+			*limit = &defaultLimit
+		}
+	}
+	if c.IM.SuperGroupPromotion == nil {
+		c.IM.SuperGroupPromotion = &SuperGroupPromotion{}
+	}
+	if c.IM.SuperGroupPromotion.HistoryCount <= 0 {
+		c.IM.SuperGroupPromotion.HistoryCount = defaultPromotionHistoryCount
+	}
+	if c.IM.MessageRetention == nil {
+		c.IM.MessageRetention = &MessageRetention{}
+	}
+	if c.IM.MessageRetention.BatchCount <= 0 {
+		c.IM.MessageRetention.BatchCount = defaultRetentionBatchCount
+	}
+	if c.MsgSchema != nil && c.MsgSchema.UnknownType != MsgSchemaUnknownTypeDeny {
+		c.MsgSchema.UnknownType = MsgSchemaUnknownTypeAllow
+	}
+}
@@ -5,12 +5,21 @@ import (
 	"github.com/thk-im/thk-im-base-server/server"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/loader"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/schema"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/sdk"
 	userSdk "github.com/thk-im/thk-im-user-server/pkg/sdk"
+	"time"
 )
 
 type Context struct {
 	*server.Context
+	msgApiConfig  *MsgApiConfig
+	msgCheckerApi sdk.MsgCheckerApi
+	msgSchemas    *schema.Registry
+}
+
+func (c *Context) MsgApiConfig() *MsgApiConfig {
+	return c.msgApiConfig
 }
 
 func (c *Context) SessionModel() model.SessionModel {
@@ -41,6 +50,74 @@ func (c *Context) SessionObjectModel() model.SessionObjectModel {
 	return c.Context.ModelMap["session_object"].(model.SessionObjectModel)
 }
 
+func (c *Context) MessageOutboxModel() model.MessageOutboxModel {
+	return c.Context.ModelMap["message_outbox"].(model.MessageOutboxModel)
+}
+
+func (c *Context) ScheduledMessageModel() model.ScheduledMessageModel {
+	return c.Context.ModelMap["scheduled_message"].(model.ScheduledMessageModel)
+}
+
+func (c *Context) MessageReactionModel() model.MessageReactionModel {
+	return c.Context.ModelMap["message_reaction"].(model.MessageReactionModel)
+}
+
+func (c *Context) MessageThreadModel() model.MessageThreadModel {
+	return c.Context.ModelMap["message_thread"].(model.MessageThreadModel)
+}
+
+func (c *Context) UserThreadModel() model.UserThreadModel {
+	return c.Context.ModelMap["user_thread"].(model.UserThreadModel)
+}
+
+func (c *Context) SessionPinModel() model.SessionPinModel {
+	return c.Context.ModelMap["session_pin"].(model.SessionPinModel)
+}
+
+func (c *Context) MessageEditHistoryModel() model.MessageEditHistoryModel {
+	return c.Context.ModelMap["message_edit_history"].(model.MessageEditHistoryModel)
+}
+
+func (c *Context) MessageRevokeAuditModel() model.MessageRevokeAuditModel {
+	return c.Context.ModelMap["message_revoke_audit"].(model.MessageRevokeAuditModel)
+}
+
+func (c *Context) MessageReadModel() model.MessageReadModel {
+	return c.Context.ModelMap["message_read"].(model.MessageReadModel)
+}
+
+func (c *Context) UserMentionModel() model.UserMentionModel {
+	return c.Context.ModelMap["user_mention"].(model.UserMentionModel)
+}
+
+func (c *Context) SessionMentionModel() model.SessionMentionModel {
+	return c.Context.ModelMap["session_mention"].(model.SessionMentionModel)
+}
+
+func (c *Context) MessageSearchIndex() model.MessageSearchIndex {
+	return c.Context.ModelMap["message_search"].(model.MessageSearchIndex)
+}
+
+func (c *Context) MessageReviewModel() model.MessageReviewModel {
+	return c.Context.ModelMap["message_review"].(model.MessageReviewModel)
+}
+
+func (c *Context) MessageSnapshotModel() model.MessageSnapshotModel {
+	return c.Context.ModelMap["message_snapshot"].(model.MessageSnapshotModel)
+}
+
+func (c *Context) UserFavoriteModel() model.UserFavoriteModel {
+	return c.Context.ModelMap["user_favorite"].(model.UserFavoriteModel)
+}
+
+func (c *Context) UserFavoriteObjectModel() model.UserFavoriteObjectModel {
+	return c.Context.ModelMap["user_favorite_object"].(model.UserFavoriteObjectModel)
+}
+
+func (c *Context) UserDeviceCursorModel() model.UserDeviceCursorModel {
+	return c.Context.ModelMap["user_device_cursor"].(model.UserDeviceCursorModel)
+}
+
 func (c *Context) LoginApi() userSdk.LoginApi {
 	return c.Context.SdkMap["login_api"].(userSdk.LoginApi)
 }
@@ -49,14 +126,18 @@ func (c *Context) UserApi() userSdk.UserApi {
 	return c.Context.SdkMap["user_api"].(userSdk.UserApi)
 }
 
+// MessageSchemaRegistry 消息体schema注册表, 未配置返回nil
+func (c *Context) MessageSchemaRegistry() *schema.Registry {
+	return c.msgSchemas
+}
+
 func (c *Context) MessageCheckApi() sdk.MsgCheckerApi {
-	if c.Context.SdkMap["msg_check_api"] == nil {
-		return nil
-	}
-	return c.Context.SdkMap["msg_check_api"].(sdk.MsgCheckerApi)
+	return c.msgCheckerApi
 }
 
-func (c *Context) Init(config *conf.Config) {
+func (c *Context) Init(config *conf.Config, msgApiConfig *MsgApiConfig) {
+	msgApiConfig.setDefaults()
+	c.msgApiConfig = msgApiConfig
 	c.Context = &server.Context{}
 	c.Context.Init(config)
 	c.Context.SdkMap = loader.LoadSdks(c.Config().Sdks, c.Logger())
@@ -65,4 +146,29 @@ func (c *Context) Init(config *conf.Config) {
 	if err != nil {
 		panic(err)
 	}
+	c.initMsgCheckerApi()
+	if msgApiConfig.MsgSchema != nil && msgApiConfig.MsgSchema.Dir != "" {
+		c.msgSchemas, err = schema.LoadRegistry(msgApiConfig.MsgSchema.Dir)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// initMsgCheckerApi 组合消息检测: 本地敏感词检测在前, msg_check_api远程检测在后
+func (c *Context) initMsgCheckerApi() {
+	var localChecker, remoteChecker sdk.MsgCheckerApi
+	checkerConfig := c.msgApiConfig.MsgChecker
+	if checkerConfig != nil && checkerConfig.WordFile != "" {
+		checker, err := sdk.NewLocalMsgCheckerApi(checkerConfig.WordFile, checkerConfig.MessageTypes,
+			time.Duration(checkerConfig.ReloadInterval)*time.Second, c.Logger())
+		if err != nil {
+			panic(err)
+		}
+		localChecker = checker
+	}
+	if c.Context.SdkMap["msg_check_api"] != nil {
+		remoteChecker = c.Context.SdkMap["msg_check_api"].(sdk.MsgCheckerApi)
+	}
+	c.msgCheckerApi = sdk.NewMsgCheckerChain(localChecker, remoteChecker)
 }
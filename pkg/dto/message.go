@@ -1,6 +1,7 @@
 package dto
 
 type GetSessionMessageReq struct {
+	UId    int64  `json:"u_id" form:"u_id"`
 	SId    int64  `json:"s_id" form:"id"`
 	CTime  int64  `json:"c_time" form:"c_time"`
 	Offset int    `json:"offset" form:"offset"`
@@ -21,10 +22,19 @@ type GetMessageReq struct {
 	Offset int   `json:"offset" form:"offset"`
 	Count  int   `json:"count" form:"count"`
 	CTime  int64 `json:"c_time" form:"c_time"`
+	MsgId  int64 `json:"msg_id" form:"msg_id"` // 上一页最后一条消息的id, 与c_time一起翻页, 为0时只按c_time翻页
+}
+
+type GetMessageBySeqReq struct {
+	UId     int64 `json:"u_id" form:"u_id"`
+	SId     int64 `json:"s_id" form:"s_id"`
+	FromSeq int64 `json:"from_seq" form:"from_seq"` // 不包含
+	ToSeq   int64 `json:"to_seq" form:"to_seq"`     // 包含
 }
 
 type GetMessageRes struct {
-	Data interface{} `json:"data"`
+	Data      interface{} `json:"data"`
+	PurgedSeq int64       `json:"purged_seq,omitempty"` // 按序号查询时返回, 不大于该序号的消息已被清理
 }
 
 type DeleteMessageReq struct {
@@ -48,30 +58,42 @@ type PushMessageRes struct {
 }
 
 type Message struct {
-	CId     int64   `json:"c_id"` // 消息客户端id
-	SId     int64   `json:"s_id"`
-	MsgId   int64   `json:"msg_id"` // 消息服务端id
-	Type    int     `json:"type"`
-	FUid    int64   `json:"f_u_id"`
-	CTime   int64   `json:"c_time"`
-	Body    string  `json:"body"`
-	Status  *int    `json:"status,omitempty"`
-	RMsgId  *int64  `json:"r_msg_id,omitempty"`
-	AtUsers *string `json:"at_users,omitempty"`
-	ExtData *string `json:"ext_data,omitempty"`
+	CId           int64            `json:"c_id"` // 消息客户端id
+	SId           int64            `json:"s_id"`
+	MsgId         int64            `json:"msg_id"` // 消息服务端id
+	Seq           int64            `json:"seq"`    // 会话内消息序号, 指定接收人的消息为0
+	Type          int              `json:"type"`
+	FUid          int64            `json:"f_u_id"`
+	CTime         int64            `json:"c_time"`
+	Body          string           `json:"body"`
+	Status        *int             `json:"status,omitempty"`
+	RMsgId        *int64           `json:"r_msg_id,omitempty"`
+	AtUsers       *string          `json:"at_users,omitempty"`
+	ExtData       *string          `json:"ext_data,omitempty"`
+	TtlMs         int64            `json:"ttl_ms,omitempty"`          // 消息存活时长(毫秒)
+	BurnAfterRead bool             `json:"burn_after_read,omitempty"` // 阅后即焚
+	ExpireTime    int64            `json:"expire_time,omitempty"`     // 过期时间, 阅后即焚消息已读后才有值
+	Reactions     []*ReactionCount `json:"reactions,omitempty"`       // 各表情回应数
+	MyReactions   []string         `json:"my_reactions,omitempty"`    // 自己回应的表情
+	ReplyCount    int              `json:"reply_count,omitempty"`     // 话题回复数
+	LastReplyTime int64            `json:"last_reply_time,omitempty"` // 话题最后回复时间
 }
 
 type SendMessageReq struct {
-	CId       int64   `json:"c_id" binding:"required"`
-	SId       int64   `json:"s_id" binding:"required"`
-	Type      int     `json:"type" binding:"required"`
-	CTime     int64   `json:"c_time" binding:"required"`
-	Body      string  `json:"body" binding:"required"`
-	FUid      int64   `json:"f_u_id,omitempty"`
-	RMsgId    *int64  `json:"r_msg_id,omitempty"`
-	AtUsers   *string `json:"at_users,omitempty"`
-	Receivers []int64 `json:"receivers,omitempty"`
-	ExtData   *string `json:"ext_data,omitempty"`
+	CId           int64   `json:"c_id" binding:"required"`
+	SId           int64   `json:"s_id" binding:"required"`
+	Type          int     `json:"type" binding:"required"`
+	CTime         int64   `json:"c_time" binding:"required"`
+	Body          string  `json:"body" binding:"required"`
+	FUid          int64   `json:"f_u_id,omitempty"`
+	RMsgId        *int64  `json:"r_msg_id,omitempty"`
+	AtUsers       *string `json:"at_users,omitempty"`
+	Receivers     []int64 `json:"receivers,omitempty"`
+	ExtData       *string `json:"ext_data,omitempty"`
+	SendAt        *int64  `json:"send_at,omitempty"`         // 定时发送时间(毫秒), 为空或已过期则立即发送
+	TtlMs         int64   `json:"ttl_ms,omitempty"`          // 消息存活时长(毫秒), 为0则永久保存
+	BurnAfterRead bool    `json:"burn_after_read,omitempty"` // 阅后即焚, 已读后开始按ttl_ms倒计时
+	BodyVer       int     `json:"body_ver,omitempty"`        // 消息体schema版本, 为0时符合任一版本即可
 }
 
 type SendSysMessageReq struct {
@@ -80,11 +102,13 @@ type SendSysMessageReq struct {
 	Body      string  `json:"body" binding:"required"`
 	Receivers []int64 `json:"receivers,omitempty"`
 	ExtData   *string `json:"ext_data,omitempty"`
+	SendAt    *int64  `json:"send_at,omitempty"` // 定时发送时间(毫秒), 为空或已过期则立即发送
 }
 
 type SendMessageRes struct {
 	MsgId      int64   `json:"msg_id"`
 	CreateTime int64   `json:"c_time"`
+	ScheduleId int64   `json:"schedule_id,omitempty"` // 定时消息id, 定时发送时返回
 	OnlineIds  []int64 `json:"online_ids,omitempty"`
 	OfflineIds []int64 `json:"offline_ids,omitempty"`
 }
@@ -92,10 +116,64 @@ type SendMessageRes struct {
 type SendSysMessageRes struct {
 	MsgId      int64   `json:"msg_id"`
 	CreateTime int64   `json:"c_time"`
+	ScheduleId int64   `json:"schedule_id,omitempty"` // 定时消息id, 定时发送时返回
 	OnlineIds  []int64 `json:"online_ids,omitempty"`
 	OfflineIds []int64 `json:"offline_ids,omitempty"`
 }
 
+type ScheduledMessage struct {
+	Id      int64  `json:"id"`
+	Type    int    `json:"type"` // 1会话消息/2系统消息
+	SId     int64  `json:"s_id"`
+	FUid    int64  `json:"f_u_id"`
+	MsgType int    `json:"msg_type"`
+	Content string `json:"content"` // 发送请求内容
+	SendAt  int64  `json:"send_at"`
+	CTime   int64  `json:"c_time"`
+}
+
+type QueryScheduledMessageReq struct {
+	UId    int64  `json:"u_id" form:"u_id"`
+	SId    *int64 `json:"s_id" form:"s_id"`
+	Offset int    `json:"offset" form:"offset"`
+	Count  int    `json:"count" form:"count"`
+}
+
+type QueryScheduledMessageRes struct {
+	Data []*ScheduledMessage `json:"data"`
+}
+
+type CancelScheduledMessageReq struct {
+	UId int64 `json:"u_id"`
+	Id  int64 `json:"id" binding:"required"`
+}
+
 type KickUserReq struct {
 	UIds []int64 `json:"u_ids" binding:"required"`
 }
+
+type QueryRateLimitedReq struct {
+	Scope string `json:"scope" form:"scope" binding:"required,oneof=user session user_session"` // 限流维度
+	Date  string `json:"date" form:"date"`                                                      // 格式yyyyMMdd, 默认当天
+	Count int    `json:"count" form:"count"`
+}
+
+type RateLimitedCount struct {
+	Target string `json:"target"` // 用户id/会话id/用户id:会话id
+	Count  int64  `json:"count"`
+}
+
+type QueryRateLimitedRes struct {
+	Scope string              `json:"scope"`
+	Date  string              `json:"date"`
+	Data  []*RateLimitedCount `json:"data"`
+}
+
+type QueryMessagePurgedReq struct {
+	Date string `json:"date" form:"date"` // 格式yyyyMMdd, 默认当天
+}
+
+type QueryMessagePurgedRes struct {
+	Date string           `json:"date"`
+	Data map[string]int64 `json:"data"` // key为"表:原因", 如user_message:retention, session_message:deleted
+}
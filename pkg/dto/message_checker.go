@@ -1,11 +1,12 @@
 package dto
 
 type CheckMessageReq struct {
-	SessionType    int    `json:"session_type"`
-	SessionId      int64  `json:"session_id"`
-	FunctionFlag   int64  `json:"function_flag"`
-	FromUId        int64  `json:"from_u_id"`
-	EntityId       int64  `json:"entity_id"`
-	MessageType    int    `json:"message_type"`
-	MessageContent string `json:"message_content"`
+	SessionType      int      `json:"session_type"`
+	SessionId        int64    `json:"session_id"`
+	FunctionFlag     int64    `json:"function_flag"`
+	FromUId          int64    `json:"from_u_id"`
+	EntityId         int64    `json:"entity_id"`
+	MessageType      int      `json:"message_type"`
+	MessageContent   string   `json:"message_content"`
+	ReviewCategories []string `json:"review_categories,omitempty"` // 检测命中的待审核分类, 消息正常发送后记录审核
 }
@@ -0,0 +1,36 @@
+package dto
+
+type AddFavoriteReq struct {
+	UId   int64 `json:"u_id"`
+	SId   int64 `json:"s_id" binding:"required"`
+	MsgId int64 `json:"msg_id" binding:"required"`
+}
+
+type DelFavoriteReq struct {
+	UId int64 `json:"u_id"`
+	Id  int64 `json:"id" binding:"required"`
+}
+
+type QueryFavoriteReq struct {
+	UId   int64  `json:"u_id" form:"u_id"`
+	SId   *int64 `json:"s_id" form:"s_id"`
+	Type  *int   `json:"type" form:"type"`
+	CTime int64  `json:"c_time" form:"c_time"` // 收藏时间游标, 为0从最新开始
+	Count int    `json:"count" form:"count"`
+}
+
+type Favorite struct {
+	Id      int64   `json:"id"`
+	SId     int64   `json:"s_id"`
+	MsgId   int64   `json:"msg_id"`
+	Type    int     `json:"type"`
+	FUid    int64   `json:"f_u_id"`
+	Body    string  `json:"body"`
+	ExtData *string `json:"ext_data,omitempty"`
+	MsgTime int64   `json:"msg_time"` // 消息发送时间
+	CTime   int64   `json:"c_time"`   // 收藏时间
+}
+
+type QueryFavoriteRes struct {
+	Data []*Favorite `json:"data"`
+}
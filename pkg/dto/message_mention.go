@@ -0,0 +1,21 @@
+package dto
+
+type QueryUserMentionsReq struct {
+	UId   int64  `json:"u_id" form:"u_id"`
+	SId   *int64 `json:"s_id" form:"s_id"`
+	CTime int64  `json:"c_time" form:"c_time"` // 不包含, 从该时间之前开始查询, 为0从最新开始
+	Count int    `json:"count" form:"count"`
+}
+
+type UserMention struct {
+	SId     int64    `json:"s_id"`
+	MsgId   int64    `json:"msg_id"`
+	FUid    int64    `json:"f_u_id"`
+	AtAll   bool     `json:"at_all"` // 是否为@全体成员
+	CTime   int64    `json:"c_time"`
+	Message *Message `json:"message,omitempty"`
+}
+
+type QueryUserMentionsRes struct {
+	Data []*UserMention `json:"data"`
+}
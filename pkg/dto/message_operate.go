@@ -18,6 +18,34 @@ type RevokeUserMessageReq struct {
 	MsgId int64 `json:"msg_id" binding:"required"`
 }
 
+// RevokeMessageBody 撤回操作消息的消息体
+type RevokeMessageBody struct {
+	FUid         int64 `json:"f_u_id"`        // 被撤回消息的发送人
+	OperatorId   int64 `json:"operator_id"`   // 撤回操作人
+	OperatorRole int   `json:"operator_role"` // 撤回操作人角色
+}
+
+type QueryRevokeAuditsReq struct {
+	SId   int64 `json:"s_id" form:"s_id"`
+	CTime int64 `json:"c_time" form:"c_time"` // 查询该时间之前的记录, 默认当前时间
+	Count int   `json:"count" form:"count"`
+}
+
+// RevokeAudit 撤回他人消息的审计记录
+type RevokeAudit struct {
+	SId          int64  `json:"s_id"`
+	MsgId        int64  `json:"msg_id"`
+	FUid         int64  `json:"f_u_id"`        // 被撤回消息的发送人
+	OperatorId   int64  `json:"operator_id"`   // 撤回操作人
+	OperatorRole int    `json:"operator_role"` // 撤回操作人角色
+	Body         string `json:"body"`          // 被撤回消息的内容
+	CTime        int64  `json:"c_time"`
+}
+
+type QueryRevokeAuditsRes struct {
+	Data []*RevokeAudit `json:"data"`
+}
+
 type ReeditUserMessageReq struct {
 	UId     int64  `json:"u_id"`
 	SId     int64  `json:"s_id" binding:"required"`
@@ -25,9 +53,73 @@ type ReeditUserMessageReq struct {
 	Content string `json:"content" binding:"required"`
 }
 
+type GetMessageEditHistoryReq struct {
+	UId   int64 `json:"u_id" form:"u_id"`
+	SId   int64 `json:"s_id" form:"s_id" binding:"required"`
+	MsgId int64 `json:"msg_id" form:"id"`
+}
+
+type MessageEditHistory struct {
+	MsgId int64  `json:"msg_id"`
+	UId   int64  `json:"u_id"`   // 编辑人
+	Body  string `json:"body"`   // 编辑前的消息内容
+	CTime int64  `json:"c_time"` // 编辑时间
+}
+
+type GetMessageEditHistoryRes struct {
+	Data []*MessageEditHistory `json:"data"`
+}
+
 type ForwardUserMessageReq struct {
 	SendMessageReq
 	ForwardSId       int64   `json:"fwd_s_id" binding:"required"`
 	ForwardFromUIds  []int64 `json:"fwd_from_u_ids" binding:"required"`
 	ForwardClientIds []int64 `json:"fwd_client_ids" binding:"required"`
 }
+
+type ForwardMergedMessageReq struct {
+	CId        int64   `json:"c_id" binding:"required"`
+	SId        int64   `json:"s_id" binding:"required"`
+	Type       int     `json:"type" binding:"required"` // 合并转发消息类型, 由客户端约定
+	CTime      int64   `json:"c_time" binding:"required"`
+	FUid       int64   `json:"f_u_id"`
+	Title      string  `json:"title"`
+	ForwardSId int64   `json:"fwd_s_id" binding:"required"` // 被转发消息的来源会话
+	MsgIds     []int64 `json:"msg_ids" binding:"required"`  // 被转发的消息id列表
+	ExtData    *string `json:"ext_data,omitempty"`
+}
+
+// SnapshotMessage 聊天记录快照中的单条消息
+type SnapshotMessage struct {
+	MsgId   int64   `json:"msg_id"`
+	Type    int     `json:"type"`
+	FUid    int64   `json:"f_u_id"`
+	CTime   int64   `json:"c_time"`
+	Body    string  `json:"body"`
+	ExtData *string `json:"ext_data,omitempty"`
+}
+
+// MergedForwardBody 合并转发消息的消息体, 完整的消息列表通过快照id查询
+type MergedForwardBody struct {
+	SnapshotId int64              `json:"snapshot_id"`
+	FromSId    int64              `json:"from_s_id"`
+	Title      string             `json:"title,omitempty"`
+	Count      int                `json:"count"`
+	Preview    []*SnapshotMessage `json:"preview"` // 前几条消息, 用于消息列表展示
+}
+
+type GetMessageSnapshotReq struct {
+	UId  int64   `json:"u_id" form:"u_id"`
+	SId  int64   `json:"s_id" form:"s_id" binding:"required"`
+	Id   int64   `json:"id" form:"id"`
+	PIds []int64 `json:"p_ids" form:"p_ids"` // 查询嵌套的聊天记录时, 从外到内的上级快照id链
+}
+
+type GetMessageSnapshotRes struct {
+	Id       int64              `json:"id"`
+	SId      int64              `json:"s_id"`
+	FromSId  int64              `json:"from_s_id"`
+	FUid     int64              `json:"f_u_id"`
+	CTime    int64              `json:"c_time"`
+	Messages []*SnapshotMessage `json:"messages"`
+}
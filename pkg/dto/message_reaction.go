@@ -0,0 +1,42 @@
+package dto
+
+const (
+	ReactionActionAdd    = 1
+	ReactionActionRemove = 2
+)
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type MessageReactionReq struct {
+	UId   int64  `json:"u_id"`
+	SId   int64  `json:"s_id" binding:"required"`
+	MsgId int64  `json:"msg_id" binding:"required"`
+	Emoji string `json:"emoji" binding:"required,max=64"`
+}
+
+type QueryMessageReactionReq struct {
+	UId    int64 `json:"u_id" form:"u_id"`
+	SId    int64 `json:"s_id" form:"s_id" binding:"required"`
+	MsgId  int64 `json:"msg_id" form:"msg_id" binding:"required"`
+	Offset int   `json:"offset" form:"offset"`
+	Count  int   `json:"count" form:"count"`
+}
+
+type MessageReaction struct {
+	UId   int64  `json:"u_id"`
+	Emoji string `json:"emoji"`
+	CTime int64  `json:"c_time"`
+}
+
+type QueryMessageReactionRes struct {
+	Data []*MessageReaction `json:"data"`
+}
+
+// MessageReactionBody 表情回应变更操作消息的消息体
+type MessageReactionBody struct {
+	Emoji  string `json:"emoji"`
+	Action int    `json:"action"` // 1添加/2移除
+}
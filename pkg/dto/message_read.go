@@ -0,0 +1,26 @@
+package dto
+
+type GetMessageReadUsersReq struct {
+	UId    int64 `json:"u_id" form:"u_id"`
+	SId    int64 `json:"s_id" form:"s_id" binding:"required"`
+	MsgId  int64 `json:"msg_id" form:"msg_id" binding:"required"`
+	Read   int8  `json:"read" form:"read"` // 1查询已读用户/0查询未读用户
+	Offset int   `json:"offset" form:"offset"`
+	Count  int   `json:"count" form:"count"`
+}
+
+type MessageReadUser struct {
+	UId   int64 `json:"u_id"`
+	CTime int64 `json:"c_time,omitempty"` // 已读时间, 未读用户为空
+}
+
+type GetMessageReadUsersRes struct {
+	ReadCount   int                `json:"read_count"`
+	UnreadCount int                `json:"unread_count"`
+	Data        []*MessageReadUser `json:"data"`
+}
+
+// MessageReadCountBody 群消息已读数变更操作消息的消息体
+type MessageReadCountBody struct {
+	ReadCount int `json:"read_count"`
+}
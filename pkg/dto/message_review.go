@@ -0,0 +1,22 @@
+package dto
+
+type QueryMessageReviewsReq struct {
+	SId   int64 `json:"s_id" form:"s_id"`
+	CTime int64 `json:"c_time" form:"c_time"` // 查询该时间之前的记录, 默认当前时间
+	Count int   `json:"count" form:"count"`
+}
+
+// MessageReview 命中待审核敏感词的消息记录
+type MessageReview struct {
+	SId        int64    `json:"s_id"`
+	MsgId      int64    `json:"msg_id"`
+	FUid       int64    `json:"f_u_id"`
+	Categories []string `json:"categories"` // 命中的待审核分类
+	Body       string   `json:"body"`       // 脱敏后的消息内容
+	Status     int8     `json:"status"`     // 0待审核 1审核通过 2审核不通过
+	CTime      int64    `json:"c_time"`
+}
+
+type QueryMessageReviewsRes struct {
+	Data []*MessageReview `json:"data"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+type SearchMessageReq struct {
+	UId      int64  `json:"u_id" form:"u_id"`
+	Keywords string `json:"keywords" form:"keywords" binding:"required,max=64"`
+	SId      *int64 `json:"s_id" form:"s_id"`
+	FUid     *int64 `json:"f_u_id" form:"f_u_id"`
+	Type     *int   `json:"type" form:"type"`
+	TimeFrom int64  `json:"time_from" form:"time_from"` // 包含
+	TimeTo   int64  `json:"time_to" form:"time_to"`     // 不包含, 翻页时传上一页最后一条消息的时间
+	Count    int    `json:"count" form:"count"`
+}
+
+type SearchMessageRes struct {
+	Data []*Message `json:"data"`
+}
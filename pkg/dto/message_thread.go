@@ -0,0 +1,31 @@
+package dto
+
+type GetThreadRepliesReq struct {
+	UId       int64 `json:"u_id" form:"u_id"`
+	SId       int64 `json:"s_id" form:"s_id" binding:"required"`
+	RootMsgId int64 `json:"root_msg_id" form:"root_msg_id" binding:"required"`
+	CTime     int64 `json:"c_time" form:"c_time"` // 不包含, 从该时间之后开始查询
+	Count     int   `json:"count" form:"count"`
+}
+
+type QueryUserThreadsReq struct {
+	UId    int64  `json:"u_id" form:"u_id"`
+	SId    *int64 `json:"s_id" form:"s_id"`
+	Offset int    `json:"offset" form:"offset"`
+	Count  int    `json:"count" form:"count"`
+}
+
+type UserThread struct {
+	SId            int64    `json:"s_id"`
+	RootMsgId      int64    `json:"root_msg_id"`
+	ReplyCount     int      `json:"reply_count"`
+	LastReplyMsgId int64    `json:"last_reply_msg_id"`
+	LastReplyTime  int64    `json:"last_reply_time"`
+	JoinTime       int64    `json:"join_time"`   // 首次参与时间
+	ActiveTime     int64    `json:"active_time"` // 最后参与时间
+	RootMessage    *Message `json:"root_message,omitempty"`
+}
+
+type QueryUserThreadsRes struct {
+	Data []*UserThread `json:"data"`
+}
@@ -97,22 +97,73 @@ type QueryUserSessionReq struct {
 }
 
 type UserSession struct {
-	SId          int64   `json:"s_id"`
-	Name         string  `json:"name"`
-	Remark       string  `json:"remark"`
-	FunctionFlag int64   `json:"function_flag"`
-	Type         int     `json:"type"`
-	Status       int     `json:"status"`
-	Role         int     `json:"role"`
-	Mute         int     `json:"mute"`
-	Top          int64   `json:"top"`
-	NoteName     string  `json:"note_name"`
-	NoteAvatar   string  `json:"note_avatar"`
-	Deleted      int8    `json:"deleted"`
-	EntityId     int64   `json:"entity_id"`
-	ExtData      *string `json:"ext_data,omitempty"`
-	CTime        int64   `json:"c_time"`
-	MTime        int64   `json:"m_time"`
+	SId          int64        `json:"s_id"`
+	Name         string       `json:"name"`
+	Remark       string       `json:"remark"`
+	FunctionFlag int64        `json:"function_flag"`
+	Type         int          `json:"type"`
+	Status       int          `json:"status"`
+	Role         int          `json:"role"`
+	Mute         int          `json:"mute"`
+	Top          int64        `json:"top"`
+	NoteName     string       `json:"note_name"`
+	NoteAvatar   string       `json:"note_avatar"`
+	Deleted      int8         `json:"deleted"`
+	EntityId     int64        `json:"entity_id"`
+	ExtData      *string      `json:"ext_data,omitempty"`
+	UnreadCount  int          `json:"unread_count"`            // 未读消息数
+	MentionCount int          `json:"mention_count"`           // 未读@我的消息数
+	LastMessage  *LastMessage `json:"last_message,omitempty"`  // 最后一条消息快照
+	Draft        *Draft       `json:"draft,omitempty"`         // 草稿
+	ReadSeq      int64        `json:"read_seq,omitempty"`      // 已读消息序号, 仅超级群
+	ReadMsgTime  int64        `json:"read_msg_time,omitempty"` // 已读消息的服务端时间(取自消息id), 仅超级群
+	CTime        int64        `json:"c_time"`
+	MTime        int64        `json:"m_time"`
+}
+
+type LastMessage struct {
+	MsgId int64  `json:"msg_id"`
+	Type  int    `json:"type"`
+	FUid  int64  `json:"f_u_id"`
+	Body  string `json:"body"` // 截断后的消息内容
+	CTime int64  `json:"c_time"`
+}
+
+type Draft struct {
+	Content string `json:"content"`
+	RMsgId  *int64 `json:"r_msg_id,omitempty"` // 草稿回复的消息id
+	MTime   int64  `json:"m_time"`
+}
+
+type UpdateDraftReq struct {
+	UId     int64  `json:"u_id"`
+	SId     int64  `json:"s_id"`
+	Content string `json:"content" binding:"required"`
+	RMsgId  *int64 `json:"r_msg_id,omitempty"`
+}
+
+// DraftSyncBody 草稿变更的同步信号, 其他端收到后重新拉取草稿, 发起变更的端按platform/device忽略
+type DraftSyncBody struct {
+	MTime    int64  `json:"m_time"`
+	Platform string `json:"platform"`
+	Device   string `json:"device"`
+}
+
+// ReadCursorSyncBody 超级群已读游标变更, 其他端据此清除未读, 游标只取较大值
+type ReadCursorSyncBody struct {
+	ReadSeq     int64  `json:"read_seq"`
+	ReadMsgTime int64  `json:"read_msg_time"`
+	Platform    string `json:"platform"`
+	Device      string `json:"device"`
+}
+
+type GetUserSessionUnreadTotalReq struct {
+	UId int64 `json:"u_id" form:"u_id"`
+}
+
+type GetUserSessionUnreadTotalRes struct {
+	UnreadCount  int `json:"unread_count"`
+	MentionCount int `json:"mention_count"`
 }
 
 type SessionUser struct {
@@ -171,3 +222,9 @@ type SessionUserUpdateReq struct {
 type SessionUserCountRes struct {
 	Count int `json:"count"`
 }
+
+type UpdateSessionRetentionReq struct {
+	Id    int64  `json:"id"`
+	Days  *int   `json:"days"`  // 消息保留天数, 0使用会话类型配置, -1永久保留
+	Count *int64 `json:"count"` // 消息保留条数, 0使用会话类型配置, -1不限制
+}
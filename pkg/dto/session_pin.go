@@ -0,0 +1,28 @@
+package dto
+
+const (
+	PinActionPin   = 1
+	PinActionUnpin = 2
+)
+
+type SessionPinReq struct {
+	UId   int64 `json:"u_id"`
+	SId   int64 `json:"s_id"`
+	MsgId int64 `json:"msg_id" binding:"required"`
+}
+
+type SessionPin struct {
+	MsgId   int64    `json:"msg_id"`
+	UId     int64    `json:"u_id"` // 置顶操作人
+	CTime   int64    `json:"c_time"`
+	Message *Message `json:"message,omitempty"`
+}
+
+type QuerySessionPinsRes struct {
+	Data []*SessionPin `json:"data"`
+}
+
+// SessionPinBody 置顶变更操作消息的消息体
+type SessionPinBody struct {
+	Action int `json:"action"` // 1置顶/2取消置顶
+}
@@ -3,13 +3,24 @@ package errorx
 import "github.com/thk-im/thk-im-base-server/errorx"
 
 var (
-	ErrSessionInvalid        = errorx.NewErrorX(4004001, "Invalid session")
-	ErrSessionAlreadyDeleted = errorx.NewErrorX(4004002, "group has been deleted")
-	ErrSessionType           = errorx.NewErrorX(4004003, "Session type error")
-	ErrSessionMessageInvalid = errorx.NewErrorX(4004004, "Invalid session message")
-	ErrMessageTypeNotSupport = errorx.NewErrorX(4004005, "Message type not support")
-	ErrSessionMuted          = errorx.NewErrorX(4004101, "Session muted")
-	ErrUserMuted             = errorx.NewErrorX(4004102, "User muted")
-	ErrUserReject            = errorx.NewErrorX(4004103, "user reject your message")
-	ErrMessageDeliveryFailed = errorx.NewErrorX(5004001, "Message delivery failed")
+	ErrSessionInvalid          = errorx.NewErrorX(4004001, "Invalid session")
+	ErrSessionAlreadyDeleted   = errorx.NewErrorX(4004002, "group has been deleted")
+	ErrSessionType             = errorx.NewErrorX(4004003, "Session type error")
+	ErrSessionMessageInvalid   = errorx.NewErrorX(4004004, "Invalid session message")
+	ErrMessageTypeNotSupport   = errorx.NewErrorX(4004005, "Message type not support")
+	ErrScheduledMsgInvalid     = errorx.NewErrorX(4004006, "Invalid scheduled message")
+	ErrPinMessageReachLimit    = errorx.NewErrorX(4004007, "Pinned message count reach limit")
+	ErrRevokeTimeExceeded      = errorx.NewErrorX(4004008, "Message revoke time limit exceeded")
+	ErrMentionInvalid          = errorx.NewErrorX(4004009, "Invalid mentioned users")
+	ErrMessageContentSensitive = errorx.NewErrorX(4004010, "Message content contains sensitive words")
+	ErrMessageBodyInvalid      = errorx.NewErrorX(4004011, "Invalid message body")
+	ErrBurnAfterReadNotSupport = errorx.NewErrorX(4004012, "Burn after read not support in super group")
+	ErrMessageNotPersistent    = errorx.NewErrorX(4004013, "Burn after read or ttl message can not be saved")
+	ErrSessionMuted            = errorx.NewErrorX(4004101, "Session muted")
+	ErrUserMuted               = errorx.NewErrorX(4004102, "User muted")
+	ErrUserReject              = errorx.NewErrorX(4004103, "user reject your message")
+	ErrRevokeForbidden         = errorx.NewErrorX(4004104, "No permission to revoke message")
+	ErrMentionAllForbidden     = errorx.NewErrorX(4004105, "No permission to mention all members")
+	ErrMessageSendTooFrequent  = errorx.NewErrorX(4004106, "Message send too frequently")
+	ErrMessageDeliveryFailed   = errorx.NewErrorX(5004001, "Message delivery failed")
 )
@@ -0,0 +1,20 @@
+package errorx
+
+import "fmt"
+
+// RateLimitError 限流错误, RetryAfter为建议的重试等待时间(毫秒), 可通过errors.As还原为ErrMessageSendTooFrequent
+type RateLimitError struct {
+	RetryAfter int64
+}
+
+func NewRateLimitError(retryAfter int64) *RateLimitError {
+	return &RateLimitError{RetryAfter: retryAfter}
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %d ms", ErrMessageSendTooFrequent.Error(), e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrMessageSendTooFrequent
+}
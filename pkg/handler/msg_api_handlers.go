@@ -37,6 +37,9 @@ func RegisterMsgApiHandlers(appCtx *app.Context) {
 		sessionRoute.PUT("/:id/user", updateSessionUser(appCtx))            // 会话成员修改
 		sessionRoute.GET("/:id/message", getSessionMessages(appCtx))        // 获取session下的消息列表
 		sessionRoute.DELETE("/:id/message", deleteSessionMessage(appCtx))   // 删除session下的消息列表
+		sessionRoute.GET("/:id/pin", getSessionPins(appCtx))                // 获取session下的置顶消息列表
+		sessionRoute.POST("/:id/pin", pinSessionMessage(appCtx))            // 置顶消息
+		sessionRoute.DELETE("/:id/pin", unpinSessionMessage(appCtx))        // 取消置顶消息
 
 		// 如果提供内置对象存储服务，则开放接口
 		if appCtx.ObjectStorage() != nil {
@@ -48,25 +51,43 @@ func RegisterMsgApiHandlers(appCtx *app.Context) {
 	userSessionRoute := httpEngine.Group("/user_session")
 	userSessionRoute.Use(authMiddleware)
 	{
-		userSessionRoute.GET("", queryUserSession(appCtx))                // 用户查询session
-		userSessionRoute.GET("/latest", getLatestUserSessions(appCtx))    // 用户获取自己最近的session列表
-		userSessionRoute.GET("/search", searchUserSessions(appCtx))       // 用户查询/搜索自己的session列表，按更新时间倒叙
-		userSessionRoute.GET("/:uid/:sid", queryUserSessionBySId(appCtx)) // 用户获取自己的session
-		userSessionRoute.PUT("", updateUserSession(appCtx))               // 用户修改自己的session
-		userSessionRoute.DELETE("/:uid/:sid", deleteUserSession(appCtx))  // 用户删除自己的session
+		userSessionRoute.GET("", queryUserSession(appCtx))                       // 用户查询session
+		userSessionRoute.GET("/latest", getLatestUserSessions(appCtx))           // 用户获取自己最近的session列表
+		userSessionRoute.GET("/search", searchUserSessions(appCtx))              // 用户查询/搜索自己的session列表，按更新时间倒叙
+		userSessionRoute.GET("/unread_total", getUserSessionUnreadTotal(appCtx)) // 用户获取自己所有session的未读总数
+		userSessionRoute.GET("/:uid/:sid", queryUserSessionBySId(appCtx))        // 用户获取自己的session
+		userSessionRoute.PUT("", updateUserSession(appCtx))                      // 用户修改自己的session
+		userSessionRoute.DELETE("/:uid/:sid", deleteUserSession(appCtx))         // 用户删除自己的session
+		userSessionRoute.GET("/:uid/:sid/draft", getDraft(appCtx))               // 用户获取自己session的草稿
+		userSessionRoute.PUT("/:uid/:sid/draft", updateDraft(appCtx))            // 用户保存自己session的草稿, 同步到其他端
+		userSessionRoute.DELETE("/:uid/:sid/draft", deleteDraft(appCtx))         // 用户清除自己session的草稿
 	}
 
 	messageRoute := httpEngine.Group("/message")
 	messageRoute.Use(authMiddleware)
 	{
-		messageRoute.GET("/latest", getUserLatestMessages(appCtx)) // 获取最近消息
-		messageRoute.POST("", sendMessage(appCtx))                 // 发送消息
-		messageRoute.DELETE("", deleteUserMessage(appCtx))         // 删除消息
-		messageRoute.POST("/ack", ackUserMessages(appCtx))         // 用户消息设置ack(已接收) 不支持超级群
-		messageRoute.POST("/read", readUserMessage(appCtx))        // 用户消息设置已读 不支持超级群
-		messageRoute.POST("/revoke", revokeUserMessage(appCtx))    // 用户消息撤回
-		messageRoute.POST("/reedit", reeditUserMessage(appCtx))    // 更新用户消息
-		messageRoute.POST("/forward", forwardUserMessage(appCtx))  // 转发用户消息
+		messageRoute.GET("/latest", getUserLatestMessages(appCtx))         // 获取最近消息
+		messageRoute.GET("/seq", getMessagesBySeq(appCtx))                 // 按会话序号区间获取消息, 用于补齐缺失消息
+		messageRoute.GET("/thread", queryUserThreads(appCtx))              // 获取用户参与的话题列表
+		messageRoute.GET("/thread/replies", getThreadReplies(appCtx))      // 分页获取话题根消息下的回复
+		messageRoute.GET("/mentions", queryUserMentions(appCtx))           // 获取@我的消息列表
+		messageRoute.GET("/search", searchMessages(appCtx))                // 按关键字搜索用户的历史消息
+		messageRoute.POST("", sendMessage(appCtx))                         // 发送消息
+		messageRoute.GET("/scheduled", queryScheduledMessages(appCtx))     // 查询待发送的定时消息
+		messageRoute.DELETE("/scheduled", cancelScheduledMessage(appCtx))  // 取消定时消息
+		messageRoute.DELETE("", deleteUserMessage(appCtx))                 // 删除消息
+		messageRoute.POST("/ack", ackUserMessages(appCtx))                 // 用户消息设置ack(已接收), 推进当前设备同步游标, 超级群推进已读游标
+		messageRoute.POST("/read", readUserMessage(appCtx))                // 用户消息设置已读, 超级群推进已读游标
+		messageRoute.GET("/read_users", getMessageReadUsers(appCtx))       // 分页查询群消息的已读/未读用户
+		messageRoute.POST("/revoke", revokeUserMessage(appCtx))            // 用户消息撤回
+		messageRoute.POST("/reedit", reeditUserMessage(appCtx))            // 更新用户消息
+		messageRoute.GET("/:id/history", getMessageEditHistory(appCtx))    // 查询消息编辑历史
+		messageRoute.POST("/forward", forwardUserMessage(appCtx))          // 转发用户消息
+		messageRoute.POST("/forward/merged", forwardMergedMessage(appCtx)) // 合并转发聊天记录
+		messageRoute.GET("/snapshot/:id", getMessageSnapshot(appCtx))      // 查询合并转发的聊天记录
+		messageRoute.GET("/reaction", queryMessageReactions(appCtx))       // 查询消息表情回应列表
+		messageRoute.POST("/reaction", addMessageReaction(appCtx))         // 添加消息表情回应
+		messageRoute.DELETE("/reaction", deleteMessageReaction(appCtx))    // 移除消息表情回应
 	}
 
 	systemRoute := httpEngine.Group("/system")
@@ -77,11 +98,19 @@ func RegisterMsgApiHandlers(appCtx *app.Context) {
 		systemRoute.POST("/user/kickoff", kickOffUser(appCtx))                     // 踢下线用户
 		systemRoute.POST("/session", createSession(appCtx))                        // 创建/获取session
 		systemRoute.PUT("/session", updateSessionType(appCtx))                     // 修改session
+		systemRoute.PUT("/session/:id/retention", updateSessionRetention(appCtx))  // 修改会话消息保留规则
+		systemRoute.POST("/session/:id/promote", promoteSuperGroup(appCtx))        // 群升级为超级群并迁移历史消息
+		systemRoute.GET("/session/:id/revoke_audit", queryRevokeAudits(appCtx))    // 查询撤回他人消息的审计记录
+		systemRoute.GET("/session/:id/review", queryMessageReviews(appCtx))        // 查询命中待审核敏感词的消息
 		systemRoute.GET("/session/:id/user/latest", getLatestSessionUsers(appCtx)) // 会话成员查询
 		systemRoute.POST("/session/:id/user", addSessionUser(appCtx))              // 会话增员
 		systemRoute.DELETE("/session/:id/user", deleteSessionUser(appCtx))         // 会话减员
 		systemRoute.POST("/session_message", sendSessionMessage(appCtx))           // 发送会话消息
 		systemRoute.POST("/system_message", sendSystemMessage(appCtx))             // 发送系统消息
+		systemRoute.GET("/scheduled_message", queryScheduledMessages(appCtx))      // 查询待发送的定时消息
+		systemRoute.DELETE("/scheduled_message", cancelScheduledMessage(appCtx))   // 取消定时消息
 		systemRoute.POST("/push_message", pushMessage(appCtx))                     // 推送消息(用户消息/好友消息/群组消息/自定义消息)
+		systemRoute.GET("/rate_limited", queryRateLimitedCounts(appCtx))           // 查询发送消息被限流最多的用户/会话
+		systemRoute.GET("/message/purged", queryMessagePurgedCounts(appCtx))       // 查询消息清理任务清理的消息数
 	}
 }
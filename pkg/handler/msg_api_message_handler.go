@@ -7,8 +7,10 @@ import (
 	baseMiddleware "github.com/thk-im/thk-im-base-server/middleware"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/logic"
 	userSdk "github.com/thk-im/thk-im-user-server/pkg/sdk"
+	"net/http"
 )
 
 func sendMessage(appCtx *app.Context) gin.HandlerFunc {
@@ -30,7 +32,7 @@ func sendMessage(appCtx *app.Context) gin.HandlerFunc {
 
 		if rsp, err := l.SendMessage(req, claims); err != nil {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("sendMessage %v %s", req, err.Error())
-			baseDto.ResponseInternalServerError(ctx, err)
+			responseSendMessageError(ctx, err)
 		} else {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("sendMessage %d %d", req.FUid, req.SId)
 			baseDto.ResponseSuccess(ctx, rsp)
@@ -38,6 +40,23 @@ func sendMessage(appCtx *app.Context) gin.HandlerFunc {
 	}
 }
 
+// responseSendMessageError 发送被限流时返回429并带上Retry-After, 其他错误按原有方式返回
+func responseSendMessageError(ctx *gin.Context, err error) {
+	retryAfter := logic.RetryAfterSeconds(err)
+	if retryAfter == "" {
+		baseDto.ResponseInternalServerError(ctx, err)
+		return
+	}
+	rsp := &baseDto.ErrorResponse{
+		Code:    errorx.ErrMessageSendTooFrequent.Code,
+		Message: errorx.ErrMessageSendTooFrequent.Message,
+	}
+	claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+	rsp.Localize(claims.GetLanguage())
+	ctx.Header("Retry-After", retryAfter)
+	ctx.JSON(http.StatusTooManyRequests, rsp)
+}
+
 func getUserLatestMessages(appCtx *app.Context) gin.HandlerFunc {
 	l := logic.NewMessageLogic(appCtx)
 	return func(ctx *gin.Context) {
@@ -94,3 +113,190 @@ func deleteUserMessage(appCtx *app.Context) gin.HandlerFunc {
 		}
 	}
 }
+
+func getMessagesBySeq(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetMessageBySeqReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessagesBySeq %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		if req.FromSeq < 0 || req.ToSeq <= req.FromSeq {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessagesBySeq %d, %d", req.FromSeq, req.ToSeq)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessagesBySeq %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.GetMessagesBySeq(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessagesBySeq %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getMessagesBySeq: %d, %d, %d, %d", req.UId, req.SId, req.FromSeq, req.ToSeq)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func queryScheduledMessages(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryScheduledMessageReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryScheduledMessages %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryScheduledMessages %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.QueryScheduledMessages(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryScheduledMessages %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryScheduledMessages %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func cancelScheduledMessage(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.CancelScheduledMessageReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("cancelScheduledMessage %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("cancelScheduledMessage %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if err := l.CancelScheduledMessage(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("cancelScheduledMessage %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("cancelScheduledMessage %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func getThreadReplies(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetThreadRepliesReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getThreadReplies %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getThreadReplies %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.GetThreadReplies(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getThreadReplies %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getThreadReplies %d, %d, %d", req.UId, req.SId, req.RootMsgId)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func searchMessages(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.SearchMessageReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("searchMessages %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("searchMessages %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.SearchMessages(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("searchMessages %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("searchMessages %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func queryUserMentions(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryUserMentionsReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserMentions %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserMentions %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.QueryUserMentions(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserMentions %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryUserMentions %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func queryUserThreads(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryUserThreadsReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserThreads %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserThreads %d, %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.QueryUserThreads(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserThreads %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryUserThreads %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
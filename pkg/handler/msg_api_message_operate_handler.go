@@ -9,6 +9,7 @@ import (
 	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/logic"
 	userSdk "github.com/thk-im/thk-im-user-server/pkg/sdk"
+	"strconv"
 )
 
 func ackUserMessages(appCtx *app.Context) gin.HandlerFunc {
@@ -68,6 +69,32 @@ func readUserMessage(appCtx *app.Context) gin.HandlerFunc {
 	}
 }
 
+func getMessageReadUsers(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetMessageReadUsersReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageReadUsers %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageReadUsers %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.GetMessageReadUsers(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageReadUsers %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getMessageReadUsers %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
 func revokeUserMessage(appCtx *app.Context) gin.HandlerFunc {
 	l := logic.NewMessageLogic(appCtx)
 	return func(ctx *gin.Context) {
@@ -120,6 +147,39 @@ func reeditUserMessage(appCtx *app.Context) gin.HandlerFunc {
 	}
 }
 
+func getMessageEditHistory(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetMessageEditHistoryReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageEditHistory %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		msgId, errMsgId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errMsgId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageEditHistory %v", errMsgId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.MsgId = msgId
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageEditHistory %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.GetMessageEditHistory(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageEditHistory %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getMessageEditHistory %d, %d, %d", req.UId, req.SId, req.MsgId)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
 func forwardUserMessage(appCtx *app.Context) gin.HandlerFunc {
 	l := logic.NewMessageLogic(appCtx)
 	return func(ctx *gin.Context) {
@@ -159,3 +219,218 @@ func forwardUserMessage(appCtx *app.Context) gin.HandlerFunc {
 		}
 	}
 }
+
+func forwardMergedMessage(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.ForwardMergedMessageReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("forwardMergedMessage %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.FUid {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("forwardMergedMessage %d %d", requestUid, req.FUid)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.ForwardMergedMessages(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("forwardMergedMessage %v %s", req, err.Error())
+			responseSendMessageError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("forwardMergedMessage %d, %d, %v", req.SId, req.ForwardSId, req.MsgIds)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func getMessageSnapshot(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetMessageSnapshotReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageSnapshot %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		id, errId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageSnapshot %v", errId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.Id = id
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageSnapshot %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.GetMessageSnapshot(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getMessageSnapshot %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getMessageSnapshot %d, %d, %d", req.UId, req.SId, req.Id)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func addMessageReaction(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.MessageReactionReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addMessageReaction %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addMessageReaction %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if err := l.AddMessageReaction(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addMessageReaction %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("addMessageReaction %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func deleteMessageReaction(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.MessageReactionReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteMessageReaction %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteMessageReaction %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if err := l.DelMessageReaction(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteMessageReaction %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("deleteMessageReaction %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func queryMessageReactions(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryMessageReactionReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReactions %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReactions %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.QueryMessageReactions(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReactions %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryMessageReactions %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func addFavorite(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.AddFavoriteReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addFavorite %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addFavorite %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.AddFavorite(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addFavorite %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("addFavorite %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func deleteFavorite(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.DelFavoriteReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteFavorite %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteFavorite %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if err := l.DelFavorite(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteFavorite %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("deleteFavorite %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func queryFavorites(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryFavoriteReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryFavorites %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryFavorites %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if resp, err := l.QueryFavorites(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryFavorites %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryFavorites %v", req)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
@@ -101,6 +101,53 @@ func updateSessionType(appCtx *app.Context) gin.HandlerFunc {
 	}
 }
 
+func promoteSuperGroup(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewSessionLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		sessionId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		if err = l.PromoteSuperGroup(sessionId, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup %d %s", sessionId, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("promoteSuperGroup %d", sessionId)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func updateSessionRetention(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewSessionLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.UpdateSessionRetentionReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateSessionRetention %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		sessionId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateSessionRetention %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.Id = sessionId
+		if err = l.UpdateSessionRetention(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateSessionRetention %v %s", req, err.Error())
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("updateSessionRetention %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
 func updateSession(appCtx *app.Context) gin.HandlerFunc {
 	l := logic.NewSessionLogic(appCtx)
 	return func(ctx *gin.Context) {
@@ -293,6 +340,33 @@ func getLatestUserSessions(appCtx *app.Context) gin.HandlerFunc {
 	}
 }
 
+func getUserSessionUnreadTotal(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewSessionLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.GetUserSessionUnreadTotalReq
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getUserSessionUnreadTotal %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getUserSessionUnreadTotal %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+
+		if resp, err := l.GetUserSessionUnreadTotal(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getUserSessionUnreadTotal %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getUserSessionUnreadTotal %v %v", req, resp)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
 func queryUserSession(appCtx *app.Context) gin.HandlerFunc {
 	l := logic.NewSessionLogic(appCtx)
 	return func(ctx *gin.Context) {
@@ -353,7 +427,7 @@ func queryUserSessionBySId(appCtx *app.Context) gin.HandlerFunc {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryUserSessionBySId %d %d %v", iUid, iSid, err)
 			baseDto.ResponseInternalServerError(ctx, err)
 		} else {
-			appCtx.Logger().WithFields(logrus.Fields(claims)).Info("queryUserSessionBySId %d %d %v", iUid, iSid, res)
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryUserSessionBySId %d %d %v", iUid, iSid, res)
 			baseDto.ResponseSuccess(ctx, res)
 		}
 	}
@@ -393,6 +467,9 @@ func getSessionMessages(appCtx *app.Context) gin.HandlerFunc {
 			return
 		}
 		req.SId = iSessionId
+		if requestUid > 0 {
+			req.UId = requestUid
+		}
 		if res, err := l.GetSessionMessages(req, claims); err != nil {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionMessages %v %s", req, err)
 			baseDto.ResponseInternalServerError(ctx, err)
@@ -493,3 +570,303 @@ func deleteUserSession(appCtx *app.Context) gin.HandlerFunc {
 		}
 	}
 }
+
+func getDraft(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var (
+			uid = ctx.Param("uid")
+			sid = ctx.Param("sid")
+		)
+
+		iUid, errUId := strconv.ParseInt(uid, 10, 64)
+		if errUId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getDraft %s", errUId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+
+		iSid, errSId := strconv.ParseInt(sid, 10, 64)
+		if errSId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getDraft %s", errSId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != iUid {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getDraft %d %d", requestUid, iUid)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+
+		if res, err := l.GetDraft(iUid, iSid, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getDraft %d %d %v", iUid, iSid, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getDraft %d %d", iUid, iSid)
+			baseDto.ResponseSuccess(ctx, res)
+		}
+	}
+}
+
+func updateDraft(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.UpdateDraftReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateDraft %s", err.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		var (
+			uid = ctx.Param("uid")
+			sid = ctx.Param("sid")
+		)
+
+		iUid, errUId := strconv.ParseInt(uid, 10, 64)
+		if errUId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateDraft %s", errUId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+
+		iSid, errSId := strconv.ParseInt(sid, 10, 64)
+		if errSId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateDraft %s", errSId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != iUid {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateDraft %d %d", requestUid, iUid)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		req.UId = iUid
+		req.SId = iSid
+
+		if res, err := l.UpdateDraft(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateDraft %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("updateDraft %d %d", iUid, iSid)
+			baseDto.ResponseSuccess(ctx, res)
+		}
+	}
+}
+
+func deleteDraft(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var (
+			uid = ctx.Param("uid")
+			sid = ctx.Param("sid")
+		)
+
+		iUid, errUId := strconv.ParseInt(uid, 10, 64)
+		if errUId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteDraft %s", errUId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+
+		iSid, errSId := strconv.ParseInt(sid, 10, 64)
+		if errSId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteDraft %s", errSId.Error())
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != iUid {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteDraft %d %d", requestUid, iUid)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+
+		if err := l.DeleteDraft(iUid, iSid, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("deleteDraft %d %d %v", iUid, iSid, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("deleteDraft %d %d", iUid, iSid)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func pinSessionMessage(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		sessionId, errSessionId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errSessionId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pinSessionMessage %v", errSessionId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		var req dto.SessionPinReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pinSessionMessage %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.SId = sessionId
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pinSessionMessage %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if requestUid > 0 { // 检查角色权限
+			if hasPermission := checkRolePermission(appCtx, requestUid, sessionId, model.SessionAdmin, claims); !hasPermission {
+				appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pinSessionMessage %d %d", requestUid, sessionId)
+				baseDto.ResponseForbidden(ctx)
+				return
+			}
+		}
+		if err := l.PinSessionMessage(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pinSessionMessage %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("pinSessionMessage %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func unpinSessionMessage(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		sessionId, errSessionId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errSessionId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unpinSessionMessage %v", errSessionId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		var req dto.SessionPinReq
+		if err := ctx.BindJSON(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unpinSessionMessage %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.SId = sessionId
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != req.UId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unpinSessionMessage %d %d", requestUid, req.UId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if requestUid > 0 { // 检查角色权限
+			if hasPermission := checkRolePermission(appCtx, requestUid, sessionId, model.SessionAdmin, claims); !hasPermission {
+				appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unpinSessionMessage %d %d", requestUid, sessionId)
+				baseDto.ResponseForbidden(ctx)
+				return
+			}
+		}
+		if err := l.UnpinSessionMessage(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unpinSessionMessage %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("unpinSessionMessage %v", req)
+			baseDto.ResponseSuccess(ctx, nil)
+		}
+	}
+}
+
+func getSessionPins(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		sessionId, errSessionId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errSessionId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionPins %v", errSessionId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		uId, errUId := strconv.ParseInt(ctx.Query("u_id"), 10, 64)
+		if errUId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionPins %v", errUId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		requestUid := ctx.GetInt64(userSdk.UidKey)
+		if requestUid > 0 && requestUid != uId {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionPins %d %d", requestUid, uId)
+			baseDto.ResponseForbidden(ctx)
+			return
+		}
+		if requestUid > 0 { // 检查角色权限
+			if hasPermission := checkReadPermission(appCtx, requestUid, sessionId, claims); !hasPermission {
+				appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionPins %d %d", requestUid, sessionId)
+				baseDto.ResponseForbidden(ctx)
+				return
+			}
+		}
+		if resp, err := l.QuerySessionPins(sessionId, uId, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("getSessionPins %d %v", sessionId, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("getSessionPins %d %d", sessionId, uId)
+			baseDto.ResponseSuccess(ctx, resp)
+		}
+	}
+}
+
+func queryRevokeAudits(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryRevokeAuditsReq
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryRevokeAudits %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		sessionId, errSessionId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errSessionId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryRevokeAudits %v", errSessionId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.SId = sessionId
+
+		if rsp, err := l.QueryRevokeAudits(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryRevokeAudits %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryRevokeAudits %v", req)
+			baseDto.ResponseSuccess(ctx, rsp)
+		}
+	}
+}
+
+func queryMessageReviews(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryMessageReviewsReq
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReviews %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		sessionId, errSessionId := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if errSessionId != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReviews %v", errSessionId)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+		req.SId = sessionId
+
+		if rsp, err := l.QueryMessageReviews(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessageReviews %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryMessageReviews %v", req)
+			baseDto.ResponseSuccess(ctx, rsp)
+		}
+	}
+}
@@ -267,6 +267,20 @@ func checkReadPermission(appCtx *app.Context, uId, sessionId int64, claims baseD
 	return true
 }
 
+// checkRolePermission 检查用户是否为会话成员且角色不低于role
+func checkRolePermission(appCtx *app.Context, uId, sessionId int64, role int, claims baseDto.ThkClaims) bool {
+	sessionUser, err := appCtx.SessionUserModel().FindSessionUser(sessionId, uId)
+	if err != nil {
+		appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("checkRolePermission %d %d %d %v", uId, sessionId, role, err)
+		return false
+	}
+	if sessionUser.UserId <= 0 {
+		appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkRolePermission %d", sessionUser.UserId)
+		return false
+	}
+	return sessionUser.Role >= role
+}
+
 func checkPermission(appCtx *app.Context, uId, sessionId int64, oprUIds []int64, claims baseDto.ThkClaims) bool {
 	sessionUser, err := appCtx.SessionUserModel().FindSessionUser(sessionId, uId)
 	if err != nil {
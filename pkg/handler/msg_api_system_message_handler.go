@@ -51,7 +51,7 @@ func sendSessionMessage(appCtx *app.Context) gin.HandlerFunc {
 
 		if rsp, err := l.SendMessage(req, claims); err != nil {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("sendSystemMessage %v %v", req, err)
-			baseDto.ResponseInternalServerError(ctx, err)
+			responseSendMessageError(ctx, err)
 		} else {
 			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("sendSystemMessage %v %v", req, rsp)
 			baseDto.ResponseSuccess(ctx, rsp)
@@ -79,3 +79,45 @@ func sendSystemMessage(appCtx *app.Context) gin.HandlerFunc {
 		}
 	}
 }
+
+func queryRateLimitedCounts(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryRateLimitedReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryRateLimitedCounts %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+
+		if rsp, err := l.QueryRateLimitedCounts(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryRateLimitedCounts %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryRateLimitedCounts %v", req)
+			baseDto.ResponseSuccess(ctx, rsp)
+		}
+	}
+}
+
+func queryMessagePurgedCounts(appCtx *app.Context) gin.HandlerFunc {
+	l := logic.NewMessageLogic(appCtx)
+	return func(ctx *gin.Context) {
+		claims := ctx.MustGet(baseMiddleware.ClaimsKey).(baseDto.ThkClaims)
+		var req dto.QueryMessagePurgedReq
+		if err := ctx.BindQuery(&req); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessagePurgedCounts %v", err)
+			baseDto.ResponseBadRequest(ctx)
+			return
+		}
+
+		if rsp, err := l.QueryPurgedCounts(req, claims); err != nil {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("queryMessagePurgedCounts %v %v", req, err)
+			baseDto.ResponseInternalServerError(ctx, err)
+		} else {
+			appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("queryMessagePurgedCounts %v", req)
+			baseDto.ResponseSuccess(ctx, rsp)
+		}
+	}
+}
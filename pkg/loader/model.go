@@ -28,6 +28,40 @@ func LoadModels(modeConfigs []conf.Model, database *gorm.DB, logger *logrus.Entr
 			m = model.NewObjectModel(database, logger, snowflakeNode, ms.Shards)
 		} else if ms.Name == "session_object" {
 			m = model.NewSessionObjectModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_outbox" {
+			m = model.NewMessageOutboxModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "scheduled_message" {
+			m = model.NewScheduledMessageModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_reaction" {
+			m = model.NewMessageReactionModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_thread" {
+			m = model.NewMessageThreadModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "user_thread" {
+			m = model.NewUserThreadModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "session_pin" {
+			m = model.NewSessionPinModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_edit_history" {
+			m = model.NewMessageEditHistoryModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_revoke_audit" {
+			m = model.NewMessageRevokeAuditModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_read" {
+			m = model.NewMessageReadModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "user_mention" {
+			m = model.NewUserMentionModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "session_mention" {
+			m = model.NewSessionMentionModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_search" {
+			m = model.NewMysqlMessageSearchIndex(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_review" {
+			m = model.NewMessageReviewModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "message_snapshot" {
+			m = model.NewMessageSnapshotModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "user_favorite" {
+			m = model.NewUserFavoriteModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "user_favorite_object" {
+			m = model.NewUserFavoriteObjectModel(database, logger, snowflakeNode, ms.Shards)
+		} else if ms.Name == "user_device_cursor" {
+			m = model.NewUserDeviceCursorModel(database, logger, snowflakeNode, ms.Shards)
 		}
 		modelMap[ms.Name] = m
 	}
@@ -4,9 +4,29 @@ const (
 	sessionCreateLockKey     = "%s:se:c:%d:%d"
 	sessionUpdateLockKey     = "%s:se:m:%d"
 	userSessionUpdateLockKey = "%s:u:se:m:%d:%d"
+	sessionMsgSeqKey         = "%s:se:seq:%d"
+	sessionPinLockKey        = "%s:se:pin:%d"
+	// 群聊正在发送的消息和群升级标记使用相同的hash tag, 保证在集群模式下可以在同一个脚本内检查
+	sessionSendingKey   = "%s:se:{%d}:sending"
+	sessionPromotingKey = "%s:se:{%d}:promoting"
+
+	messageOutboxRelayLockKey   = "%s:msg:outbox:%d"
+	scheduledMessageLockKey     = "%s:msg:scheduled:%d"
+	userMessageExpireLockKey    = "%s:u:msg:expire:%d"
+	sessionMessageExpireLockKey = "%s:se:msg:expire:%d"
+	userMessagePurgeLockKey     = "%s:u:msg:purge:%d"
+	sessionMessagePurgeLockKey  = "%s:se:msg:purge:%d"
+	messagePurgedCountKey       = "%s:msg:purged:%s"
+	messagePurgeResumeKey       = "%s:msg:purge:resume:%s:%d"
 
 	userOnlineKey = "%s:olu:%s:%d"
 
+	// 会话和发送人在会话内的令牌桶使用相同的hash tag, 保证在集群模式下落在同一个slot, 可以在同一个脚本内扣减
+	userSendRateKey         = "%s:rl:u:%d:%d"
+	sessionSendRateKey      = "%s:rl:{se:%d}"
+	userSessionSendRateKey  = "%s:rl:{se:%d}:u:%d"
+	sendRateLimitedCountKey = "%s:rl:cnt:%s:%s"
+
 	PlatformAndroid = "Android"
 	PlatformIOS     = "IOS"
 	PlatformWeb     = "Web"
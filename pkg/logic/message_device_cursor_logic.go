@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+const (
+	deviceCursorAdvanceMaxCount = 1000
+)
+
+// getDeviceUserMessages 按当前设备在每个会话内的游标同步消息, 保证未ack的消息会重新下发;
+// 请求不带平台和设备信息时直接按客户端传入的时间同步
+func (l *MessageLogic) getDeviceUserMessages(uId, cTime, msgId int64, offset, count int, claims baseDto.ThkClaims) ([]*model.UserMessage, error) {
+	platform, device := claims.GetPlatform(), claims.GetDevice()
+	if platform == "" && device == "" {
+		return l.appCtx.UserMessageModel().GetUserMessages(uId, cTime, msgId, offset, count)
+	}
+	cursorTableName := l.appCtx.UserDeviceCursorModel().GenUserDeviceCursorTableName(uId)
+	return l.appCtx.UserMessageModel().GetDeviceUserMessages(uId, cursorTableName, platform, device, cTime, msgId, offset, count)
+}
+
+// advanceDeviceCursor 把当前设备在会话内的游标推进到连续ack的最后一条消息, 中间有未ack的消息时停在它之前, 不影响用户的其他设备
+func (l *MessageLogic) advanceDeviceCursor(uId, sId int64, userMessages []*model.UserMessage, claims baseDto.ThkClaims) error {
+	platform, device := claims.GetPlatform(), claims.GetDevice()
+	if (platform == "" && device == "") || len(userMessages) == 0 {
+		return nil
+	}
+	acked := make(map[int64]bool, len(userMessages))
+	var maxAckedMsgId int64
+	for _, userMessage := range userMessages {
+		acked[userMessage.MsgId] = true
+		if userMessage.MsgId > maxAckedMsgId {
+			maxAckedMsgId = userMessage.MsgId
+		}
+	}
+	cursor, err := l.appCtx.UserDeviceCursorModel().FindCursor(uId, platform, device, sId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceDeviceCursor %d %d %s %s, %v", uId, sId, platform, device, err)
+		return err
+	}
+	if cursor.Id == 0 {
+		// 首次ack, 游标之前的消息已经按时间同步过, 从本次ack的第一条消息开始计算
+		cursor.CursorMsgId = minAckedMsgId(userMessages) - 1
+	}
+	if maxAckedMsgId <= cursor.CursorMsgId {
+		return nil
+	}
+	pendingMsgIds, err := l.appCtx.UserMessageModel().FindUserMessageIdsAfter(uId, sId, cursor.CursorMsgId, maxAckedMsgId, deviceCursorAdvanceMaxCount)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceDeviceCursor %d %d %s %s, %v", uId, sId, platform, device, err)
+		return err
+	}
+	cursorMsgId := advanceCursorMsgId(cursor.CursorMsgId, pendingMsgIds, acked)
+	if cursorMsgId <= cursor.CursorMsgId {
+		return nil
+	}
+	if err = l.appCtx.UserDeviceCursorModel().AdvanceCursor(uId, platform, device, sId, cursorMsgId); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceDeviceCursor %d %d %s %s, %v", uId, sId, platform, device, err)
+	}
+	return err
+}
+
+func minAckedMsgId(userMessages []*model.UserMessage) int64 {
+	minMsgId := userMessages[0].MsgId
+	for _, userMessage := range userMessages {
+		if userMessage.MsgId < minMsgId {
+			minMsgId = userMessage.MsgId
+		}
+	}
+	return minMsgId
+}
+
+// advanceCursorMsgId 按消息id升序依次推进游标, 遇到第一条未ack的消息停止
+func advanceCursorMsgId(cursorMsgId int64, pendingMsgIds []int64, acked map[int64]bool) int64 {
+	for _, msgId := range pendingMsgIds {
+		if msgId <= cursorMsgId {
+			continue
+		}
+		if !acked[msgId] {
+			break
+		}
+		cursorMsgId = msgId
+	}
+	return cursorMsgId
+}
@@ -0,0 +1,54 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+func TestMinAckedMsgId(t *testing.T) {
+	cases := []struct {
+		name   string
+		msgIds []int64
+		want   int64
+	}{
+		{"single", []int64{5}, 5},
+		{"ascending", []int64{3, 5, 7}, 3},
+		{"unordered", []int64{7, 2, 5}, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			userMessages := make([]*model.UserMessage, 0, len(c.msgIds))
+			for _, msgId := range c.msgIds {
+				userMessages = append(userMessages, &model.UserMessage{MsgId: msgId})
+			}
+			if got := minAckedMsgId(userMessages); got != c.want {
+				t.Errorf("minAckedMsgId(%v) = %d, want %d", c.msgIds, got, c.want)
+			}
+		})
+	}
+}
+
+func TestAdvanceCursorMsgId(t *testing.T) {
+	cases := []struct {
+		name          string
+		cursorMsgId   int64
+		pendingMsgIds []int64
+		acked         map[int64]bool
+		want          int64
+	}{
+		{"no pending", 10, nil, nil, 10},
+		{"all acked", 10, []int64{11, 12, 13}, map[int64]bool{11: true, 12: true, 13: true}, 13},
+		{"stop at first unacked", 10, []int64{11, 12, 13}, map[int64]bool{11: true, 13: true}, 11},
+		{"first unacked", 10, []int64{11, 12}, map[int64]bool{12: true}, 10},
+		{"skip behind cursor", 12, []int64{10, 11, 13}, map[int64]bool{13: true}, 13},
+		{"nothing acked", 10, []int64{11}, map[int64]bool{}, 10},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := advanceCursorMsgId(c.cursorMsgId, c.pendingMsgIds, c.acked); got != c.want {
+				t.Errorf("advanceCursorMsgId() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
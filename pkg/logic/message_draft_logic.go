@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	baseErrorx "github.com/thk-im/thk-im-base-server/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	maxDraftLength = 5000
+)
+
+func convDraft(userSession *model.UserSession) *dto.Draft {
+	if userSession.Draft == nil || *userSession.Draft == "" {
+		return nil
+	}
+	draft := &dto.Draft{Content: *userSession.Draft, MTime: userSession.DraftTime}
+	if userSession.DraftRMsgId > 0 {
+		rMsgId := userSession.DraftRMsgId
+		draft.RMsgId = &rMsgId
+	}
+	return draft
+}
+
+func (l *MessageLogic) GetDraft(uId, sId int64, claims baseDto.ThkClaims) (*dto.Draft, error) {
+	userSession, err := l.findMemberUserSession(uId, sId, claims)
+	if err != nil {
+		return nil, err
+	}
+	draft := convDraft(userSession)
+	if draft == nil {
+		draft = &dto.Draft{MTime: userSession.DraftTime}
+	}
+	return draft, nil
+}
+
+func (l *MessageLogic) UpdateDraft(req dto.UpdateDraftReq, claims baseDto.ThkClaims) (*dto.Draft, error) {
+	if len([]rune(req.Content)) > maxDraftLength {
+		return nil, baseErrorx.ErrParamsError
+	}
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	rMsgId := int64(0)
+	if req.RMsgId != nil {
+		rMsgId = *req.RMsgId
+	}
+	now := time.Now().UnixMilli()
+	if _, err := l.appCtx.UserSessionModel().UpdateDraft(req.UId, req.SId, &req.Content, rMsgId, now); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("UpdateDraft %v, %v", req, err)
+		return nil, err
+	}
+	l.pubDraftSyncEvent(req.UId, req.SId, now, claims)
+	return &dto.Draft{Content: req.Content, RMsgId: req.RMsgId, MTime: now}, nil
+}
+
+func (l *MessageLogic) DeleteDraft(uId, sId int64, claims baseDto.ThkClaims) error {
+	userSession, err := l.findMemberUserSession(uId, sId, claims)
+	if err != nil {
+		return err
+	}
+	if userSession.Draft == nil {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	if _, err = l.appCtx.UserSessionModel().UpdateDraft(uId, sId, nil, 0, now); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DeleteDraft %d %d, %v", uId, sId, err)
+		return err
+	}
+	l.pubDraftSyncEvent(uId, sId, now, claims)
+	return nil
+}
+
+// pubDraftSyncEvent 通知用户的其他在线端草稿已变更
+func (l *MessageLogic) pubDraftSyncEvent(uId, sId, mTime int64, claims baseDto.ThkClaims) {
+	body, err := json.Marshal(&dto.DraftSyncBody{MTime: mTime, Platform: claims.GetPlatform(), Device: claims.GetDevice()})
+	if err == nil {
+		err = l.pubOperationMessageEvent(sId, uId, model.MsgTypeDraft, string(body), 0, []int64{uId}, claims)
+	}
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pubDraftSyncEvent %d %d, %v", uId, sId, err)
+	}
+}
@@ -0,0 +1,173 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	defaultBurnAfterReadTtlMs = 10 * 1000 // 阅后即焚未指定ttl时, 已读后10s销毁
+	expiredMessageBatchCount  = 200
+)
+
+// genMessageExpire 返回消息的存活时长, 是否阅后即焚, 过期时间; 阅后即焚消息已读后才开始倒计时
+func (l *MessageLogic) genMessageExpire(req dto.SendMessageReq) (int64, int8, int64) {
+	if req.BurnAfterRead {
+		ttlMs := req.TtlMs
+		if ttlMs <= 0 {
+			ttlMs = defaultBurnAfterReadTtlMs
+		}
+		return ttlMs, 1, 0
+	}
+	if req.TtlMs > 0 {
+		return req.TtlMs, 0, time.Now().UnixMilli() + req.TtlMs
+	}
+	return 0, 0, 0
+}
+
+// isExpiringMessage 阅后即焚或设置了存活时长的消息会被销毁, 不能被合并转发或收藏等永久保存
+func isExpiringMessage(message *dto.Message) bool {
+	return message.BurnAfterRead || message.TtlMs > 0
+}
+
+// startBurnAfterReadCountdown 读者的消息副本和发件人的消息副本同时开始倒计时,
+// 读者副本由消息存储服务写入, 是否阅后即焚以发件人副本为准
+func (l *MessageLogic) startBurnAfterReadCountdown(uId, sId int64, userMessages []*model.UserMessage, claims baseDto.ThkClaims) {
+	senderMsgIds := make(map[int64][]int64)
+	for _, userMessage := range userMessages {
+		if userMessage.ExpireTime > 0 || userMessage.FromUserId == uId || userMessage.FromUserId <= 0 {
+			continue
+		}
+		senderMsgIds[userMessage.FromUserId] = append(senderMsgIds[userMessage.FromUserId], userMessage.MsgId)
+	}
+	now := time.Now().UnixMilli()
+	for fUid, msgIds := range senderMsgIds {
+		senderMessages, err := l.appCtx.UserMessageModel().FindUserMessages(fUid, sId, msgIds)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("startBurnAfterReadCountdown %d %d %v %v", fUid, sId, msgIds, err)
+			continue
+		}
+		burnMsgIds := make([]int64, 0)
+		for _, senderMessage := range senderMessages {
+			if senderMessage.BurnAfterRead == 0 || senderMessage.Deleted == 1 {
+				continue
+			}
+			burnMsgIds = append(burnMsgIds, senderMessage.MsgId)
+			if err = l.appCtx.UserMessageModel().StartReaderBurnCountdown(uId, sId, senderMessage.MsgId, senderMessage.TtlMs, now); err != nil {
+				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("startBurnAfterReadCountdown %d %d %d %v", uId, sId, senderMessage.MsgId, err)
+			}
+		}
+		if len(burnMsgIds) == 0 {
+			continue
+		}
+		if err = l.appCtx.UserMessageModel().StartBurnAfterReadCountdown(fUid, sId, burnMsgIds, now); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("startBurnAfterReadCountdown %d %d %v %v", fUid, sId, burnMsgIds, err)
+		}
+	}
+}
+
+// SweepExpiredMessages 删除所有分表中已过期的消息, 并通知消息持有人删除
+func (l *MessageLogic) SweepExpiredMessages() {
+	for shard := int64(0); shard < l.appCtx.UserMessageModel().Shards(); shard++ {
+		l.sweepExpiredUserMessages(shard)
+	}
+	for shard := int64(0); shard < l.appCtx.SessionMessageModel().Shards(); shard++ {
+		l.sweepExpiredSessionMessages(shard)
+	}
+}
+
+func (l *MessageLogic) sweepExpiredUserMessages(shard int64) {
+	claims := baseDto.ThkClaims{}
+	lockKey := fmt.Sprintf(userMessageExpireLockKey, l.appCtx.Config().Name, shard)
+	locker := l.appCtx.NewLocker(lockKey, 0, 30*1000)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+	userMessages, err := l.appCtx.UserMessageModel().FindExpiredUserMessages(shard, time.Now().UnixMilli(), expiredMessageBatchCount)
+	if err != nil {
+		l.appCtx.Logger().Errorf("sweepExpiredUserMessages %d %v", shard, err)
+		return
+	}
+	for _, userMessage := range userMessages {
+		affected, errExpire := l.appCtx.UserMessageModel().ExpireUserMessage(userMessage.UserId, userMessage.SessionId, userMessage.MsgId)
+		if errExpire != nil || affected == 0 {
+			continue
+		}
+		uIds := []int64{userMessage.UserId}
+		if userMessage.UserId == userMessage.FromUserId && userMessage.BurnAfterRead == 0 {
+			uIds = l.expireReceiverMessages(userMessage, claims)
+		}
+		l.pubMessageExpiredEvent(userMessage.SessionId, userMessage.MsgId, uIds, claims)
+	}
+}
+
+// expireReceiverMessages 发件人副本到期后删除所有成员的副本, 接收人副本由消息存储服务写入, 不能保证带有过期时间
+func (l *MessageLogic) expireReceiverMessages(senderMessage *model.UserMessage, claims baseDto.ThkClaims) []int64 {
+	uIds := []int64{senderMessage.UserId}
+	sessionUsers := l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(senderMessage.SessionId, 0, nil)
+	for _, sessionUser := range sessionUsers {
+		if sessionUser.UserId == senderMessage.UserId {
+			continue
+		}
+		if _, err := l.appCtx.UserMessageModel().ExpireUserMessage(sessionUser.UserId, senderMessage.SessionId, senderMessage.MsgId); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("expireReceiverMessages %d %d %d %v",
+				sessionUser.UserId, senderMessage.SessionId, senderMessage.MsgId, err)
+			continue
+		}
+		uIds = append(uIds, sessionUser.UserId)
+	}
+	return uIds
+}
+
+func (l *MessageLogic) sweepExpiredSessionMessages(shard int64) {
+	claims := baseDto.ThkClaims{}
+	lockKey := fmt.Sprintf(sessionMessageExpireLockKey, l.appCtx.Config().Name, shard)
+	locker := l.appCtx.NewLocker(lockKey, 0, 30*1000)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+	sessionMessages, err := l.appCtx.SessionMessageModel().FindExpiredSessionMessages(shard, time.Now().UnixMilli(), expiredMessageBatchCount)
+	if err != nil {
+		l.appCtx.Logger().Errorf("sweepExpiredSessionMessages %d %v", shard, err)
+		return
+	}
+	for _, sessionMessage := range sessionMessages {
+		affected, errExpire := l.appCtx.SessionMessageModel().ExpireSessionMessage(sessionMessage.SessionId, sessionMessage.MsgId)
+		if errExpire != nil || affected == 0 {
+			continue
+		}
+		l.unindexMessages(sessionMessage.SessionId, []int64{sessionMessage.MsgId}, 0, 0, claims)
+		sessionUsers := l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(sessionMessage.SessionId, 0, nil)
+		uIds := make([]int64, 0)
+		for _, sessionUser := range sessionUsers {
+			uIds = append(uIds, sessionUser.UserId)
+		}
+		l.pubMessageExpiredEvent(sessionMessage.SessionId, sessionMessage.MsgId, uIds, claims)
+	}
+}
+
+// pubMessageExpiredEvent 在线推送消息销毁信令, 不做持久化和离线推送
+func (l *MessageLogic) pubMessageExpiredEvent(sessionId, msgId int64, uIds []int64, claims baseDto.ThkClaims) {
+	if len(uIds) == 0 {
+		return
+	}
+	if err := l.pubOperationMessageEvent(sessionId, 0, model.MsgTypeExpired, "", msgId, uIds, claims); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pubMessageExpiredEvent %d %d %v", sessionId, msgId, err)
+	}
+}
@@ -0,0 +1,113 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	maxFavoriteQueryCount = 100
+)
+
+// AddFavorite 收藏消息, 保存消息快照并将消息引用的对象授权给收藏人, 重复收藏返回已有收藏
+func (l *MessageLogic) AddFavorite(req dto.AddFavoriteReq, claims baseDto.ThkClaims) (*dto.Favorite, error) {
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	messages := l.findMessagesByIds(req.UId, req.SId, []int64{req.MsgId}, claims)
+	if len(messages) == 0 || messages[0].Type < 0 || messages[0].Type == model.MsgTypeRevoke {
+		return nil, errorx.ErrSessionMessageInvalid
+	}
+	message := messages[0]
+	if isExpiringMessage(message) {
+		return nil, errorx.ErrMessageNotPersistent
+	}
+	favorite := &model.UserFavorite{
+		Id:         l.appCtx.UserFavoriteModel().NewFavoriteId(),
+		UserId:     req.UId,
+		SessionId:  req.SId,
+		MsgId:      message.MsgId,
+		MsgType:    message.Type,
+		FromUserId: message.FUid,
+		MsgContent: message.Body,
+		ExtData:    message.ExtData,
+		MsgTime:    message.CTime,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	affected, err := l.appCtx.UserFavoriteModel().AddFavorite(favorite)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AddFavorite %v, %v", req, err)
+		return nil, err
+	}
+	if affected == 0 {
+		favorite, err = l.appCtx.UserFavoriteModel().FindFavorite(req.UId, req.SId, req.MsgId)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AddFavorite FindFavorite %v, %v", req, err)
+			return nil, err
+		}
+		return l.convFavorite(favorite), nil
+	}
+	objectIds, err := l.appCtx.SessionObjectModel().FindObjectIds(req.SId, message.FUid, message.CId)
+	if err == nil {
+		err = l.appCtx.UserFavoriteObjectModel().AddObjects(req.UId, favorite.Id, objectIds)
+	}
+	if err != nil {
+		// 对象授权失败时回滚收藏, 避免收藏了打不开的媒体消息
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AddFavorite objects %v, %v", req, err)
+		if _, errDel := l.appCtx.UserFavoriteModel().DelFavorite(req.UId, favorite.Id); errDel != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AddFavorite DelFavorite %v, %v", req, errDel)
+		}
+		return nil, err
+	}
+	return l.convFavorite(favorite), nil
+}
+
+func (l *MessageLogic) DelFavorite(req dto.DelFavoriteReq, claims baseDto.ThkClaims) error {
+	if _, err := l.appCtx.UserFavoriteModel().DelFavorite(req.UId, req.Id); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DelFavorite %v, %v", req, err)
+		return err
+	}
+	if err := l.appCtx.UserFavoriteObjectModel().DelObjects(req.UId, req.Id); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DelFavorite objects %v, %v", req, err)
+		return err
+	}
+	return nil
+}
+
+// QueryFavorites 按收藏时间倒序查询收藏, 不要求用户仍在消息来源会话中
+func (l *MessageLogic) QueryFavorites(req dto.QueryFavoriteReq, claims baseDto.ThkClaims) (*dto.QueryFavoriteRes, error) {
+	if req.Count <= 0 || req.Count > maxFavoriteQueryCount {
+		req.Count = maxFavoriteQueryCount
+	}
+	if req.CTime <= 0 {
+		req.CTime = time.Now().UnixMilli() + 1
+	}
+	favorites, err := l.appCtx.UserFavoriteModel().FindFavorites(req.UId, req.SId, req.Type, req.CTime, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryFavorites %v, %v", req, err)
+		return nil, err
+	}
+	data := make([]*dto.Favorite, 0, len(favorites))
+	for _, favorite := range favorites {
+		data = append(data, l.convFavorite(favorite))
+	}
+	return &dto.QueryFavoriteRes{Data: data}, nil
+}
+
+func (l *MessageLogic) convFavorite(favorite *model.UserFavorite) *dto.Favorite {
+	return &dto.Favorite{
+		Id:      favorite.Id,
+		SId:     favorite.SessionId,
+		MsgId:   favorite.MsgId,
+		Type:    favorite.MsgType,
+		FUid:    favorite.FromUserId,
+		Body:    favorite.MsgContent,
+		ExtData: favorite.ExtData,
+		MsgTime: favorite.MsgTime,
+		CTime:   favorite.CreateTime,
+	}
+}
@@ -18,6 +18,19 @@ import (
 	"time"
 )
 
+const (
+	// 群聊发送登记的有效期, 超时未结束的发送不再阻塞群升级
+	groupSendGuardTimeout = 3 * 1000
+	groupSendGuardWait    = 1000
+	groupSendGuardRetry   = 50 * time.Millisecond
+
+	// 群没有在升级时登记一次正在进行的发送, 返回1; 正在升级返回0
+	enterGroupSendScript = `if redis.call("EXISTS", KEYS[2]) == 1 then return 0 end ` +
+		`redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2]) ` +
+		`redis.call("PEXPIRE", KEYS[1], ARGV[3]) ` +
+		`return 1`
+)
+
 type MessageLogic struct {
 	appCtx *app.Context
 }
@@ -30,39 +43,53 @@ func NewMessageLogic(appCtx *app.Context) MessageLogic {
 
 func (l *MessageLogic) convSessionMessage2Message(sessionMsg *model.SessionMessage) *dto.Message {
 	vo := dto.Message{
-		CId:     sessionMsg.ClientId,
-		FUid:    sessionMsg.FromUserId,
-		SId:     sessionMsg.SessionId,
-		MsgId:   sessionMsg.MsgId,
-		CTime:   sessionMsg.CreateTime,
-		Body:    sessionMsg.MsgContent,
-		AtUsers: sessionMsg.AtUsers,
-		ExtData: sessionMsg.ExtData,
-		Type:    sessionMsg.MsgType,
-		RMsgId:  sessionMsg.ReplyMsgId,
+		CId:           sessionMsg.ClientId,
+		FUid:          sessionMsg.FromUserId,
+		SId:           sessionMsg.SessionId,
+		MsgId:         sessionMsg.MsgId,
+		Seq:           sessionMsg.Seq,
+		CTime:         sessionMsg.CreateTime,
+		Body:          sessionMsg.MsgContent,
+		AtUsers:       sessionMsg.AtUsers,
+		ExtData:       sessionMsg.ExtData,
+		Type:          sessionMsg.MsgType,
+		RMsgId:        sessionMsg.ReplyMsgId,
+		TtlMs:         sessionMsg.TtlMs,
+		BurnAfterRead: sessionMsg.BurnAfterRead == 1,
+		ExpireTime:    sessionMsg.ExpireTime,
 	}
 	return &vo
 }
 
 func (l *MessageLogic) convUserMessage2Message(userMsg *model.UserMessage) *dto.Message {
 	msg := dto.Message{
-		CId:     userMsg.ClientId,
-		SId:     userMsg.SessionId,
-		Type:    userMsg.MsgType,
-		MsgId:   userMsg.MsgId,
-		FUid:    userMsg.FromUserId,
-		CTime:   userMsg.CreateTime,
-		RMsgId:  userMsg.ReplyMsgId,
-		Body:    userMsg.MsgContent,
-		ExtData: userMsg.ExtData,
-		Status:  &userMsg.Status,
-		AtUsers: userMsg.AtUsers,
+		CId:           userMsg.ClientId,
+		SId:           userMsg.SessionId,
+		Type:          userMsg.MsgType,
+		MsgId:         userMsg.MsgId,
+		Seq:           userMsg.Seq,
+		FUid:          userMsg.FromUserId,
+		CTime:         userMsg.CreateTime,
+		RMsgId:        userMsg.ReplyMsgId,
+		Body:          userMsg.MsgContent,
+		ExtData:       userMsg.ExtData,
+		Status:        &userMsg.Status,
+		AtUsers:       userMsg.AtUsers,
+		TtlMs:         userMsg.TtlMs,
+		BurnAfterRead: userMsg.BurnAfterRead == 1,
+		ExpireTime:    userMsg.ExpireTime,
 	}
 	return &msg
 }
 
+// fillMessages 填充消息的表情回应和话题信息
+func (l *MessageLogic) fillMessages(uId int64, messages []*dto.Message, claims baseDto.ThkClaims) {
+	l.fillMessageReactions(uId, messages, claims)
+	l.fillMessageThreads(messages, claims)
+}
+
 func (l *MessageLogic) GetUserMessages(req dto.GetMessageReq, claims baseDto.ThkClaims) (*dto.GetMessageRes, error) {
-	userMessages, err := l.appCtx.UserMessageModel().GetUserMessages(req.UId, req.CTime, req.Offset, req.Count)
+	userMessages, err := l.getDeviceUserMessages(req.UId, req.CTime, req.MsgId, req.Offset, req.Count, claims)
 	if err != nil {
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetUserMessages %v, %v", req, err)
 		return nil, err
@@ -72,6 +99,7 @@ func (l *MessageLogic) GetUserMessages(req dto.GetMessageReq, claims baseDto.Thk
 		message := l.convUserMessage2Message(userMessage)
 		messages = append(messages, message)
 	}
+	l.fillMessages(req.UId, messages, claims)
 	return &dto.GetMessageRes{Data: messages}, nil
 }
 
@@ -97,66 +125,263 @@ func (l *MessageLogic) GetSessionMessages(req dto.GetSessionMessageReq, claims b
 		message := l.convSessionMessage2Message(sessionMessage)
 		messages = append(messages, message)
 	}
+	l.fillMessages(req.UId, messages, claims)
 	return &dto.GetMessageRes{Data: messages}, nil
 }
 
+// findMessagesByIds 查询用户在会话中可见的消息, 查询失败返回空列表
+func (l *MessageLogic) findMessagesByIds(uId, sId int64, msgIds []int64, claims baseDto.ThkClaims) []*dto.Message {
+	messages := make([]*dto.Message, 0)
+	session, err := l.appCtx.SessionModel().FindSession(sId)
+	if err != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("findMessagesByIds %d, %v", sId, err)
+		return messages
+	}
+	if session.Type == model.SuperGroupSessionType {
+		sessionMessages, errMessage := l.appCtx.SessionMessageModel().GetSessionMessages(sId, 0, 0, len(msgIds), msgIds, 1)
+		if errMessage != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("findMessagesByIds %d, %v", sId, errMessage)
+			return messages
+		}
+		for _, sessionMessage := range sessionMessages {
+			if sessionMessage.Deleted == 0 {
+				messages = append(messages, l.convSessionMessage2Message(sessionMessage))
+			}
+		}
+	} else {
+		userMessages, errMessage := l.appCtx.UserMessageModel().FindUserMessages(uId, sId, msgIds)
+		if errMessage != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("findMessagesByIds %d, %v", sId, errMessage)
+			return messages
+		}
+		for _, userMessage := range userMessages {
+			if userMessage.Deleted == 0 {
+				messages = append(messages, l.convUserMessage2Message(userMessage))
+			}
+		}
+	}
+	return messages
+}
+
 func (l *MessageLogic) DelSessionMessage(req *dto.DelSessionMessageReq, claims baseDto.ThkClaims) error {
+	// 删除前统计被删除的话题回复, 用于扣减根消息回复数
+	rootReplyCounts, errCount := l.appCtx.SessionMessageModel().CountThreadReplies(req.SId, req.MsgIds, req.TimeFrom, req.TimeTo)
+	if errCount != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DelSessionMessage err: %v %v", req, errCount)
+		return errCount
+	}
 	err := l.appCtx.SessionMessageModel().DelMessages(req.SId, req.MsgIds, req.TimeFrom, req.TimeTo)
 	if err != nil {
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DelSessionMessage err: %v %v", req, err)
+		return err
 	}
-	return err
+	l.revertThreadReplies(req.SId, rootReplyCounts, claims)
+	l.unindexMessages(req.SId, req.MsgIds, req.TimeFrom, req.TimeTo, claims)
+	l.resetSessionLastMessage(req.SId, claims)
+	return nil
 }
 
 func (l *MessageLogic) SendMessage(req dto.SendMessageReq, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
+	return l.sendMessage(req, true, claims)
+}
+
+// sendMessage rateLimited为false时不做发送限流, 用于到期的定时消息和撤回/编辑等服务端发出的操作消息,
+// 这些消息在用户发起请求时已经限流过, 发送时被限流会导致定时消息失败或已修改的存储无法通知到成员
+func (l *MessageLogic) sendMessage(req dto.SendMessageReq, rateLimited bool, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
 	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
 	if errSession != nil || session.Id <= 0 {
-		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage FindSession %v, %v", req, errSession)
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SendMessage FindSession %v, %v", req, errSession)
 		return nil, errorx.ErrSessionInvalid
 	}
+	if errSchema := l.checkMessageSchema(req, claims); errSchema != nil {
+		return nil, errSchema
+	}
+	// 超级群消息只有一份, 无法按读者分别开始阅后即焚倒计时
+	if req.BurnAfterRead && session.Type == model.SuperGroupSessionType {
+		return nil, errorx.ErrBurnAfterReadNotSupport
+	}
+	reviewCategories := make([]string, 0)
+	var userSession *model.UserSession
 	// req.FUid为0是系统消息, 不需要校验是否能对session发送消息
 	if req.FUid > 0 {
-		userSession, errUserSession := l.appCtx.UserSessionModel().GetUserSession(req.FUid, req.SId)
-		if errUserSession != nil {
-			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage GetUserSession %v, %v", req, errUserSession)
-			return nil, errorx.ErrSessionInvalid
+		var errUserSession error
+		if userSession, errUserSession = l.findMemberUserSession(req.FUid, req.SId, claims); errUserSession != nil {
+			return nil, errUserSession
+		}
+		// 非成员的请求不消耗令牌, 避免恶意请求耗尽会话的令牌桶
+		if rateLimited {
+			if errLimit := l.checkSendRateLimit(session, req.FUid, claims); errLimit != nil {
+				return nil, errLimit
+			}
+		}
+		if errFlag := l.checkSessionFunctionFlag(session, req.Type); errFlag != nil {
+			return nil, errFlag
+		}
+		var errCheck error
+		if req.Body, reviewCategories, errCheck = l.checkMessageContent(session, userSession, req.FUid, req.Type, req.Body, claims); errCheck != nil {
+			return nil, errCheck
+		}
+		if errMuted := l.checkUserSessionMuted(userSession); errMuted != nil {
+			return nil, errMuted
+		}
+	}
+	if errMention := l.checkMessageMentions(req, userSession, claims); errMention != nil {
+		return nil, errMention
+	}
+
+	// 定时消息先入库, 到期后由定时任务重新走发送流程
+	if l.isScheduled(req.SendAt) {
+		return l.scheduleSessionMessage(req, claims)
+	}
+
+	if session.Type == model.GroupSessionType {
+		// 群可能正在升级为超级群, 升级会等待已登记的发送结束, 登记后重新确认会话类型再写入; 群内的发送之间互不阻塞
+		token, errGuard := l.enterGroupSend(session.Id, claims)
+		if errGuard != nil {
+			return nil, errGuard
 		}
-		if userSession.Deleted == 1 || userSession.UserId == 0 {
-			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage GetUserSession %v, %v", req, userSession)
+		defer l.leaveGroupSend(session.Id, token, claims)
+		if session, errSession = l.appCtx.SessionModel().FindSession(req.SId); errSession != nil || session.Id <= 0 {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SendMessage FindSession %v, %v", req, errSession)
 			return nil, errorx.ErrSessionInvalid
 		}
-		msgCheckApi := l.appCtx.MessageCheckApi()
-		if msgCheckApi != nil {
-			// 检查消息是否可以发送[内容检测/建联逻辑等检查]
-			checkReq := &dto.CheckMessageReq{
-				SessionType:    session.Type,
-				SessionId:      session.Id,
-				FunctionFlag:   session.FunctionFlag,
-				FromUId:        req.FUid,
-				MessageType:    req.Type,
-				MessageContent: req.Body,
-				EntityId:       userSession.EntityId,
-			}
-			errCheck := msgCheckApi.CheckMessage(checkReq, claims)
-			if errCheck != nil {
-				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage CheckMessage %v, %v", checkReq, errCheck)
-				return nil, errCheck
-			}
+		if req.BurnAfterRead && session.Type == model.SuperGroupSessionType {
+			return nil, errorx.ErrBurnAfterReadNotSupport
 		}
-		if userSession.Mute&model.MutedSingleBitInUserSessionStatus > 0 {
-			return nil, errorx.ErrUserMuted
-		} else if userSession.Mute&model.MutedAllBitInUserSessionStatus > 0 && userSession.Role < model.SessionSuperAdmin {
-			// 如果是超管或者是群主，全员被禁言情况下仍允许发言
-			return nil, errorx.ErrSessionMuted
+	}
+
+	var (
+		res     *dto.SendMessageRes
+		errSend error
+	)
+	if session.Type == model.SuperGroupSessionType {
+		// 如果是超级群 读扩散模型，写入session_message表
+		res, errSend = l.SendSessionMessage(session, req, claims)
+	} else {
+		// 其他情况使用使用写扩散模型，写入user_message表
+		res, errSend = l.SendUserMessage(session, req, claims)
+	}
+	if errSend == nil && len(reviewCategories) > 0 {
+		l.addMessageReview(req.SId, res.MsgId, req.FUid, req.Body, reviewCategories, claims)
+	}
+	return res, errSend
+}
+
+// enterGroupSend 登记一次正在进行的群聊发送, 群正在升级为超级群时等待升级完成, 等待超时返回ErrServerBusy
+func (l *MessageLogic) enterGroupSend(sId int64, claims baseDto.ThkClaims) (string, error) {
+	keys := []string{
+		fmt.Sprintf(sessionSendingKey, l.appCtx.Config().Name, sId),
+		fmt.Sprintf(sessionPromotingKey, l.appCtx.Config().Name, sId),
+	}
+	token := strconv.FormatInt(l.genClientId(), 10)
+	deadline := time.Now().Add(groupSendGuardWait * time.Millisecond)
+	for {
+		expireAt := time.Now().UnixMilli() + groupSendGuardTimeout
+		entered, err := l.appCtx.RedisCache().Eval(context.Background(), enterGroupSendScript, keys, expireAt, token, groupSendGuardTimeout).Int64()
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("enterGroupSend %d, %v", sId, err)
+			return "", baseErrorx.ErrServerBusy
+		}
+		if entered == 1 {
+			return token, nil
+		}
+		if time.Now().After(deadline) {
+			return "", baseErrorx.ErrServerBusy
 		}
+		time.Sleep(groupSendGuardRetry)
 	}
+}
+
+func (l *MessageLogic) leaveGroupSend(sId int64, token string, claims baseDto.ThkClaims) {
+	key := fmt.Sprintf(sessionSendingKey, l.appCtx.Config().Name, sId)
+	if err := l.appCtx.RedisCache().ZRem(context.Background(), key, token).Err(); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("leaveGroupSend %d, %v", sId, err)
+	}
+}
+
+// checkMessageContent 检查消息是否可以发送[内容检测/建联逻辑等检查], 返回脱敏后的内容和命中的待审核分类
+func (l *MessageLogic) checkMessageContent(session *model.Session, userSession *model.UserSession, fUid int64, msgType int, content string,
+	claims baseDto.ThkClaims) (string, []string, error) {
+	msgCheckApi := l.appCtx.MessageCheckApi()
+	if msgCheckApi == nil {
+		return content, nil, nil
+	}
+	checkReq := &dto.CheckMessageReq{
+		SessionType:    session.Type,
+		SessionId:      session.Id,
+		FunctionFlag:   session.FunctionFlag,
+		FromUId:        fUid,
+		MessageType:    msgType,
+		MessageContent: content,
+		EntityId:       userSession.EntityId,
+	}
+	if err := msgCheckApi.CheckMessage(checkReq, claims); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("CheckMessage %v, %v", checkReq, err)
+		return "", nil, err
+	}
+	// 检测可能对敏感词做了脱敏处理
+	return checkReq.MessageContent, checkReq.ReviewCategories, nil
+}
 
-	// 如果是超级群 读扩散模型，写入session_message表
+// findMemberUserSession 查询用户在会话中的userSession, 用户不在会话中返回ErrSessionInvalid
+func (l *MessageLogic) findMemberUserSession(uId, sId int64, claims baseDto.ThkClaims) (*model.UserSession, error) {
+	userSession, err := l.appCtx.UserSessionModel().GetUserSession(uId, sId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetUserSession %d %d, %v", uId, sId, err)
+		return nil, errorx.ErrSessionInvalid
+	}
+	if userSession.Deleted == 1 || userSession.UserId == 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetUserSession %d %d, %v", uId, sId, userSession)
+		return nil, errorx.ErrSessionInvalid
+	}
+	return userSession, nil
+}
+
+// checkSessionFunctionFlag 校验会话开启了发送该类型消息需要的功能, 未设置功能位(为0)的会话不限制, 兼容存量会话
+func (l *MessageLogic) checkSessionFunctionFlag(session *model.Session, msgType int) error {
+	if session.FunctionFlag == 0 {
+		return nil
+	}
+	flag := l.appCtx.MsgApiConfig().IM.RequiredFunctionFlag(msgType)
+	if flag > 0 && session.FunctionFlag&flag != flag {
+		return errorx.ErrMessageTypeNotSupport
+	}
+	return nil
+}
+
+func (l *MessageLogic) checkUserSessionMuted(userSession *model.UserSession) error {
+	if userSession.Mute&model.MutedSingleBitInUserSessionStatus > 0 {
+		return errorx.ErrUserMuted
+	} else if userSession.Mute&model.MutedAllBitInUserSessionStatus > 0 && userSession.Role < model.SessionSuperAdmin {
+		// 如果是超管或者是群主，全员被禁言情况下仍允许发言
+		return errorx.ErrSessionMuted
+	}
+	return nil
+}
+
+// checkMessageVisible 校验消息对用户可见, 且不是状态操作消息
+func (l *MessageLogic) checkMessageVisible(session *model.Session, uId, msgId int64) error {
+	msgType, deleted := 0, int8(0)
 	if session.Type == model.SuperGroupSessionType {
-		return l.SendSessionMessage(session, req, claims)
+		sessionMessage, errMessage := l.appCtx.SessionMessageModel().FindSessionMessageByMsgId(session.Id, msgId)
+		if errMessage != nil || sessionMessage.MsgId == 0 {
+			return errorx.ErrSessionMessageInvalid
+		}
+		msgType, deleted = sessionMessage.MsgType, sessionMessage.Deleted
+	} else {
+		userMessage, errMessage := l.appCtx.UserMessageModel().FindUserMessage(uId, session.Id, msgId)
+		if errMessage != nil || userMessage.MsgId == 0 {
+			return errorx.ErrSessionMessageInvalid
+		}
+		msgType, deleted = userMessage.MsgType, userMessage.Deleted
+	}
+	if deleted == 1 {
+		return errorx.ErrSessionMessageInvalid
+	}
+	if msgType < 0 { // 小于0的类型消息为状态操作消息，不能操作
+		return errorx.ErrMessageTypeNotSupport
 	}
-	// 其他情况使用使用写扩散模型，写入user_message表
-	return l.SendUserMessage(session, req, claims)
+	return nil
 }
 
 func (l *MessageLogic) SendSessionMessage(session *model.Session, req dto.SendMessageReq, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
@@ -164,29 +389,60 @@ func (l *MessageLogic) SendSessionMessage(session *model.Session, req dto.SendMe
 	if receivers == nil || len(receivers) == 0 {
 		return nil, errorx.ErrUserReject
 	}
+	receiverUIds, offlineReceiverIds := l.splitReceivers(receivers, req)
 	// 根据clientId和fromUserId查询是否已经发送过消息
 	sessionMessage, errMessage := l.appCtx.SessionMessageModel().FindMessageByClientId(req.SId, req.CId, req.FUid)
 	// 如果已经发送过，直接取数据库里的数据库, 没有发送过则插入数据库
 	if sessionMessage == nil || sessionMessage.MsgId == 0 {
 		// 插入数据库发送消息
 		msgId := int64(l.appCtx.SnowflakeNode().Generate())
-		sessionMessage, errMessage = l.appCtx.SessionMessageModel().InsertMessage(
-			req.CId, req.FUid, req.SId, msgId, req.Body, req.ExtData, req.Type, req.AtUsers, req.RMsgId, req.CTime)
-		if errMessage != nil {
-			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage InsertMessage %v, %v", errMessage, req)
+		seq, errSeq := l.genMessageSeq(session, req, claims)
+		if errSeq != nil {
+			return nil, errSeq
+		}
+		ttlMs, burnAfterRead, expireTime := l.genMessageExpire(req)
+		sessionMessage = &model.SessionMessage{
+			MsgId:         msgId,
+			ClientId:      req.CId,
+			SessionId:     req.SId,
+			Seq:           seq,
+			FromUserId:    req.FUid,
+			AtUsers:       req.AtUsers,
+			MsgType:       req.Type,
+			ExtData:       req.ExtData,
+			MsgContent:    req.Body,
+			ReplyMsgId:    req.RMsgId,
+			TtlMs:         ttlMs,
+			BurnAfterRead: burnAfterRead,
+			ExpireTime:    expireTime,
+			CreateTime:    req.CTime,
+			UpdateTime:    time.Now().UnixMilli(),
+		}
+		dtoMsg := l.convSessionMessage2Message(sessionMessage)
+		outbox, errOutbox := l.newMessageOutbox(dtoMsg, session.Type, receiverUIds, offlineReceiverIds)
+		if errOutbox != nil {
+			return nil, errOutbox
+		}
+		// 消息和待投递记录同一事务写入, 投递失败由outbox relay重试
+		if errMessage = l.appCtx.SessionMessageModel().InsertMessageWithOutbox(sessionMessage, outbox,
+			l.appCtx.MessageOutboxModel().GenMessageOutboxTableName(outbox.SessionId)); errMessage != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SendMessage InsertMessage %v, %v", errMessage, req)
 			return nil, errMessage
 		}
+		l.updateMessageThread(session, req, sessionMessage.MsgId, sessionMessage.CreateTime, claims)
+		l.updateLastMessage(session, req, sessionMessage.MsgId, sessionMessage.CreateTime, receiverUIds, claims)
+		l.indexMessageMentions(req, sessionMessage.MsgId, sessionMessage.CreateTime, receiverUIds, claims)
+		l.indexMessage(req, sessionMessage.MsgId, sessionMessage.CreateTime, claims)
+		onlineUIds, offlineUIds := l.publishOutboxMessage(outbox, dtoMsg, receiverUIds, offlineReceiverIds, claims)
+		return &dto.SendMessageRes{
+			MsgId:      sessionMessage.MsgId,
+			CreateTime: sessionMessage.CreateTime,
+			OnlineIds:  onlineUIds,
+			OfflineIds: offlineUIds,
+		}, nil
 	}
 
 	dtoMsg := l.convSessionMessage2Message(sessionMessage)
-	offlineReceiverIds := make([]int64, 0)
-	receiverUIds := make([]int64, 0)
-	for _, r := range receivers {
-		receiverUIds = append(receiverUIds, r.UserId)
-		if r.Status&model.SilenceBitInUserSessionStatus == 0 {
-			offlineReceiverIds = append(offlineReceiverIds, r.UserId)
-		}
-	}
 	if onlineUIds, offlineUIds, err := l.publishSendMessageEvents(dtoMsg, session.Type, receiverUIds, offlineReceiverIds, claims); err != nil {
 		return nil, errorx.ErrMessageDeliveryFailed
 	} else {
@@ -204,47 +460,73 @@ func (l *MessageLogic) SendUserMessage(session *model.Session, req dto.SendMessa
 	if receivers == nil || len(receivers) == 0 {
 		return nil, errorx.ErrUserReject
 	}
+	receiverUIds, offlineReceiverIds := l.splitReceivers(receivers, req)
 	// 根据clientId和fromUserId查询是否已经发送过消息
 	userMessage, errMessage := l.appCtx.UserMessageModel().FindUserMessageByClientId(req.FUid, req.SId, req.CId)
 	// 如果已经发送过，直接取数据库里的数据库, 没有发送过则插入数据库
 	if userMessage == nil || userMessage.MsgId == 0 {
 		// 插入数据库发送消息
 		msgId := int64(l.appCtx.SnowflakeNode().Generate())
+		seq, errSeq := l.genMessageSeq(session, req, claims)
+		if errSeq != nil {
+			return nil, errSeq
+		}
 		now := time.Now().UnixMilli()
+		ttlMs, burnAfterRead, expireTime := l.genMessageExpire(req)
 		userMessage = &model.UserMessage{
-			MsgId:      msgId,
-			ClientId:   req.CId,
-			UserId:     req.FUid,
-			SessionId:  req.SId,
-			FromUserId: req.FUid,
-			MsgType:    req.Type,
-			MsgContent: req.Body,
-			ReplyMsgId: req.RMsgId,
-			AtUsers:    req.AtUsers,
-			ExtData:    req.ExtData,
-			Status:     model.MsgStatusAcked | model.MsgStatusRead,
-			CreateTime: req.CTime,
-			UpdateTime: now,
-		}
-		if userMessage.FromUserId > 0 { // fromUserId = 0为系统发给用户的消息，不用插入数据库
-			// 插入发件人消息表
-			errMessage = l.appCtx.UserMessageModel().InsertUserMessage(userMessage)
-			if errMessage != nil {
-				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("SendMessage InsertMessage %v, %v", errMessage, req)
-				return nil, errMessage
-			}
+			MsgId:         msgId,
+			ClientId:      req.CId,
+			UserId:        req.FUid,
+			SessionId:     req.SId,
+			Seq:           seq,
+			FromUserId:    req.FUid,
+			MsgType:       req.Type,
+			MsgContent:    req.Body,
+			ReplyMsgId:    req.RMsgId,
+			AtUsers:       req.AtUsers,
+			ExtData:       req.ExtData,
+			Status:        model.MsgStatusInit,
+			TtlMs:         ttlMs,
+			BurnAfterRead: burnAfterRead,
+			ExpireTime:    expireTime,
+			CreateTime:    req.CTime,
+			UpdateTime:    now,
+		}
+		dtoMsg := l.convUserMessage2Message(userMessage)
+		outbox, errOutbox := l.newMessageOutbox(dtoMsg, session.Type, receiverUIds, offlineReceiverIds)
+		if errOutbox != nil {
+			return nil, errOutbox
 		}
+		if userMessage.FromUserId > 0 {
+			// 发件人消息和待投递记录同一事务写入, 投递失败由outbox relay重试
+			senderMessage := *userMessage
+			senderMessage.Status = model.MsgStatusAcked | model.MsgStatusRead
+			errMessage = l.appCtx.UserMessageModel().InsertUserMessageWithOutbox(&senderMessage, outbox,
+				l.appCtx.MessageOutboxModel().GenMessageOutboxTableName(outbox.SessionId))
+		} else {
+			// fromUserId = 0为系统发给用户的消息，不用插入消息表
+			errMessage = l.appCtx.MessageOutboxModel().Insert(outbox)
+		}
+		if errMessage != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SendMessage InsertMessage %v, %v", errMessage, req)
+			return nil, errMessage
+		}
+		l.updateMessageThread(session, req, userMessage.MsgId, userMessage.CreateTime, claims)
+		l.updateLastMessage(session, req, userMessage.MsgId, userMessage.CreateTime, receiverUIds, claims)
+		l.indexMessageMentions(req, userMessage.MsgId, userMessage.CreateTime, receiverUIds, claims)
+		l.indexMessage(req, userMessage.MsgId, userMessage.CreateTime, claims)
+		l.incrUnreadCount(req, receiverUIds, claims)
+		onlineUIds, offlineUIds := l.publishOutboxMessage(outbox, dtoMsg, receiverUIds, offlineReceiverIds, claims)
+		return &dto.SendMessageRes{
+			MsgId:      userMessage.MsgId,
+			CreateTime: userMessage.CreateTime,
+			OnlineIds:  onlineUIds,
+			OfflineIds: offlineUIds,
+		}, nil
 	}
+
 	userMessage.Status = model.MsgStatusInit
 	dtoMsg := l.convUserMessage2Message(userMessage)
-	offlineReceiverIds := make([]int64, 0)
-	receiverUIds := make([]int64, 0)
-	for _, r := range receivers {
-		receiverUIds = append(receiverUIds, r.UserId)
-		if r.Status&model.SilenceBitInUserSessionStatus == 0 {
-			offlineReceiverIds = append(offlineReceiverIds, r.UserId)
-		}
-	}
 	if onlineUIds, offlineUIds, err := l.publishSendMessageEvents(dtoMsg, session.Type, receiverUIds, offlineReceiverIds, claims); err != nil {
 		return nil, errorx.ErrMessageDeliveryFailed
 	} else {
@@ -257,10 +539,45 @@ func (l *MessageLogic) SendUserMessage(session *model.Session, req dto.SendMessa
 	}
 }
 
+// splitReceivers 返回全部接收人和需要离线推送的接收人(未设置静音或被@)
+func (l *MessageLogic) splitReceivers(receivers []*model.SessionUser, req dto.SendMessageReq) ([]int64, []int64) {
+	offlineReceiverIds := make([]int64, 0)
+	receiverUIds := make([]int64, 0)
+	for _, r := range receivers {
+		receiverUIds = append(receiverUIds, r.UserId)
+	}
+	mentioned := make(map[int64]bool)
+	for _, uId := range mentionedReceivers(req, receiverUIds) {
+		mentioned[uId] = true
+	}
+	for _, r := range receivers {
+		if r.Status&model.SilenceBitInUserSessionStatus == 0 || mentioned[r.UserId] {
+			offlineReceiverIds = append(offlineReceiverIds, r.UserId)
+		}
+	}
+	return receiverUIds, offlineReceiverIds
+}
+
+// genMessageSeq 发给session下所有人的消息才分配会话序号, 指定接收人的消息(如已读回执)序号为0, 避免其他成员误判为消息缺失
+func (l *MessageLogic) genMessageSeq(session *model.Session, req dto.SendMessageReq, claims baseDto.ThkClaims) (int64, error) {
+	if len(req.Receivers) > 0 {
+		return 0, nil
+	}
+	seq, err := l.allocMessageSeq(session, claims)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("genMessageSeq %v, %v", req, err)
+		return 0, errorx.ErrMessageDeliveryFailed
+	}
+	return seq, nil
+}
+
 func (l *MessageLogic) SendSysMessage(req dto.SendSysMessageReq, claims baseDto.ThkClaims) (*dto.SendSysMessageRes, error) {
 	if req.Receivers == nil || len(req.Receivers) == 0 {
 		return nil, baseErrorx.ErrParamsError
 	}
+	if l.isScheduled(req.SendAt) {
+		return l.scheduleSysMessage(req, claims)
+	}
 	msgId := l.appCtx.SessionMessageModel().NewMsgId()
 	now := time.Now().UnixMilli()
 	sessionType := 0
@@ -309,7 +626,7 @@ func (l *MessageLogic) publishSendMessageEvents(dtoMsg *dto.Message, sessionType
 		errPubSave := l.pubSaveMsgEvent(msgJsonStr, receivers, dtoMsg.SId)
 		if errPubSave != nil {
 			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Error("pubSaveMsgEvent, err:", errPubSave)
-			return nil, nil, errPubPush
+			return nil, nil, errPubSave
 		}
 	}
 	return onlineUIds, offlineUIds, nil
@@ -341,7 +658,37 @@ func (l *MessageLogic) pubSaveMsgEvent(msgBody string, receivers []int64, sessio
 	}
 }
 
-// 发布推送消息
+// pubOperationMessageEvent 在线推送不落库的操作消息, uIds为空时推送给会话所有成员
+func (l *MessageLogic) pubOperationMessageEvent(sId, fUid int64, msgType int, body string, rMsgId int64, uIds []int64, claims baseDto.ThkClaims) error {
+	if len(uIds) == 0 {
+		sessionUsers := l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(sId, 0, nil)
+		for _, sessionUser := range sessionUsers {
+			uIds = append(uIds, sessionUser.UserId)
+		}
+	}
+	if len(uIds) == 0 {
+		return nil
+	}
+	dtoMsg := &dto.Message{
+		CId:    l.genClientId(),
+		SId:    sId,
+		MsgId:  l.appCtx.SessionMessageModel().NewMsgId(),
+		Type:   msgType,
+		FUid:   fUid,
+		CTime:  time.Now().UnixMilli(),
+		Body:   body,
+		RMsgId: &rMsgId,
+	}
+	msgJson, err := json.Marshal(dtoMsg)
+	if err != nil {
+		return err
+	}
+	deliverKey := fmt.Sprintf("session-%d", sId)
+	_, _, err = l.pubPushMessageEvent(event.SignalNewMessage, string(msgJson), uIds, nil, deliverKey, false, claims)
+	return err
+}
+
+// 发布推送消息, 离线用户中只有在offlinePushUIds中的才发布离线推送
 func (l *MessageLogic) pubPushMessageEvent(t int, body string, uIds []int64, offlinePushUIds []int64, deliverKey string, offlinePushTag bool, claims baseDto.ThkClaims) ([]int64, []int64, error) {
 	uidOnlineKeys := make([]string, 0)
 	for _, uid := range uIds {
@@ -392,8 +739,9 @@ func (l *MessageLogic) pubPushMessageEvent(t int, body string, uIds []int64, off
 		return nil, nil, err
 	}
 
-	if offlinePushTag && len(offlineUIds) > 0 {
-		receiverStr, errJson = json.Marshal(offlineUIds)
+	offlinePushReceiverUIds := offlinePushReceivers(offlineUIds, offlinePushUIds)
+	if offlinePushTag && len(offlinePushReceiverUIds) > 0 {
+		receiverStr, errJson = json.Marshal(offlinePushReceiverUIds)
 		if errJson != nil {
 			return nil, nil, errJson
 		}
@@ -407,10 +755,30 @@ func (l *MessageLogic) pubPushMessageEvent(t int, body string, uIds []int64, off
 	return onlineUIds, offlineUIds, err
 }
 
+// offlinePushReceivers 离线用户中需要离线推送的用户, offlinePushUIds为nil时不过滤
+func offlinePushReceivers(offlineUIds, offlinePushUIds []int64) []int64 {
+	if offlinePushUIds == nil {
+		return offlineUIds
+	}
+	pushUIds := make(map[int64]bool, len(offlinePushUIds))
+	for _, uId := range offlinePushUIds {
+		pushUIds[uId] = true
+	}
+	receivers := make([]int64, 0, len(offlineUIds))
+	for _, uId := range offlineUIds {
+		if pushUIds[uId] {
+			receivers = append(receivers, uId)
+		}
+	}
+	return receivers
+}
+
 func (l *MessageLogic) DeleteUserMessage(req *dto.DeleteMessageReq, claims baseDto.ThkClaims) error {
 	err := l.appCtx.UserMessageModel().DeleteMessages(req.UId, req.SId, req.MessageIds, req.TimeFrom, req.TimeTo)
 	if err != nil {
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DeleteUserMessage err: %v %v", req, err)
+		return err
 	}
-	return err
+	l.resetUserLastMessage(req.UId, req.SId, claims)
+	return nil
 }
@@ -0,0 +1,244 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	atAllToken           = "all"
+	userMentionsMaxCount = 100
+)
+
+// parseAtUsers 解析at_users, 多个用户id以#或,分隔, 可带@前缀, @all表示@全体成员
+func parseAtUsers(atUsers *string) ([]int64, bool, error) {
+	uIds := make([]int64, 0)
+	atAll := false
+	if atUsers == nil {
+		return uIds, atAll, nil
+	}
+	fields := strings.FieldsFunc(*atUsers, func(r rune) bool {
+		return r == '#' || r == ','
+	})
+	for _, field := range fields {
+		token := strings.TrimPrefix(strings.TrimSpace(field), "@")
+		if token == atAllToken {
+			atAll = true
+			continue
+		}
+		uId, err := strconv.ParseInt(token, 10, 64)
+		if err != nil || uId <= 0 {
+			return nil, false, errorx.ErrMentionInvalid
+		}
+		uIds = append(uIds, uId)
+	}
+	return uIds, atAll, nil
+}
+
+func isUserMentioned(atUsers *string, uId int64) bool {
+	uIds, atAll, err := parseAtUsers(atUsers)
+	if err != nil {
+		return false
+	}
+	if atAll {
+		return true
+	}
+	for _, atUId := range uIds {
+		if atUId == uId {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionedReceivers 返回接收人中被@的用户, 不包含发送人
+func mentionedReceivers(req dto.SendMessageReq, receiverUIds []int64) []int64 {
+	mentioned := make([]int64, 0)
+	uIds, atAll, err := parseAtUsers(req.AtUsers)
+	if err != nil || (!atAll && len(uIds) == 0) {
+		return mentioned
+	}
+	atUIds := make(map[int64]bool, len(uIds))
+	for _, uId := range uIds {
+		atUIds[uId] = true
+	}
+	for _, uId := range receiverUIds {
+		if uId != req.FUid && (atAll || atUIds[uId]) {
+			mentioned = append(mentioned, uId)
+		}
+	}
+	return mentioned
+}
+
+// checkMessageMentions 校验被@的用户都是会话成员, 只有管理员及以上角色可以@全体成员, 系统消息userSession为空, 可以@全体成员
+func (l *MessageLogic) checkMessageMentions(req dto.SendMessageReq, userSession *model.UserSession, claims baseDto.ThkClaims) error {
+	if req.AtUsers == nil || *req.AtUsers == "" {
+		return nil
+	}
+	uIds, atAll, err := parseAtUsers(req.AtUsers)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkMessageMentions %v, %v", req, err)
+		return err
+	}
+	if atAll && userSession != nil && userSession.Role < model.SessionAdmin {
+		return errorx.ErrMentionAllForbidden
+	}
+	if len(uIds) == 0 {
+		return nil
+	}
+	members := make(map[int64]bool)
+	for _, sessionUser := range l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(req.SId, 0, uIds) {
+		members[sessionUser.UserId] = true
+	}
+	for _, uId := range uIds {
+		if !members[uId] {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkMessageMentions %v, %d not member", req, uId)
+			return errorx.ErrMentionInvalid
+		}
+	}
+	return nil
+}
+
+// indexMessageMentions 记录被@的用户, 用于查询@我的消息, @全体成员每个会话只记录一条, 避免按成员数写扩散
+func (l *MessageLogic) indexMessageMentions(req dto.SendMessageReq, msgId, cTime int64, receiverUIds []int64, claims baseDto.ThkClaims) {
+	if !isUnreadCounted(req.Type) {
+		return
+	}
+	_, atAll, err := parseAtUsers(req.AtUsers)
+	if err != nil {
+		return
+	}
+	if atAll {
+		sessionMention := &model.SessionMention{
+			SessionId:  req.SId,
+			MsgId:      msgId,
+			FromUserId: req.FUid,
+			CreateTime: cTime,
+		}
+		if err = l.appCtx.SessionMentionModel().AddMention(sessionMention); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("indexMessageMentions %v, %v", req, err)
+		}
+		return
+	}
+	mentioned := mentionedReceivers(req, receiverUIds)
+	mentions := make([]*model.UserMention, 0, len(mentioned))
+	for _, uId := range mentioned {
+		mentions = append(mentions, &model.UserMention{
+			UserId:     uId,
+			SessionId:  req.SId,
+			MsgId:      msgId,
+			FromUserId: req.FUid,
+			CreateTime: cTime,
+		})
+	}
+	if len(mentions) == 0 {
+		return
+	}
+	if err = l.appCtx.UserMentionModel().AddMentions(mentions); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("indexMessageMentions %v, %v", req, err)
+	}
+}
+
+// findUserAtAllMentions 查询用户所在会话中@全体成员的记录
+func (l *MessageLogic) findUserAtAllMentions(req dto.QueryUserMentionsReq) ([]*model.UserMention, error) {
+	var sessionIds []int64
+	if req.SId != nil {
+		userSession, err := l.appCtx.UserSessionModel().GetUserSession(req.UId, *req.SId)
+		if err != nil {
+			return nil, err
+		}
+		if userSession.UserId == 0 || userSession.Deleted == 1 {
+			return nil, nil
+		}
+		sessionIds = []int64{*req.SId}
+	} else {
+		var err error
+		if sessionIds, err = l.appCtx.UserSessionModel().FindUserSessionIds(req.UId); err != nil {
+			return nil, err
+		}
+	}
+	if len(sessionIds) == 0 {
+		return nil, nil
+	}
+	sessionMentions, err := l.appCtx.SessionMentionModel().FindSessionMentions(sessionIds, req.UId, req.CTime, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	mentions := make([]*model.UserMention, 0, len(sessionMentions))
+	for _, sessionMention := range sessionMentions {
+		mentions = append(mentions, &model.UserMention{
+			UserId:     req.UId,
+			SessionId:  sessionMention.SessionId,
+			MsgId:      sessionMention.MsgId,
+			FromUserId: sessionMention.FromUserId,
+			AtAll:      1,
+			CreateTime: sessionMention.CreateTime,
+		})
+	}
+	return mentions, nil
+}
+
+// mergeUserMentions 合并单独@和@全体成员的记录, 按时间倒序取前count条
+func mergeUserMentions(userMentions, atAllMentions []*model.UserMention, count int) []*model.UserMention {
+	merged := make([]*model.UserMention, 0, len(userMentions)+len(atAllMentions))
+	merged = append(merged, userMentions...)
+	merged = append(merged, atAllMentions...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].CreateTime > merged[j].CreateTime
+	})
+	if len(merged) > count {
+		merged = merged[:count]
+	}
+	return merged
+}
+
+func (l *MessageLogic) QueryUserMentions(req dto.QueryUserMentionsReq, claims baseDto.ThkClaims) (*dto.QueryUserMentionsRes, error) {
+	if req.Count <= 0 || req.Count > userMentionsMaxCount {
+		req.Count = userMentionsMaxCount
+	}
+	userMentions, err := l.appCtx.UserMentionModel().FindUserMentions(req.UId, req.SId, req.CTime, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryUserMentions %v, %v", req, err)
+		return nil, err
+	}
+	atAllMentions, err := l.findUserAtAllMentions(req)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryUserMentions %v, %v", req, err)
+		return nil, err
+	}
+	mentions := mergeUserMentions(userMentions, atAllMentions, req.Count)
+	sessionMsgIds := make(map[int64][]int64)
+	for _, mention := range mentions {
+		sessionMsgIds[mention.SessionId] = append(sessionMsgIds[mention.SessionId], mention.MsgId)
+	}
+	// 按会话批量查询消息, 超级群查session_message, 其他会话查用户自己的消息副本
+	messageMap := make(map[int64]map[int64]*dto.Message)
+	for sId, msgIds := range sessionMsgIds {
+		messageMap[sId] = make(map[int64]*dto.Message)
+		for _, message := range l.findMessagesByIds(req.UId, sId, msgIds, claims) {
+			messageMap[sId][message.MsgId] = message
+		}
+	}
+	dtoMentions := make([]*dto.UserMention, 0)
+	for _, mention := range mentions {
+		message, ok := messageMap[mention.SessionId][mention.MsgId]
+		if !ok { // 消息已删除或已过期
+			continue
+		}
+		dtoMentions = append(dtoMentions, &dto.UserMention{
+			SId:     mention.SessionId,
+			MsgId:   mention.MsgId,
+			FUid:    mention.FromUserId,
+			AtAll:   mention.AtAll == 1,
+			CTime:   mention.CreateTime,
+			Message: message,
+		})
+	}
+	return &dto.QueryUserMentionsRes{Data: dtoMentions}, nil
+}
@@ -0,0 +1,137 @@
+package logic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestParseAtUsers(t *testing.T) {
+	cases := []struct {
+		name      string
+		atUsers   *string
+		wantUIds  []int64
+		wantAtAll bool
+		wantErr   error
+	}{
+		{"nil", nil, []int64{}, false, nil},
+		{"empty", strPtr(""), []int64{}, false, nil},
+		{"hash separated", strPtr("1#2#3"), []int64{1, 2, 3}, false, nil},
+		{"comma and at prefix", strPtr("@1, @2"), []int64{1, 2}, false, nil},
+		{"at all", strPtr("@all"), []int64{}, true, nil},
+		{"at all with users", strPtr("all#5"), []int64{5}, true, nil},
+		{"not a number", strPtr("1#abc"), nil, false, errorx.ErrMentionInvalid},
+		{"zero uid", strPtr("0"), nil, false, errorx.ErrMentionInvalid},
+		{"negative uid", strPtr("-3"), nil, false, errorx.ErrMentionInvalid},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			uIds, atAll, err := parseAtUsers(c.atUsers)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("parseAtUsers() err = %v, want %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(uIds, c.wantUIds) || atAll != c.wantAtAll {
+				t.Errorf("parseAtUsers() = %v %v, want %v %v", uIds, atAll, c.wantUIds, c.wantAtAll)
+			}
+		})
+	}
+}
+
+func TestIsUserMentioned(t *testing.T) {
+	cases := []struct {
+		name    string
+		atUsers *string
+		uId     int64
+		want    bool
+	}{
+		{"nil", nil, 1, false},
+		{"mentioned", strPtr("1#2"), 2, true},
+		{"not mentioned", strPtr("1#2"), 3, false},
+		{"at all", strPtr("@all"), 3, true},
+		{"invalid", strPtr("2#x"), 2, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isUserMentioned(c.atUsers, c.uId); got != c.want {
+				t.Errorf("isUserMentioned() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMergeUserMentions(t *testing.T) {
+	mention := func(msgId, cTime int64) *model.UserMention {
+		return &model.UserMention{MsgId: msgId, CreateTime: cTime}
+	}
+	msgIds := func(mentions []*model.UserMention) []int64 {
+		ids := make([]int64, 0, len(mentions))
+		for _, m := range mentions {
+			ids = append(ids, m.MsgId)
+		}
+		return ids
+	}
+	cases := []struct {
+		name          string
+		userMentions  []*model.UserMention
+		atAllMentions []*model.UserMention
+		count         int
+		want          []int64
+	}{
+		{"empty", nil, nil, 10, []int64{}},
+		{"only user", []*model.UserMention{mention(2, 20), mention(1, 10)}, nil, 10, []int64{2, 1}},
+		{"interleaved", []*model.UserMention{mention(3, 30), mention(1, 10)}, []*model.UserMention{mention(4, 40), mention(2, 20)}, 10, []int64{4, 3, 2, 1}},
+		{"trim to count", []*model.UserMention{mention(3, 30), mention(1, 10)}, []*model.UserMention{mention(4, 40), mention(2, 20)}, 3, []int64{4, 3, 2}},
+		{"same time keeps user first", []*model.UserMention{mention(1, 10)}, []*model.UserMention{mention(2, 10)}, 10, []int64{1, 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := msgIds(mergeUserMentions(c.userMentions, c.atAllMentions, c.count))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("mergeUserMentions() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestOfflinePushReceivers(t *testing.T) {
+	silenced := model.SilenceBitInUserSessionStatus
+	receivers := []*model.SessionUser{
+		{UserId: 1},
+		{UserId: 2, Status: silenced},
+		{UserId: 3, Status: silenced},
+		{UserId: 4},
+	}
+	cases := []struct {
+		name        string
+		atUsers     *string
+		offlineUIds []int64
+		want        []int64
+	}{
+		{"no mention skips silenced", nil, []int64{1, 2, 3, 4}, []int64{1, 4}},
+		{"mentioned silenced member", strPtr("3"), []int64{1, 2, 3, 4}, []int64{1, 3, 4}},
+		{"at all", strPtr("@all"), []int64{1, 2, 3, 4}, []int64{1, 3, 4}},
+		{"only offline members", strPtr("3"), []int64{3, 4}, []int64{3, 4}},
+		{"sender mention ignored", strPtr("2"), []int64{2, 3}, []int64{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := dto.SendMessageReq{FUid: 2, AtUsers: c.atUsers}
+			_, offlinePushUIds := (&MessageLogic{}).splitReceivers(receivers, req)
+			got := offlinePushReceivers(c.offlineUIds, offlinePushUIds)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("offline push receivers = %v, want %v", got, c.want)
+			}
+		})
+	}
+	if got := offlinePushReceivers([]int64{1, 2}, nil); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("offlinePushReceivers without filter = %v, want [1 2]", got)
+	}
+}
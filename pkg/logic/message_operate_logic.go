@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"encoding/json"
 	"github.com/sirupsen/logrus"
 	baseDto "github.com/thk-im/thk-im-base-server/dto"
 	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
@@ -9,8 +10,29 @@ import (
 	"time"
 )
 
+const (
+	revokeAuditsMaxCount = 100
+)
+
+// AckUserMessages 推进当前设备的同步游标, 消息上的ack标记仅用于展示, 不再决定是否重新下发;
+// 超级群消息不写入用户消息表, ack推进成员的已读游标
 func (l *MessageLogic) AckUserMessages(req dto.AckUserMessagesReq, claims baseDto.ThkClaims) error {
-	err := l.appCtx.UserMessageModel().AckUserMessages(req.UId, req.SId, req.MsgIds)
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil {
+		return errorx.ErrSessionInvalid
+	}
+	if session.Type == model.SuperGroupSessionType {
+		return l.advanceReadCursor(session, req.UId, req.MsgIds, claims)
+	}
+	userMessages, err := l.appCtx.UserMessageModel().FindUserMessages(req.UId, req.SId, req.MsgIds)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AckUserMessages err:%v, %v", req, err)
+		return err
+	}
+	if err = l.advanceDeviceCursor(req.UId, req.SId, userMessages, claims); err != nil {
+		return err
+	}
+	err = l.appCtx.UserMessageModel().AckUserMessages(req.UId, req.SId, req.MsgIds)
 	if err != nil {
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AckUserMessages err:%v, %v", req, err)
 	}
@@ -23,40 +45,46 @@ func (l *MessageLogic) ReadUserMessages(req dto.ReadUserMessageReq, claims baseD
 		return errorx.ErrSessionInvalid
 	}
 	if session.Type == model.SuperGroupSessionType {
-		// 更新session的update_time，客户端同步消息时超级群消息时间小于update_time时认为已读
-		return l.appCtx.UserSessionModel().UpdateUserSession([]int64{req.UId}, session.Id, nil,
-			nil, nil, nil, nil, nil, nil, nil, nil, nil,
-		)
+		return l.advanceReadCursor(session, req.UId, req.MsgIds, claims)
 	} else {
+		// 设置已读前查询, 用于判断哪些消息是本次新读的
+		userMessages, err := l.appCtx.UserMessageModel().FindUserMessages(req.UId, req.SId, req.MsgIds)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReadUserMessages err:%v, %v", req, err)
+			return err
+		}
 		errUpdate := l.appCtx.UserMessageModel().UpdateUserMessage(req.UId, req.SId, req.MsgIds, model.MsgStatusRead, nil)
 		if errUpdate != nil {
 			return errUpdate
 		}
-		if session.FunctionFlag&dto.FuncReadFlag > 0 {
-			if userMessages, err := l.appCtx.UserMessageModel().FindUserMessages(req.UId, req.SId, req.MsgIds); err == nil {
-				for _, userMessage := range userMessages {
-					if userMessage.MsgId == 0 {
-						return errorx.ErrSessionMessageInvalid
-					}
-					if userMessage.MsgType < 0 || userMessage.Status&model.MsgStatusRead == 1 { // 小于0的类型消息为状态操作消息或者已经是已读了，不需要发送已读
-						continue
-					}
-					sendMessageReq := dto.SendMessageReq{
-						CId:       l.genClientId(),
-						SId:       req.SId,
-						Type:      model.MsgTypeRead,
-						FUid:      req.UId,
-						CTime:     time.Now().UnixMilli(),
-						RMsgId:    &userMessage.MsgId,
-						Receivers: []int64{userMessage.FromUserId, req.UId}, // 发送给对方和自己
-					}
-					// 对消息发件人发送已读消息
-					if _, err = l.SendUserMessage(session, sendMessageReq, claims); err != nil {
-						l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReadUserMessages err:%v, %v", req, err)
-					}
+		l.decrUnreadCount(req.UId, req.SId, userMessages, claims)
+		l.startBurnAfterReadCountdown(req.UId, req.SId, userMessages, claims)
+		if session.Type == model.GroupSessionType {
+			// 群聊聚合已读数, 避免每个读者都产生一条已读消息
+			if session.FunctionFlag&dto.FuncReadFlag > 0 {
+				l.recordGroupMessageReads(req.UId, req.SId, userMessages, claims)
+			}
+		} else if session.FunctionFlag&dto.FuncReadFlag > 0 {
+			for _, userMessage := range userMessages {
+				if userMessage.MsgId == 0 {
+					return errorx.ErrSessionMessageInvalid
+				}
+				if userMessage.MsgType < 0 || userMessage.Status&model.MsgStatusServerRead > 0 { // 小于0的类型消息为状态操作消息或者已经是已读了，不需要发送已读
+					continue
+				}
+				sendMessageReq := dto.SendMessageReq{
+					CId:       l.genClientId(),
+					SId:       req.SId,
+					Type:      model.MsgTypeRead,
+					FUid:      req.UId,
+					CTime:     time.Now().UnixMilli(),
+					RMsgId:    &userMessage.MsgId,
+					Receivers: []int64{userMessage.FromUserId, req.UId}, // 发送给对方和自己
+				}
+				// 对消息发件人发送已读消息
+				if _, err = l.SendUserMessage(session, sendMessageReq, claims); err != nil {
+					l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReadUserMessages err:%v, %v", req, err)
 				}
-			} else {
-				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReadUserMessages err:%v, %v", req, err)
 			}
 		}
 	}
@@ -68,62 +96,149 @@ func (l *MessageLogic) RevokeUserMessage(req dto.RevokeUserMessageReq, claims ba
 	if errSession != nil {
 		return errorx.ErrSessionInvalid
 	}
+	userSession, errUserSession := l.findMemberUserSession(req.UId, req.SId, claims)
+	if errUserSession != nil {
+		return errUserSession
+	}
+	var (
+		fromUId    int64
+		msgType    int
+		deleted    int8
+		content    string
+		replyMsgId *int64
+	)
 	if session.Type == model.SuperGroupSessionType {
-		if sessionMessage, err := l.appCtx.SessionMessageModel().FindSessionMessage(req.SId, req.MsgId, req.UId); err == nil {
-			if sessionMessage.SessionId == 0 {
-				return errorx.ErrSessionMessageInvalid
-			}
-			if sessionMessage.MsgType < 0 { // 小于0的类型消息为状态操作消息，不能重新编辑
-				return errorx.ErrMessageTypeNotSupport
-			}
-			if sessionMessage.Deleted == 1 { // 被删除了则不做处理
-				return nil
-			}
-			sendMessageReq := dto.SendMessageReq{
-				CId:    l.genClientId(),
-				SId:    req.SId,
-				Type:   model.MsgTypeRevoke,
-				FUid:   req.UId,
-				CTime:  time.Now().UnixMilli(),
-				RMsgId: &req.MsgId,
-			} // 发送给session下的所有人
-			if _, err = l.SendMessage(sendMessageReq, claims); err != nil {
-				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeSessionMsg err:%v, %v", req, err)
-				return err
-			}
-			return nil
-		} else {
+		sessionMessage, err := l.appCtx.SessionMessageModel().FindSessionMessageByMsgId(req.SId, req.MsgId)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeSessionMsg err:%v, %v", req, err)
 			return err
 		}
+		if sessionMessage.SessionId == 0 {
+			return errorx.ErrSessionMessageInvalid
+		}
+		fromUId = sessionMessage.FromUserId
+		msgType, deleted, content = sessionMessage.MsgType, sessionMessage.Deleted, sessionMessage.MsgContent
+		replyMsgId = sessionMessage.ReplyMsgId
 	} else {
-		if userMessage, err := l.appCtx.UserMessageModel().FindUserMessage(req.UId, req.SId, req.MsgId); err == nil {
-			if userMessage.SessionId == 0 {
-				return errorx.ErrSessionMessageInvalid
-			}
-			if userMessage.MsgType < 0 { // 小于0的类型消息为状态操作消息，不能重新编辑
-				return errorx.ErrMessageTypeNotSupport
-			}
-			if userMessage.Deleted == 1 { // 被删除了则不做处理
-				return nil
-			}
-			sendMessageReq := dto.SendMessageReq{
-				CId:    l.genClientId(),
-				SId:    req.SId,
-				Type:   model.MsgTypeRevoke,
-				FUid:   req.UId,
-				CTime:  time.Now().UnixMilli(),
-				RMsgId: &req.MsgId,
-			} // 发送给session下的所有人
-			if _, err = l.SendMessage(sendMessageReq, claims); err != nil {
-				l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeUserMessage err:%v, %v", req, err)
-				return err
-			}
-			return nil
-		} else {
+		userMessage, err := l.appCtx.UserMessageModel().FindUserMessage(req.UId, req.SId, req.MsgId)
+		if err != nil {
 			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeUserMessage err:%v, %v", req, err)
 			return err
 		}
+		if userMessage.SessionId == 0 {
+			return errorx.ErrSessionMessageInvalid
+		}
+		fromUId = userMessage.FromUserId
+		msgType, deleted, content = userMessage.MsgType, userMessage.Deleted, userMessage.MsgContent
+		replyMsgId = userMessage.ReplyMsgId
+	}
+	if msgType < 0 { // 小于0的类型消息为状态操作消息，不能撤回
+		return errorx.ErrMessageTypeNotSupport
+	}
+	if deleted == 1 { // 被删除了则不做处理
+		return nil
+	}
+	// 管理员及以上角色可以撤回角色比自己低的成员的消息且不受时间限制, 普通成员只能在时间窗口内撤回自己的消息
+	isAdmin := userSession.Role >= model.SessionAdmin
+	if fromUId != req.UId {
+		if !isAdmin {
+			return errorx.ErrRevokeForbidden
+		}
+		if errRole := l.checkRevokeRole(req.SId, fromUId, userSession.Role, claims); errRole != nil {
+			return errRole
+		}
+	}
+	if !isAdmin {
+		// 发送时间以消息id中的服务端时间为准, 客户端时间可能被篡改
+		limitMs := l.appCtx.MsgApiConfig().IM.RevokeTimeLimitMs(session.Type)
+		if limitMs > 0 && time.Now().UnixMilli()-model.MsgIdTime(req.MsgId) > limitMs {
+			return errorx.ErrRevokeTimeExceeded
+		}
 	}
+
+	if fromUId != req.UId {
+		audit := &model.MessageRevokeAudit{
+			SessionId:    req.SId,
+			MsgId:        req.MsgId,
+			FromUserId:   fromUId,
+			OperatorId:   req.UId,
+			OperatorRole: userSession.Role,
+			MsgContent:   content,
+			CreateTime:   time.Now().UnixMilli(),
+		}
+		if err := l.appCtx.MessageRevokeAuditModel().Insert(audit); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeUserMessage err:%v, %v", req, err)
+			return err
+		}
+	}
+
+	body, errBody := json.Marshal(&dto.RevokeMessageBody{FUid: fromUId, OperatorId: req.UId, OperatorRole: userSession.Role})
+	if errBody != nil {
+		return errBody
+	}
+	sendMessageReq := dto.SendMessageReq{
+		CId:    l.genClientId(),
+		SId:    req.SId,
+		Type:   model.MsgTypeRevoke,
+		FUid:   req.UId,
+		CTime:  time.Now().UnixMilli(),
+		Body:   string(body),
+		RMsgId: &req.MsgId,
+	} // 发送给session下的所有人
+	if _, err := l.sendMessage(sendMessageReq, false, claims); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("RevokeUserMessage err:%v, %v", req, err)
+		return err
+	}
+	l.revokeLastMessage(session, req.MsgId, claims)
+	l.unindexMessages(req.SId, []int64{req.MsgId}, 0, 0, claims)
+	if l.isThreadReplyMessage(msgType, replyMsgId) {
+		l.revertThreadReplies(req.SId, map[int64]int{*replyMsgId: 1}, claims)
+	}
+	return nil
+}
+
+// checkRevokeRole 撤回他人消息时操作人角色需要高于消息发送人当前的角色, 已退出会话的成员和系统消息不限制
+func (l *MessageLogic) checkRevokeRole(sId, fromUId int64, operatorRole int, claims baseDto.ThkClaims) error {
+	if fromUId <= 0 {
+		return nil
+	}
+	sessionUser, err := l.appCtx.SessionUserModel().FindSessionUser(sId, fromUId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkRevokeRole %d %d, %v", sId, fromUId, err)
+		return err
+	}
+	if sessionUser.UserId > 0 && sessionUser.Deleted == 0 && sessionUser.Role >= operatorRole {
+		return errorx.ErrRevokeForbidden
+	}
+	return nil
+}
+
+// QueryRevokeAudits 查询会话中撤回他人消息的审计记录
+func (l *MessageLogic) QueryRevokeAudits(req dto.QueryRevokeAuditsReq, claims baseDto.ThkClaims) (*dto.QueryRevokeAuditsRes, error) {
+	if req.Count <= 0 || req.Count > revokeAuditsMaxCount {
+		req.Count = revokeAuditsMaxCount
+	}
+	if req.CTime <= 0 {
+		req.CTime = time.Now().UnixMilli()
+	}
+	audits, err := l.appCtx.MessageRevokeAuditModel().FindRevokeAudits(req.SId, req.CTime, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryRevokeAudits %v, %v", req, err)
+		return nil, err
+	}
+	dtoAudits := make([]*dto.RevokeAudit, 0, len(audits))
+	for _, audit := range audits {
+		dtoAudits = append(dtoAudits, &dto.RevokeAudit{
+			SId:          audit.SessionId,
+			MsgId:        audit.MsgId,
+			FUid:         audit.FromUserId,
+			OperatorId:   audit.OperatorId,
+			OperatorRole: audit.OperatorRole,
+			Body:         audit.MsgContent,
+			CTime:        audit.CreateTime,
+		})
+	}
+	return &dto.QueryRevokeAuditsRes{Data: dtoAudits}, nil
 }
 
 func (l *MessageLogic) ReeditUserMessage(req dto.ReeditUserMessageReq, claims baseDto.ThkClaims) error {
@@ -131,46 +246,150 @@ func (l *MessageLogic) ReeditUserMessage(req dto.ReeditUserMessageReq, claims ba
 	if errSession != nil {
 		return errorx.ErrSessionInvalid
 	}
+	var oldContent string
+	var msgType int
+	var extData *string
 	if session.Type == model.SuperGroupSessionType {
 		sessionMessage, err := l.appCtx.SessionMessageModel().FindSessionMessage(req.SId, req.MsgId, req.UId)
 		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v, %v", req, err)
 			return err
 		}
-		if sessionMessage == nil {
+		if sessionMessage.MsgId == 0 || sessionMessage.Deleted == 1 {
 			return errorx.ErrSessionMessageInvalid
 		}
+		if sessionMessage.MsgType < 0 { // 小于0的类型消息为状态操作消息，不能重新编辑
+			return errorx.ErrMessageTypeNotSupport
+		}
+		oldContent = sessionMessage.MsgContent
+		msgType = sessionMessage.MsgType
+		extData = sessionMessage.ExtData
 	} else {
 		userMessage, err := l.appCtx.UserMessageModel().FindUserMessage(req.UId, req.SId, req.MsgId)
-		if err == nil {
-			if userMessage.SessionId == 0 || userMessage.Deleted == 1 {
-				return errorx.ErrSessionMessageInvalid
-			}
-			if userMessage.MsgType < 0 { // 小于0的类型消息为状态操作消息，不能重新编辑
-				return errorx.ErrMessageTypeNotSupport
-			}
-		} else {
+		if err != nil {
 			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v, %v", req, err)
+			return err
 		}
+		if userMessage.SessionId == 0 || userMessage.Deleted == 1 || userMessage.FromUserId != req.UId {
+			return errorx.ErrSessionMessageInvalid
+		}
+		if userMessage.MsgType < 0 { // 小于0的类型消息为状态操作消息，不能重新编辑
+			return errorx.ErrMessageTypeNotSupport
+		}
+		oldContent = userMessage.MsgContent
+		msgType = userMessage.MsgType
+		extData = userMessage.ExtData
+	}
+
+	// 编辑后的内容和发送消息一样需要经过内容检测, 保存/索引/推送的都是脱敏后的内容
+	userSession, errUserSession := l.findMemberUserSession(req.UId, req.SId, claims)
+	if errUserSession != nil {
+		return errUserSession
+	}
+	// 编辑后的内容按原消息类型的schema校验, 与发送消息返回相同的错误
+	schemaReq := dto.SendMessageReq{SId: req.SId, Type: msgType, FUid: req.UId, Body: req.Content, ExtData: extData}
+	if errSchema := l.checkMessageSchema(schemaReq, claims); errSchema != nil {
+		return errSchema
+	}
+	// 编辑通知消息不再限流, 在修改存储前按一次发送检查限流, 避免被限流时内容已修改却没有通知成员
+	if errLimit := l.checkSendRateLimit(session, req.UId, claims); errLimit != nil {
+		return errLimit
+	}
+	content, reviewCategories, errCheck := l.checkMessageContent(session, userSession, req.UId, msgType, req.Content, claims)
+	if errCheck != nil {
+		return errCheck
+	}
+	req.Content = content
+
+	// 保存编辑前的版本
+	history := &model.MessageEditHistory{
+		SessionId:  req.SId,
+		MsgId:      req.MsgId,
+		UserId:     req.UId,
+		MsgContent: oldContent,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	if err := l.appCtx.MessageEditHistoryModel().Insert(history); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v, %v", req, err)
+		return err
+	}
+
+	// 更新已存储的消息内容, 超级群只存一份session_message, 其他会话更新所有成员的消息副本
+	if session.Type == model.SuperGroupSessionType {
+		if _, err := l.appCtx.SessionMessageModel().UpdateSessionMessageContent(req.SId, req.MsgId, req.UId, req.Content); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v, %v", req, err)
+			return err
+		}
+	} else {
+		sessionUsers := l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(req.SId, 0, nil)
+		uIds := make([]int64, 0, len(sessionUsers))
+		for _, sessionUser := range sessionUsers {
+			uIds = append(uIds, sessionUser.UserId)
+		}
+		if err := l.appCtx.UserMessageModel().UpdateUserMessagesContent(uIds, req.SId, req.MsgId, req.Content); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v, %v", req, err)
+			return err
+		}
+	}
+
+	l.reeditLastMessage(session, req.MsgId, msgType, req.Content, claims)
+	l.reindexMessage(req.SId, req.MsgId, req.Content, claims)
+	if len(reviewCategories) > 0 {
+		l.addMessageReview(req.SId, req.MsgId, req.UId, req.Content, reviewCategories, claims)
 	}
 
 	sendMessageReq := dto.SendMessageReq{
-		CId:   l.genClientId(),
-		SId:   req.SId,
-		Type:  model.MsgTypeReedit,
-		FUid:  req.UId,
-		CTime: time.Now().UnixMilli(),
-		Body:  req.Content,
-	}
-	// 发送给session下的所有人
-	if _, err := l.SendMessage(sendMessageReq, claims); err != nil {
+		CId:    l.genClientId(),
+		SId:    req.SId,
+		Type:   model.MsgTypeReedit,
+		FUid:   req.UId,
+		CTime:  time.Now().UnixMilli(),
+		Body:   req.Content,
+		RMsgId: &req.MsgId,
+	}
+	// 发送给session下的所有人, 发送限流已在修改存储前检查
+	if _, err := l.sendMessage(sendMessageReq, false, claims); err != nil {
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ReeditUserMessage err:%v %v", req, err)
 		return err
 	}
 	return nil
 }
 
+func (l *MessageLogic) GetMessageEditHistory(req dto.GetMessageEditHistoryReq, claims baseDto.ThkClaims) (*dto.GetMessageEditHistoryRes, error) {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id == 0 {
+		return nil, errorx.ErrSessionInvalid
+	}
+	if req.UId > 0 {
+		if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+			return nil, err
+		}
+		if err := l.checkMessageVisible(session, req.UId, req.MsgId); err != nil {
+			return nil, err
+		}
+	}
+	histories, err := l.appCtx.MessageEditHistoryModel().FindHistories(req.SId, req.MsgId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessageEditHistory err:%v, %v", req, err)
+		return nil, err
+	}
+	dtoHistories := make([]*dto.MessageEditHistory, 0, len(histories))
+	for _, history := range histories {
+		dtoHistories = append(dtoHistories, &dto.MessageEditHistory{
+			MsgId: history.MsgId,
+			UId:   history.UserId,
+			Body:  history.MsgContent,
+			CTime: history.CreateTime,
+		})
+	}
+	return &dto.GetMessageEditHistoryRes{Data: dtoHistories}, nil
+}
+
 func (l *MessageLogic) ForwardUserMessages(req dto.ForwardUserMessageReq, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
-	if len(req.ForwardClientIds) > 0 && len(req.ForwardClientIds) > 0 {
+	if err := l.checkForwardable(req.FUid, req.ForwardSId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	if len(req.ForwardFromUIds) > 0 && len(req.ForwardClientIds) > 0 {
 		ids, err := l.appCtx.SessionObjectModel().AddSessionObjects(req.ForwardSId, req.ForwardFromUIds, req.ForwardClientIds, req.FUid, req.CId, req.SId)
 		if err != nil {
 			return nil, err
@@ -184,6 +403,21 @@ func (l *MessageLogic) ForwardUserMessages(req dto.ForwardUserMessageReq, claims
 	return l.SendMessage(req.SendMessageReq, claims)
 }
 
+// checkForwardable 被转发消息的来源会话和目标会话都需要开启转发功能, 系统转发和未设置功能位(为0)的会话不受限制
+func (l *MessageLogic) checkForwardable(fUid, fromSId, toSId int64, claims baseDto.ThkClaims) error {
+	for _, sId := range []int64{fromSId, toSId} {
+		session, errSession := l.appCtx.SessionModel().FindSession(sId)
+		if errSession != nil || session.Id <= 0 {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkForwardable FindSession %d, %v", sId, errSession)
+			return errorx.ErrSessionInvalid
+		}
+		if fUid > 0 && session.FunctionFlag != 0 && session.FunctionFlag&dto.FuncForwardFlag == 0 {
+			return errorx.ErrMessageTypeNotSupport
+		}
+	}
+	return nil
+}
+
 func (l *MessageLogic) genClientId() int64 {
 	return l.appCtx.SnowflakeNode().Generate().Int64()
 }
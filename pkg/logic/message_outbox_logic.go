@@ -0,0 +1,124 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	outboxRelayDelayMs    = 5 * 1000 // 新写入的记录先由发送流程直接投递, 超过该时间未投递成功再由relay处理
+	outboxRelayBatchCount = 100
+	outboxMaxRetryCount   = 10
+	outboxRetryIntervalMs = 5 * 1000
+	outboxDeliveredKeepMs = 24 * 3600 * 1000 // 投递成功的记录保留时间
+	outboxCleanBatchCount = 500
+)
+
+func (l *MessageLogic) newMessageOutbox(dtoMsg *dto.Message, sessionType int, receivers, offlineReceivers []int64) (*model.MessageOutbox, error) {
+	msgJson, err := json.Marshal(dtoMsg)
+	if err != nil {
+		return nil, err
+	}
+	receiversJson, err := json.Marshal(receivers)
+	if err != nil {
+		return nil, err
+	}
+	offlineReceiversJson, err := json.Marshal(offlineReceivers)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	return &model.MessageOutbox{
+		SessionId:        dtoMsg.SId,
+		MsgId:            dtoMsg.MsgId,
+		SessionType:      sessionType,
+		MsgBody:          string(msgJson),
+		Receivers:        string(receiversJson),
+		OfflineReceivers: string(offlineReceiversJson),
+		Status:           model.OutboxStatusPending,
+		NextRetryTime:    now + outboxRelayDelayMs,
+		CreateTime:       now,
+		UpdateTime:       now,
+	}, nil
+}
+
+// publishOutboxMessage 消息入库后立即投递, 投递失败时保留待投递记录, 由RelayMessageOutboxes重试
+func (l *MessageLogic) publishOutboxMessage(outbox *model.MessageOutbox, dtoMsg *dto.Message, receivers, offlineReceivers []int64, claims baseDto.ThkClaims) ([]int64, []int64) {
+	onlineUIds, offlineUIds, err := l.publishSendMessageEvents(dtoMsg, outbox.SessionType, receivers, offlineReceivers, claims)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("publishOutboxMessage %d %d %v", outbox.SessionId, outbox.MsgId, err)
+		return nil, nil
+	}
+	if err = l.appCtx.MessageOutboxModel().UpdateOutboxStatus(outbox.SessionId, outbox.Id, model.OutboxStatusDelivered, outbox.RetryCount, outbox.NextRetryTime); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("publishOutboxMessage %d %d %v", outbox.SessionId, outbox.MsgId, err)
+	}
+	return onlineUIds, offlineUIds
+}
+
+// RelayMessageOutboxes 投递所有分表中到期未投递的消息, 并清理已投递的记录
+func (l *MessageLogic) RelayMessageOutboxes() {
+	for shard := int64(0); shard < l.appCtx.MessageOutboxModel().Shards(); shard++ {
+		l.relayMessageOutboxes(shard)
+	}
+}
+
+func (l *MessageLogic) relayMessageOutboxes(shard int64) {
+	claims := baseDto.ThkClaims{}
+	lockKey := fmt.Sprintf(messageOutboxRelayLockKey, l.appCtx.Config().Name, shard)
+	locker := l.appCtx.NewLocker(lockKey, 0, 30*1000)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+	defer l.cleanDeliveredOutboxes(shard)
+	outboxes, err := l.appCtx.MessageOutboxModel().FindPendingOutboxes(shard, time.Now().UnixMilli(), outboxRelayBatchCount)
+	if err != nil {
+		l.appCtx.Logger().Errorf("relayMessageOutboxes %d %v", shard, err)
+		return
+	}
+	for _, outbox := range outboxes {
+		dtoMsg := &dto.Message{}
+		if err = json.Unmarshal([]byte(outbox.MsgBody), dtoMsg); err != nil {
+			l.appCtx.Logger().Errorf("relayMessageOutboxes %d %d %v", outbox.SessionId, outbox.MsgId, err)
+			_ = l.appCtx.MessageOutboxModel().UpdateOutboxStatus(outbox.SessionId, outbox.Id, model.OutboxStatusFailed, outbox.RetryCount, outbox.NextRetryTime)
+			continue
+		}
+		receivers := make([]int64, 0)
+		var offlineReceivers []int64 // 为null时不过滤离线推送的用户
+		_ = json.Unmarshal([]byte(outbox.Receivers), &receivers)
+		_ = json.Unmarshal([]byte(outbox.OfflineReceivers), &offlineReceivers)
+		status := model.OutboxStatusDelivered
+		retryCount := outbox.RetryCount
+		nextRetryTime := outbox.NextRetryTime
+		if _, _, err = l.publishSendMessageEvents(dtoMsg, outbox.SessionType, receivers, offlineReceivers, claims); err != nil {
+			retryCount++
+			nextRetryTime = time.Now().UnixMilli() + int64(retryCount)*outboxRetryIntervalMs
+			status = model.OutboxStatusPending
+			if retryCount >= outboxMaxRetryCount {
+				status = model.OutboxStatusFailed
+			}
+			l.appCtx.Logger().Errorf("relayMessageOutboxes %d %d %d %v", outbox.SessionId, outbox.MsgId, retryCount, err)
+		}
+		if err = l.appCtx.MessageOutboxModel().UpdateOutboxStatus(outbox.SessionId, outbox.Id, status, retryCount, nextRetryTime); err != nil {
+			l.appCtx.Logger().Errorf("relayMessageOutboxes %d %d %v", outbox.SessionId, outbox.MsgId, err)
+		}
+	}
+}
+
+// cleanDeliveredOutboxes 每次最多清理一批投递成功且超过保留时间的记录, 未清理完的留到下次
+func (l *MessageLogic) cleanDeliveredOutboxes(shard int64) {
+	before := time.Now().UnixMilli() - outboxDeliveredKeepMs
+	if _, err := l.appCtx.MessageOutboxModel().DeleteDeliveredOutboxes(shard, before, outboxCleanBatchCount); err != nil {
+		l.appCtx.Logger().Errorf("cleanDeliveredOutboxes %d %v", shard, err)
+	}
+}
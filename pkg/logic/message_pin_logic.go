@@ -0,0 +1,119 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	baseErrorx "github.com/thk-im/thk-im-base-server/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+func (l *MessageLogic) PinSessionMessage(req dto.SessionPinReq, claims baseDto.ThkClaims) error {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("PinSessionMessage FindSession %v, %v", req, errSession)
+		return errorx.ErrSessionInvalid
+	}
+	if err := l.checkMessageVisible(session, req.UId, req.MsgId); err != nil {
+		return err
+	}
+
+	lockKey := fmt.Sprintf(sessionPinLockKey, l.appCtx.Config().Name, req.SId)
+	locker := l.appCtx.NewLocker(lockKey, 1000, 1000)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return baseErrorx.ErrServerBusy
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+
+	sessionPins, err := l.appCtx.SessionPinModel().FindSessionPins(req.SId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("PinSessionMessage %v, %v", req, err)
+		return err
+	}
+	// 重复置顶不受数量限制, 直接返回
+	for _, sessionPin := range sessionPins {
+		if sessionPin.MsgId == req.MsgId {
+			return nil
+		}
+	}
+	if len(sessionPins) >= l.appCtx.MsgApiConfig().IM.MaxPinMessage {
+		return errorx.ErrPinMessageReachLimit
+	}
+	sessionPin := &model.SessionPin{
+		SessionId:  req.SId,
+		MsgId:      req.MsgId,
+		UserId:     req.UId,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	affected, err := l.appCtx.SessionPinModel().PinMessage(sessionPin)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("PinSessionMessage %v, %v", req, err)
+		return err
+	}
+	// 重复置顶不再广播
+	if affected > 0 {
+		l.pubSessionPinEvent(req, dto.PinActionPin, claims)
+	}
+	return nil
+}
+
+func (l *MessageLogic) UnpinSessionMessage(req dto.SessionPinReq, claims baseDto.ThkClaims) error {
+	affected, err := l.appCtx.SessionPinModel().UnpinMessage(req.SId, req.MsgId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("UnpinSessionMessage %v, %v", req, err)
+		return err
+	}
+	if affected > 0 {
+		l.pubSessionPinEvent(req, dto.PinActionUnpin, claims)
+	}
+	return nil
+}
+
+func (l *MessageLogic) QuerySessionPins(sId, uId int64, claims baseDto.ThkClaims) (*dto.QuerySessionPinsRes, error) {
+	sessionPins, err := l.appCtx.SessionPinModel().FindSessionPins(sId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QuerySessionPins %d, %v", sId, err)
+		return nil, err
+	}
+	dtoPins := make([]*dto.SessionPin, 0)
+	if len(sessionPins) == 0 {
+		return &dto.QuerySessionPinsRes{Data: dtoPins}, nil
+	}
+	msgIds := make([]int64, 0, len(sessionPins))
+	for _, sessionPin := range sessionPins {
+		msgIds = append(msgIds, sessionPin.MsgId)
+	}
+	messageMap := make(map[int64]*dto.Message)
+	for _, message := range l.findMessagesByIds(uId, sId, msgIds, claims) {
+		messageMap[message.MsgId] = message
+	}
+	for _, sessionPin := range sessionPins {
+		dtoPins = append(dtoPins, &dto.SessionPin{
+			MsgId:   sessionPin.MsgId,
+			UId:     sessionPin.UserId,
+			CTime:   sessionPin.CreateTime,
+			Message: messageMap[sessionPin.MsgId],
+		})
+	}
+	return &dto.QuerySessionPinsRes{Data: dtoPins}, nil
+}
+
+// pubSessionPinEvent 在线推送置顶变更给会话成员
+func (l *MessageLogic) pubSessionPinEvent(req dto.SessionPinReq, action int, claims baseDto.ThkClaims) {
+	body, err := json.Marshal(&dto.SessionPinBody{Action: action})
+	if err == nil {
+		err = l.pubOperationMessageEvent(req.SId, req.UId, model.MsgTypePin, string(body), req.MsgId, nil, claims)
+	}
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pubSessionPinEvent %v, %v", req, err)
+	}
+}
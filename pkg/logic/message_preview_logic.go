@@ -0,0 +1,142 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+const (
+	lastMessageBodyMaxLen = 64
+)
+
+// lastMessageBody 按消息类型生成快照内容, 文本类消息截取正文, 媒体类消息使用占位文案, 其他自定义类型由客户端按类型展示
+func lastMessageBody(msgType int, body string) string {
+	switch msgType {
+	case model.MsgTypeText, model.MsgTypeRichText:
+		bodyRunes := []rune(body)
+		if len(bodyRunes) > lastMessageBodyMaxLen {
+			body = string(bodyRunes[:lastMessageBodyMaxLen])
+		}
+		return body
+	case model.MsgTypeEmoji:
+		return "[表情]"
+	case model.MsgTypeAudio:
+		return "[语音]"
+	case model.MsgTypeImage:
+		return "[图片]"
+	case model.MsgTypeVideo:
+		return "[视频]"
+	case model.MsgTypeRecord:
+		return "[聊天记录]"
+	default:
+		return ""
+	}
+}
+
+func newLastMessage(msgId int64, msgType int, fUid int64, body string, cTime int64) *model.LastMessage {
+	return &model.LastMessage{
+		MsgId:      msgId,
+		MsgType:    msgType,
+		FromUserId: fUid,
+		Body:       lastMessageBody(msgType, body),
+		CreateTime: cTime,
+	}
+}
+
+// updateLastMessage 发送消息后更新会话最后一条消息快照, 超级群记录在session上避免写扩散
+func (l *MessageLogic) updateLastMessage(session *model.Session, req dto.SendMessageReq, msgId, cTime int64, receiverUIds []int64, claims baseDto.ThkClaims) {
+	if !isUnreadCounted(req.Type) {
+		return
+	}
+	lastMessage := newLastMessage(msgId, req.Type, req.FUid, req.Body, cTime)
+	if session.Type == model.SuperGroupSessionType {
+		if err := l.appCtx.SessionModel().UpdateLastMessage(session.Id, lastMessage); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateLastMessage %v, %v", req, err)
+		}
+		return
+	}
+	uIds := receiverUIds
+	if req.FUid > 0 {
+		uIds = append([]int64{req.FUid}, receiverUIds...)
+	}
+	if err := l.appCtx.UserSessionModel().UpdateLastMessage(uIds, session.Id, lastMessage); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateLastMessage %v, %v", req, err)
+	}
+}
+
+// revokeLastMessage 被撤回的消息是最后一条消息时更新快照
+func (l *MessageLogic) revokeLastMessage(session *model.Session, msgId int64, claims baseDto.ThkClaims) {
+	if session.Type == model.SuperGroupSessionType {
+		if err := l.appCtx.SessionModel().RevokeLastMessage(session.Id, msgId); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("revokeLastMessage %d %d, %v", session.Id, msgId, err)
+		}
+		return
+	}
+	if err := l.appCtx.UserSessionModel().RevokeLastMessage(session.Id, msgId); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("revokeLastMessage %d %d, %v", session.Id, msgId, err)
+	}
+}
+
+// reeditLastMessage 被重新编辑的消息是最后一条消息时更新快照内容
+func (l *MessageLogic) reeditLastMessage(session *model.Session, msgId int64, msgType int, content string, claims baseDto.ThkClaims) {
+	body := lastMessageBody(msgType, content)
+	if session.Type == model.SuperGroupSessionType {
+		if err := l.appCtx.SessionModel().UpdateLastMessageBody(session.Id, msgId, body); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("reeditLastMessage %d %d, %v", session.Id, msgId, err)
+		}
+		return
+	}
+	if err := l.appCtx.UserSessionModel().UpdateLastMessageBody(session.Id, msgId, body); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("reeditLastMessage %d %d, %v", session.Id, msgId, err)
+	}
+}
+
+// resetUserLastMessage 用户删除消息后, 如果最后一条消息被删除则回退到最新的未删除消息
+func (l *MessageLogic) resetUserLastMessage(uId, sId int64, claims baseDto.ThkClaims) {
+	userSession, err := l.appCtx.UserSessionModel().GetUserSession(uId, sId)
+	if err != nil || userSession.LastMsgId == 0 {
+		return
+	}
+	lastUserMessage, errMessage := l.appCtx.UserMessageModel().FindUserMessage(uId, sId, userSession.LastMsgId)
+	if errMessage != nil || (lastUserMessage.MsgId > 0 && lastUserMessage.Deleted == 0) {
+		return
+	}
+	var lastMessage *model.LastMessage
+	latest, errLatest := l.appCtx.UserMessageModel().FindLatestUserMessage(uId, sId)
+	if errLatest != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("resetUserLastMessage %d %d, %v", uId, sId, errLatest)
+		return
+	}
+	if latest.MsgId > 0 {
+		lastMessage = newLastMessage(latest.MsgId, latest.MsgType, latest.FromUserId, latest.MsgContent, latest.CreateTime)
+	}
+	if err = l.appCtx.UserSessionModel().ResetLastMessage(uId, sId, lastMessage); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("resetUserLastMessage %d %d, %v", uId, sId, err)
+	}
+}
+
+// resetSessionLastMessage 超级群删除消息后, 如果最后一条消息被删除则回退到最新的未删除消息
+func (l *MessageLogic) resetSessionLastMessage(sId int64, claims baseDto.ThkClaims) {
+	session, err := l.appCtx.SessionModel().FindSession(sId)
+	if err != nil || session.Type != model.SuperGroupSessionType || session.LastMsgId == 0 {
+		return
+	}
+	lastSessionMessage, errMessage := l.appCtx.SessionMessageModel().FindSessionMessageByMsgId(sId, session.LastMsgId)
+	if errMessage != nil || (lastSessionMessage.MsgId > 0 && lastSessionMessage.Deleted == 0) {
+		return
+	}
+	var lastMessage *model.LastMessage
+	latest, errLatest := l.appCtx.SessionMessageModel().FindLatestSessionMessage(sId)
+	if errLatest != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("resetSessionLastMessage %d, %v", sId, errLatest)
+		return
+	}
+	if latest.MsgId > 0 {
+		lastMessage = newLastMessage(latest.MsgId, latest.MsgType, latest.FromUserId, latest.MsgContent, latest.CreateTime)
+	}
+	if err = l.appCtx.SessionModel().ResetLastMessage(sId, lastMessage); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("resetSessionLastMessage %d, %v", sId, err)
+	}
+}
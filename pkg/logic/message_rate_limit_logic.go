@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"strconv"
+	"time"
+)
+
+const (
+	SendRateScopeUser          = "user"
+	SendRateScopeSession       = "session"
+	SendRateScopeUserInSession = "user_session"
+
+	maxRateLimitedQueryCount   = 100
+	sendRateLimitedCountExpire = 7 * 24 * time.Hour
+	sendRateLimitedDateLayout  = "20060102"
+
+	// 多个令牌桶要么同时扣减要么都不扣减, 返回{需等待毫秒数, 被限流的桶下标}, 未限流返回{0, 0}
+	// ARGV: 当前毫秒时间, 之后每个KEY依次对应 每秒令牌数, 桶容量
+	takeTokensScript = `local now = tonumber(ARGV[1]) ` +
+		`local tokens = {} ` +
+		`local retry, limited = 0, 0 ` +
+		`for i, key in ipairs(KEYS) do ` +
+		`local rate = tonumber(ARGV[i * 2]) ` +
+		`local burst = tonumber(ARGV[i * 2 + 1]) ` +
+		`local state = redis.call("HMGET", key, "t", "ts") ` +
+		`local t = tonumber(state[1]) or burst ` +
+		`local ts = tonumber(state[2]) or now ` +
+		`t = math.min(burst, t + math.max(0, now - ts) * rate / 1000) ` +
+		`if t < 1 then ` +
+		`local wait = math.ceil((1 - t) * 1000 / rate) ` +
+		`if wait > retry then retry, limited = wait, i end ` +
+		`end ` +
+		`tokens[i] = t ` +
+		`end ` +
+		`if retry > 0 then return {retry, limited} end ` +
+		`for i, key in ipairs(KEYS) do ` +
+		`local rate = tonumber(ARGV[i * 2]) ` +
+		`local burst = tonumber(ARGV[i * 2 + 1]) ` +
+		`redis.call("HSET", key, "t", tokens[i] - 1, "ts", now) ` +
+		`redis.call("PEXPIRE", key, math.ceil(burst * 1000 / rate) + 1000) ` +
+		`end ` +
+		`return {0, 0}`
+
+	// 归还takeTokensScript扣减的令牌, 用于后续的桶被限流时回滚, ARGV: 每个KEY对应的桶容量
+	refundTokensScript = `for i, key in ipairs(KEYS) do ` +
+		`local t = tonumber(redis.call("HGET", key, "t")) ` +
+		`if t then redis.call("HSET", key, "t", math.min(tonumber(ARGV[i]), t + 1)) end ` +
+		`end ` +
+		`return 0`
+)
+
+type sendRateBucket struct {
+	scope  string
+	key    string
+	target string
+	bucket *app.TokenBucket
+}
+
+// checkSendRateLimit 按发送人/会话/发送人在会话内三个维度令牌桶限流, redis不可用时放行;
+// 发送人的桶与会话相关的桶不在同一个slot, 分两次扣减, 后扣减的被限流时归还先扣减的令牌
+func (l *MessageLogic) checkSendRateLimit(session *model.Session, fUid int64, claims baseDto.ThkClaims) error {
+	rule := l.appCtx.MsgApiConfig().IM.SendRateLimitRule(session.Type)
+	if rule == nil {
+		return nil
+	}
+	name := l.appCtx.Config().Name
+	groups := [][]*sendRateBucket{
+		enabledSendRateBuckets(&sendRateBucket{
+			scope:  SendRateScopeUser,
+			key:    fmt.Sprintf(userSendRateKey, name, session.Type, fUid),
+			target: fmt.Sprintf("%d", fUid),
+			bucket: rule.User,
+		}),
+		enabledSendRateBuckets(&sendRateBucket{
+			scope:  SendRateScopeSession,
+			key:    fmt.Sprintf(sessionSendRateKey, name, session.Id),
+			target: fmt.Sprintf("%d", session.Id),
+			bucket: rule.Session,
+		}, &sendRateBucket{
+			scope:  SendRateScopeUserInSession,
+			key:    fmt.Sprintf(userSessionSendRateKey, name, session.Id, fUid),
+			target: fmt.Sprintf("%d:%d", fUid, session.Id),
+			bucket: rule.UserInSession,
+		}),
+	}
+	taken := make([][]*sendRateBucket, 0, len(groups))
+	for _, buckets := range groups {
+		if len(buckets) == 0 {
+			continue
+		}
+		retryAfter, limitedBucket := l.takeSendRateTokens(buckets, claims)
+		if limitedBucket == nil {
+			taken = append(taken, buckets)
+			continue
+		}
+		for _, takenBuckets := range taken {
+			l.refundSendRateTokens(takenBuckets, claims)
+		}
+		l.incrSendRateLimitedCount(limitedBucket, claims)
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("checkSendRateLimit limited %s %s %d", limitedBucket.scope, limitedBucket.target, retryAfter)
+		return errorx.NewRateLimitError(retryAfter)
+	}
+	return nil
+}
+
+func enabledSendRateBuckets(candidates ...*sendRateBucket) []*sendRateBucket {
+	buckets := make([]*sendRateBucket, 0, len(candidates))
+	for _, b := range candidates {
+		if b.bucket.Enabled() {
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets
+}
+
+// takeSendRateTokens 同一个slot内的桶同时扣减, 返回需等待毫秒数和被限流的桶, 未限流或redis出错时返回空
+func (l *MessageLogic) takeSendRateTokens(buckets []*sendRateBucket, claims baseDto.ThkClaims) (int64, *sendRateBucket) {
+	keys := make([]string, 0, len(buckets))
+	args := []interface{}{time.Now().UnixMilli()}
+	for _, b := range buckets {
+		keys = append(keys, b.key)
+		args = append(args, b.bucket.Rate, b.bucket.Burst)
+	}
+	result, err := l.appCtx.RedisCache().Eval(context.Background(), takeTokensScript, keys, args...).Int64Slice()
+	if err != nil || len(result) != 2 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("takeSendRateTokens %v %v %v", keys, result, err)
+		return 0, nil
+	}
+	retryAfter, limited := result[0], result[1]
+	if retryAfter <= 0 || limited <= 0 || int(limited) > len(buckets) {
+		return 0, nil
+	}
+	return retryAfter, buckets[limited-1]
+}
+
+func (l *MessageLogic) refundSendRateTokens(buckets []*sendRateBucket, claims baseDto.ThkClaims) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, len(buckets))
+	for _, b := range buckets {
+		keys = append(keys, b.key)
+		args = append(args, b.bucket.Burst)
+	}
+	if err := l.appCtx.RedisCache().Eval(context.Background(), refundTokensScript, keys, args...).Err(); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("refundSendRateTokens %v %v", keys, err)
+	}
+}
+
+// incrSendRateLimitedCount 按天按维度累计被限流次数, 用于查询被限流的用户/会话
+func (l *MessageLogic) incrSendRateLimitedCount(b *sendRateBucket, claims baseDto.ThkClaims) {
+	key := fmt.Sprintf(sendRateLimitedCountKey, l.appCtx.Config().Name, b.scope, time.Now().Format(sendRateLimitedDateLayout))
+	pipe := l.appCtx.RedisCache().Pipeline()
+	pipe.ZIncrBy(context.Background(), key, 1, b.target)
+	pipe.Expire(context.Background(), key, sendRateLimitedCountExpire)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("incrSendRateLimitedCount %s %s %v", key, b.target, err)
+	}
+}
+
+// QueryRateLimitedCounts 查询某天某个维度被限流次数最多的对象
+func (l *MessageLogic) QueryRateLimitedCounts(req dto.QueryRateLimitedReq, claims baseDto.ThkClaims) (*dto.QueryRateLimitedRes, error) {
+	if req.Count <= 0 || req.Count > maxRateLimitedQueryCount {
+		req.Count = maxRateLimitedQueryCount
+	}
+	if req.Date == "" {
+		req.Date = time.Now().Format(sendRateLimitedDateLayout)
+	}
+	key := fmt.Sprintf(sendRateLimitedCountKey, l.appCtx.Config().Name, req.Scope, req.Date)
+	members, err := l.appCtx.RedisCache().ZRevRangeWithScores(context.Background(), key, 0, int64(req.Count-1)).Result()
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryRateLimitedCounts %v, %v", req, err)
+		return nil, err
+	}
+	data := make([]*dto.RateLimitedCount, 0, len(members))
+	for _, member := range members {
+		target, _ := member.Member.(string)
+		data = append(data, &dto.RateLimitedCount{Target: target, Count: int64(member.Score)})
+	}
+	return &dto.QueryRateLimitedRes{Scope: req.Scope, Date: req.Date, Data: data}, nil
+}
+
+// RetryAfterSeconds 限流错误对应的Retry-After秒数, 非限流错误返回空
+func RetryAfterSeconds(err error) string {
+	var rateLimitErr *errorx.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return ""
+	}
+	return strconv.FormatInt((rateLimitErr.RetryAfter+999)/1000, 10)
+}
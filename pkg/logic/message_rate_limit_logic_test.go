@@ -0,0 +1,88 @@
+package logic
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
+)
+
+func TestEnabledSendRateBuckets(t *testing.T) {
+	enabled := &sendRateBucket{scope: SendRateScopeUser, bucket: &app.TokenBucket{Rate: 1, Burst: 1}}
+	cases := []struct {
+		name       string
+		candidates []*sendRateBucket
+		want       []*sendRateBucket
+	}{
+		{"none", nil, []*sendRateBucket{}},
+		{"nil bucket", []*sendRateBucket{{scope: SendRateScopeUser}}, []*sendRateBucket{}},
+		{"zero rate", []*sendRateBucket{{bucket: &app.TokenBucket{Burst: 1}}}, []*sendRateBucket{}},
+		{"zero burst", []*sendRateBucket{{bucket: &app.TokenBucket{Rate: 1}}}, []*sendRateBucket{}},
+		{"mixed", []*sendRateBucket{{bucket: &app.TokenBucket{Rate: -1, Burst: 1}}, enabled}, []*sendRateBucket{enabled}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := enabledSendRateBuckets(c.candidates...); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("enabledSendRateBuckets() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// TestTokensScript 需要可用的redis, 通过环境变量TEST_REDIS_ADDR指定地址, 未指定时跳过
+func TestTokensScript(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	// 第一个桶每秒1个令牌容量2, 第二个桶每秒10个令牌容量100
+	keys := []string{"{test:rl}:a", "{test:rl}:b"}
+	if err := client.Del(ctx, keys...).Err(); err != nil {
+		t.Fatalf("Del %v", err)
+	}
+	defer client.Del(ctx, keys...)
+
+	steps := []struct {
+		name   string
+		now    int64
+		refund bool
+		want   []int64
+		wantA  string
+		wantB  string
+	}{
+		{"first take", 1000, false, []int64{0, 0}, "1", "99"},
+		{"second take", 1000, false, []int64{0, 0}, "0", "98"},
+		{"limited by first bucket", 1000, false, []int64{1000, 1}, "0", "98"},
+		{"half refilled", 1500, false, []int64{500, 1}, "0", "98"},
+		{"refilled", 2000, false, []int64{0, 0}, "0", "99"},
+		{"refund", 0, true, nil, "1", "100"},
+		{"take after refund", 2000, false, []int64{0, 0}, "0", "99"},
+	}
+	for _, s := range steps {
+		if s.refund {
+			if err := client.Eval(ctx, refundTokensScript, keys, 2, 100).Err(); err != nil {
+				t.Fatalf("%s: refund %v", s.name, err)
+			}
+		} else {
+			got, err := client.Eval(ctx, takeTokensScript, keys, s.now, 1, 2, 10, 100).Int64Slice()
+			if err != nil {
+				t.Fatalf("%s: take %v", s.name, err)
+			}
+			if !reflect.DeepEqual(got, s.want) {
+				t.Errorf("%s: take = %v, want %v", s.name, got, s.want)
+			}
+		}
+		if a := client.HGet(ctx, keys[0], "t").Val(); a != s.wantA {
+			t.Errorf("%s: bucket a tokens = %s, want %s", s.name, a, s.wantA)
+		}
+		if b := client.HGet(ctx, keys[1], "t").Val(); b != s.wantB {
+			t.Errorf("%s: bucket b tokens = %s, want %s", s.name, b, s.wantB)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	messageReactionMaxCount = 200
+)
+
+func (l *MessageLogic) AddMessageReaction(req dto.MessageReactionReq, claims baseDto.ThkClaims) error {
+	if err := l.checkMessageReaction(req, claims); err != nil {
+		return err
+	}
+	reaction := &model.MessageReaction{
+		SessionId:  req.SId,
+		MsgId:      req.MsgId,
+		UserId:     req.UId,
+		Emoji:      req.Emoji,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	affected, err := l.appCtx.MessageReactionModel().AddReaction(reaction)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("AddMessageReaction %v, %v", req, err)
+		return err
+	}
+	// 重复回应不再广播
+	if affected > 0 {
+		l.pubMessageReactionEvent(req, dto.ReactionActionAdd, claims)
+	}
+	return nil
+}
+
+func (l *MessageLogic) DelMessageReaction(req dto.MessageReactionReq, claims baseDto.ThkClaims) error {
+	if err := l.checkMessageReaction(req, claims); err != nil {
+		return err
+	}
+	affected, err := l.appCtx.MessageReactionModel().DelReaction(req.SId, req.MsgId, req.UId, req.Emoji)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("DelMessageReaction %v, %v", req, err)
+		return err
+	}
+	if affected > 0 {
+		l.pubMessageReactionEvent(req, dto.ReactionActionRemove, claims)
+	}
+	return nil
+}
+
+func (l *MessageLogic) QueryMessageReactions(req dto.QueryMessageReactionReq, claims baseDto.ThkClaims) (*dto.QueryMessageReactionRes, error) {
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	if req.Count <= 0 || req.Count > messageReactionMaxCount {
+		req.Count = messageReactionMaxCount
+	}
+	reactions, err := l.appCtx.MessageReactionModel().FindReactions(req.SId, req.MsgId, req.Offset, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryMessageReactions %v, %v", req, err)
+		return nil, err
+	}
+	dtoReactions := make([]*dto.MessageReaction, 0)
+	for _, reaction := range reactions {
+		dtoReactions = append(dtoReactions, &dto.MessageReaction{
+			UId:   reaction.UserId,
+			Emoji: reaction.Emoji,
+			CTime: reaction.CreateTime,
+		})
+	}
+	return &dto.QueryMessageReactionRes{Data: dtoReactions}, nil
+}
+
+// checkMessageReaction 与发送消息相同的成员/禁言校验, 且用户能看到该消息
+func (l *MessageLogic) checkMessageReaction(req dto.MessageReactionReq, claims baseDto.ThkClaims) error {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkMessageReaction FindSession %v, %v", req, errSession)
+		return errorx.ErrSessionInvalid
+	}
+	userSession, err := l.findMemberUserSession(req.UId, req.SId, claims)
+	if err != nil {
+		return err
+	}
+	if err = l.checkUserSessionMuted(userSession); err != nil {
+		return err
+	}
+	return l.checkMessageVisible(session, req.UId, req.MsgId)
+}
+
+// pubMessageReactionEvent 在线推送表情回应变更给会话成员
+func (l *MessageLogic) pubMessageReactionEvent(req dto.MessageReactionReq, action int, claims baseDto.ThkClaims) {
+	body, err := json.Marshal(&dto.MessageReactionBody{Emoji: req.Emoji, Action: action})
+	if err == nil {
+		err = l.pubOperationMessageEvent(req.SId, req.UId, model.MsgTypeReaction, string(body), req.MsgId, nil, claims)
+	}
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pubMessageReactionEvent %v, %v", req, err)
+	}
+}
+
+// fillMessageReactions 填充消息的表情回应数和uId自己的回应, 查询失败不影响消息返回
+func (l *MessageLogic) fillMessageReactions(uId int64, messages []*dto.Message, claims baseDto.ThkClaims) {
+	sessionMessages := make(map[int64]map[int64]*dto.Message)
+	for _, message := range messages {
+		if message.Type < 0 || message.SId <= 0 {
+			continue
+		}
+		if sessionMessages[message.SId] == nil {
+			sessionMessages[message.SId] = make(map[int64]*dto.Message)
+		}
+		sessionMessages[message.SId][message.MsgId] = message
+	}
+	for sId, msgMap := range sessionMessages {
+		msgIds := make([]int64, 0, len(msgMap))
+		for msgId := range msgMap {
+			msgIds = append(msgIds, msgId)
+		}
+		counts, err := l.appCtx.MessageReactionModel().CountReactions(sId, msgIds)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillMessageReactions %d %v", sId, err)
+			continue
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		for _, c := range counts {
+			if message, ok := msgMap[c.MsgId]; ok {
+				message.Reactions = append(message.Reactions, &dto.ReactionCount{Emoji: c.Emoji, Count: c.Count})
+			}
+		}
+		if uId <= 0 {
+			continue
+		}
+		reactions, err := l.appCtx.MessageReactionModel().FindUserReactions(sId, uId, msgIds)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillMessageReactions %d %d %v", sId, uId, err)
+			continue
+		}
+		for _, reaction := range reactions {
+			if message, ok := msgMap[reaction.MsgId]; ok {
+				message.MyReactions = append(message.MyReactions, reaction.Emoji)
+			}
+		}
+	}
+}
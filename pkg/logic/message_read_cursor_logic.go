@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+// advanceReadCursor 把成员在超级群的已读游标推进到msgIds中最新的一条, 已读时间取消息id中的服务端时间, 游标前进后通知用户的其他端
+func (l *MessageLogic) advanceReadCursor(session *model.Session, uId int64, msgIds []int64, claims baseDto.ThkClaims) error {
+	if len(msgIds) == 0 {
+		return nil
+	}
+	sessionMessages, err := l.appCtx.SessionMessageModel().GetSessionMessages(session.Id, 0, 0, len(msgIds), msgIds, 1)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceReadCursor %d %d, %v", session.Id, uId, err)
+		return err
+	}
+	readSeq, readMsgTime := int64(0), int64(0)
+	for _, sessionMessage := range sessionMessages {
+		if sessionMessage.Seq > readSeq {
+			readSeq = sessionMessage.Seq
+		}
+		if msgTime := model.MsgIdTime(sessionMessage.MsgId); msgTime > readMsgTime {
+			readMsgTime = msgTime
+		}
+	}
+	if readSeq == 0 && readMsgTime == 0 {
+		return nil
+	}
+	affected, err := l.appCtx.UserSessionModel().UpdateReadCursor(uId, session.Id, readSeq, readMsgTime)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceReadCursor %d %d, %v", session.Id, uId, err)
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+	if err = l.appCtx.SessionUserModel().UpdateReadCursor(session.Id, uId, readSeq, readMsgTime); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("advanceReadCursor %d %d, %v", session.Id, uId, err)
+	}
+	l.pubReadCursorSyncEvent(uId, session.Id, readSeq, readMsgTime, claims)
+	return nil
+}
+
+// pubReadCursorSyncEvent 通知用户的其他在线端已读游标已变更
+func (l *MessageLogic) pubReadCursorSyncEvent(uId, sId, readSeq, readMsgTime int64, claims baseDto.ThkClaims) {
+	body, err := json.Marshal(&dto.ReadCursorSyncBody{
+		ReadSeq:     readSeq,
+		ReadMsgTime: readMsgTime,
+		Platform:    claims.GetPlatform(),
+		Device:      claims.GetDevice(),
+	})
+	if err == nil {
+		err = l.pubOperationMessageEvent(sId, uId, model.MsgTypeReadCursor, string(body), 0, []int64{uId}, claims)
+	}
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("pubReadCursorSyncEvent %d %d, %v", sId, uId, err)
+	}
+}
@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	messageReadUserMaxCount = 200
+)
+
+// recordGroupMessageReads 记录群消息已读并向发送人推送聚合后的已读数, 不再按读者逐条发送已读消息
+func (l *MessageLogic) recordGroupMessageReads(uId, sId int64, userMessages []*model.UserMessage, claims baseDto.ThkClaims) {
+	now := time.Now().UnixMilli()
+	senders := make(map[int64]int64)
+	for _, userMessage := range userMessages {
+		// 小于0的类型消息为状态操作消息, 自己发送的消息不需要记录已读
+		if userMessage.MsgId == 0 || userMessage.MsgType < 0 || userMessage.FromUserId == uId || userMessage.FromUserId == 0 {
+			continue
+		}
+		affected, err := l.appCtx.MessageReadModel().AddMessageRead(&model.MessageRead{
+			SessionId:  sId,
+			MsgId:      userMessage.MsgId,
+			UserId:     uId,
+			CreateTime: now,
+		})
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("recordGroupMessageReads %d %d %d, %v", uId, sId, userMessage.MsgId, err)
+			continue
+		}
+		if affected > 0 { // 已经读过的消息不重复推送
+			senders[userMessage.MsgId] = userMessage.FromUserId
+		}
+	}
+	if len(senders) == 0 {
+		return
+	}
+	msgIds := make([]int64, 0, len(senders))
+	for msgId := range senders {
+		msgIds = append(msgIds, msgId)
+	}
+	readCounts, err := l.appCtx.MessageReadModel().CountMessageReads(sId, msgIds)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("recordGroupMessageReads %d %d, %v", uId, sId, err)
+		return
+	}
+	for _, readCount := range readCounts {
+		body, errJson := json.Marshal(&dto.MessageReadCountBody{ReadCount: readCount.Count})
+		if errJson != nil {
+			continue
+		}
+		// 只推送给消息发送人
+		fromUId := senders[readCount.MsgId]
+		if err = l.pubOperationMessageEvent(sId, 0, model.MsgTypeReadCount, string(body), readCount.MsgId, []int64{fromUId}, claims); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("recordGroupMessageReads %d %d, %v", sId, readCount.MsgId, err)
+		}
+	}
+}
+
+func (l *MessageLogic) GetMessageReadUsers(req dto.GetMessageReadUsersReq, claims baseDto.ThkClaims) (*dto.GetMessageReadUsersRes, error) {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id <= 0 {
+		return nil, errorx.ErrSessionInvalid
+	}
+	if session.Type != model.GroupSessionType {
+		return nil, errorx.ErrSessionType
+	}
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	userMessage, errMessage := l.appCtx.UserMessageModel().FindUserMessage(req.UId, req.SId, req.MsgId)
+	if errMessage != nil || userMessage.MsgId == 0 || userMessage.Deleted == 1 {
+		return nil, errorx.ErrSessionMessageInvalid
+	}
+	if req.Count <= 0 || req.Count > messageReadUserMaxCount {
+		req.Count = messageReadUserMaxCount
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	reads, err := l.appCtx.MessageReadModel().FindMessageReads(req.SId, req.MsgId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessageReadUsers %v, %v", req, err)
+		return nil, err
+	}
+	readUsers := make([]*dto.MessageReadUser, 0, len(reads))
+	readUIds := make(map[int64]bool, len(reads))
+	for _, read := range reads {
+		readUIds[read.UserId] = true
+		readUsers = append(readUsers, &dto.MessageReadUser{UId: read.UserId, CTime: read.CreateTime})
+	}
+	// 群成员数量有上限, 未读用户由当前成员减去已读用户得到, 消息发送后才加入的成员没有收到该消息, 不计入未读
+	unreadUsers := make([]*dto.MessageReadUser, 0)
+	msgTime := model.MsgIdTime(userMessage.MsgId)
+	sessionUsers := l.appCtx.SessionUserModel().FindUIdsInSessionWithoutStatus(req.SId, 0, nil)
+	for _, sessionUser := range sessionUsers {
+		if sessionUser.UserId == userMessage.FromUserId || readUIds[sessionUser.UserId] || sessionUser.CreateTime > msgTime {
+			continue
+		}
+		unreadUsers = append(unreadUsers, &dto.MessageReadUser{UId: sessionUser.UserId})
+	}
+
+	users := unreadUsers
+	if req.Read == 1 {
+		users = readUsers
+	}
+	data := make([]*dto.MessageReadUser, 0)
+	if req.Offset < len(users) {
+		end := req.Offset + req.Count
+		if end > len(users) {
+			end = len(users)
+		}
+		data = users[req.Offset:end]
+	}
+	return &dto.GetMessageReadUsersRes{
+		ReadCount:   len(readUsers),
+		UnreadCount: len(unreadUsers),
+		Data:        data,
+	}, nil
+}
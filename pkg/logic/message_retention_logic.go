@@ -0,0 +1,427 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retentionDayMs              = 24 * 60 * 60 * 1000
+	messagePurgedCountExpire    = 7 * 24 * time.Hour
+	messagePurgedDateLayout     = "20060102"
+	messagePurgeResumeExpire    = 7 * 24 * time.Hour
+	purgedFieldUserRetention    = "user_message:retention"
+	purgedFieldUserDeleted      = "user_message:deleted"
+	purgedFieldSessionRetention = "session_message:retention"
+	purgedFieldSessionDeleted   = "session_message:deleted"
+	purgeTableUserMessage       = "user_message"
+	purgeTableSessionMessage    = "session_message"
+	// 合并转发的快照在消息发送前创建, 清理快照时分界向前预留一段时间, 避免删除分界附近仍被消息引用的快照
+	purgeSnapshotMarginMs = 10 * 60 * 1000
+)
+
+// messagePurgeRun 一次清理任务的上下文和统计, 会话信息在同一次任务内复用
+type messagePurgeRun struct {
+	now      int64
+	deadline int64
+	batch    int
+	sessions map[int64]*model.Session
+	// 写扩散会话本次清理使用的最大分界msg_id, 所有分表清理完后再清理不再被任何成员持有的消息的关联数据
+	purgedSessions map[int64]int64
+	counts         map[string]int64
+}
+
+func (r *messagePurgeRun) expired() bool {
+	return time.Now().UnixMilli() >= r.deadline
+}
+
+// PurgeMessages 遍历所有消息分表, 物理删除超出保留规则的消息和软删除超过保留天数的消息, 并清理被删除消息的关联数据.
+// 保留范围按msg_id中的服务端时间计算, 不受客户端时间影响. 单次任务最多执行一个清理间隔, 未完成的分表记录进度后下次继续
+func (l *MessageLogic) PurgeMessages() {
+	retention := l.appCtx.MsgApiConfig().IM.MessageRetention
+	now := time.Now().UnixMilli()
+	run := &messagePurgeRun{
+		now:            now,
+		deadline:       now + retention.Interval*1000,
+		batch:          retention.BatchCount,
+		sessions:       make(map[int64]*model.Session),
+		purgedSessions: make(map[int64]int64),
+		counts:         make(map[string]int64),
+	}
+	for shard := int64(0); shard < l.appCtx.UserMessageModel().Shards() && !run.expired(); shard++ {
+		l.purgeUserMessageShard(shard, run)
+	}
+	for sId, cutoff := range run.purgedSessions {
+		l.purgeUserSessionDependents(sId, cutoff, run)
+	}
+	for shard := int64(0); shard < l.appCtx.SessionMessageModel().Shards() && !run.expired(); shard++ {
+		l.purgeSessionMessageShard(shard, run)
+	}
+	l.recordPurgedCounts(run.counts)
+	l.appCtx.Logger().Infof("PurgeMessages cost: %dms, purged: %v", time.Now().UnixMilli()-run.now, run.counts)
+}
+
+func (l *MessageLogic) purgeUserMessageShard(shard int64, run *messagePurgeRun) {
+	lockKey := fmt.Sprintf(userMessagePurgeLockKey, l.appCtx.Config().Name, shard)
+	release, ok := l.lockPurgeShard(lockKey)
+	if !ok {
+		return
+	}
+	defer release()
+	run.counts[purgedFieldUserDeleted] += l.purgeInBatches(run.batch, run.deadline, func() (int64, error) {
+		return l.appCtx.UserMessageModel().PurgeDeletedMessages(shard, l.deletedCutoff(run.now), run.batch)
+	})
+	position := l.loadPurgeResume(purgeTableUserMessage, shard)
+	fromUId, fromSId := position[0], position[1]
+	for {
+		owners, err := l.appCtx.UserMessageModel().FindMessageOwners(shard, fromUId, fromSId, run.batch)
+		if err != nil {
+			l.appCtx.Logger().Errorf("purgeUserMessageShard %d %v", shard, err)
+			return
+		}
+		for _, owner := range owners {
+			l.purgeUserSessionMessages(owner.UserId, owner.SessionId, run)
+			if run.expired() {
+				// 当前会话可能没有清理完, 下次从当前会话重新开始
+				l.savePurgeResume(purgeTableUserMessage, shard, fromUId, fromSId)
+				return
+			}
+			fromUId, fromSId = owner.UserId, owner.SessionId
+		}
+		if len(owners) < run.batch {
+			l.savePurgeResume(purgeTableUserMessage, shard)
+			return
+		}
+	}
+}
+
+// purgeUserSessionMessages 清理用户在会话中超出保留范围的消息, 并清理只属于该用户的关联数据
+func (l *MessageLogic) purgeUserSessionMessages(uId, sId int64, run *messagePurgeRun) {
+	session := l.findPurgeSession(sId, run)
+	if session == nil {
+		return
+	}
+	cutoff, err := l.retentionCutoff(session, run.now, func(n int64) (int64, error) {
+		return l.appCtx.UserMessageModel().FindNthLatestMsgId(uId, sId, n)
+	})
+	if err != nil {
+		l.appCtx.Logger().Errorf("purgeUserSessionMessages %d %d %v", uId, sId, err)
+		return
+	}
+	if cutoff <= 0 {
+		return
+	}
+	purgedSeq, err := l.appCtx.UserMessageModel().FindMaxSeqBefore(uId, sId, cutoff)
+	if err != nil {
+		l.appCtx.Logger().Errorf("purgeUserSessionMessages %d %d %v", uId, sId, err)
+		return
+	}
+	purged := l.purgeInBatches(run.batch, run.deadline, func() (int64, error) {
+		return l.appCtx.UserMessageModel().PurgeMessagesBefore(uId, sId, cutoff, run.batch)
+	})
+	if purged == 0 {
+		return
+	}
+	run.counts[purgedFieldUserRetention] += purged
+	if run.purgedSessions[sId] < cutoff {
+		run.purgedSessions[sId] = cutoff
+	}
+	if purgedSeq > 0 {
+		if err = l.appCtx.UserSessionModel().UpdatePurgedSeq(uId, sId, purgedSeq); err != nil {
+			l.appCtx.Logger().Errorf("purgeUserSessionMessages %d %d %v", uId, sId, err)
+		}
+	}
+	if err = l.appCtx.UserMentionModel().DeleteUserMentionsBefore(uId, sId, cutoff); err != nil {
+		l.appCtx.Logger().Errorf("purgeUserSessionMessages %d %d %v", uId, sId, err)
+	}
+	if err = l.appCtx.UserThreadModel().DeleteUserThreadsBefore(uId, sId, cutoff); err != nil {
+		l.appCtx.Logger().Errorf("purgeUserSessionMessages %d %d %v", uId, sId, err)
+	}
+	l.resetUserLastMessage(uId, sId, baseDto.ThkClaims{})
+}
+
+// purgeUserSessionDependents 写扩散会话各成员的保留分界可能不同, 只清理所有成员都不再持有的消息的关联数据
+func (l *MessageLogic) purgeUserSessionDependents(sId, cutoff int64, run *messagePurgeRun) {
+	minMsgId, err := l.appCtx.UserMessageModel().FindSessionMinMsgId(sId)
+	if err != nil {
+		l.appCtx.Logger().Errorf("purgeUserSessionDependents %d %v", sId, err)
+		return
+	}
+	if minMsgId > 0 && minMsgId < cutoff {
+		cutoff = minMsgId
+	}
+	l.purgeMessageDependents(sId, cutoff, run)
+}
+
+func (l *MessageLogic) purgeSessionMessageShard(shard int64, run *messagePurgeRun) {
+	lockKey := fmt.Sprintf(sessionMessagePurgeLockKey, l.appCtx.Config().Name, shard)
+	release, ok := l.lockPurgeShard(lockKey)
+	if !ok {
+		return
+	}
+	defer release()
+	run.counts[purgedFieldSessionDeleted] += l.purgeInBatches(run.batch, run.deadline, func() (int64, error) {
+		return l.appCtx.SessionMessageModel().PurgeDeletedMessages(shard, l.deletedCutoff(run.now), run.batch)
+	})
+	fromSId := l.loadPurgeResume(purgeTableSessionMessage, shard)[0]
+	for {
+		sessionIds, err := l.appCtx.SessionMessageModel().FindMessageSessionIds(shard, fromSId, run.batch)
+		if err != nil {
+			l.appCtx.Logger().Errorf("purgeSessionMessageShard %d %v", shard, err)
+			return
+		}
+		for _, sId := range sessionIds {
+			l.purgeSessionMessages(sId, run)
+			if run.expired() {
+				l.savePurgeResume(purgeTableSessionMessage, shard, fromSId)
+				return
+			}
+			fromSId = sId
+		}
+		if len(sessionIds) < run.batch {
+			l.savePurgeResume(purgeTableSessionMessage, shard)
+			return
+		}
+	}
+}
+
+// purgeSessionMessages 清理超级群中超出保留范围的消息和关联数据
+func (l *MessageLogic) purgeSessionMessages(sId int64, run *messagePurgeRun) {
+	session := l.findPurgeSession(sId, run)
+	if session == nil {
+		return
+	}
+	cutoff, err := l.retentionCutoff(session, run.now, func(n int64) (int64, error) {
+		return l.appCtx.SessionMessageModel().FindNthLatestMsgId(sId, n)
+	})
+	if err != nil {
+		l.appCtx.Logger().Errorf("purgeSessionMessages %d %v", sId, err)
+		return
+	}
+	if cutoff <= 0 {
+		return
+	}
+	purgedSeq, err := l.appCtx.SessionMessageModel().FindMaxSeqBefore(sId, cutoff)
+	if err != nil {
+		l.appCtx.Logger().Errorf("purgeSessionMessages %d %v", sId, err)
+		return
+	}
+	purged := l.purgeInBatches(run.batch, run.deadline, func() (int64, error) {
+		return l.appCtx.SessionMessageModel().PurgeMessagesBefore(sId, cutoff, run.batch)
+	})
+	if purged == 0 {
+		return
+	}
+	run.counts[purgedFieldSessionRetention] += purged
+	if purgedSeq > 0 {
+		if err = l.appCtx.SessionModel().UpdatePurgedSeq(sId, purgedSeq); err != nil {
+			l.appCtx.Logger().Errorf("purgeSessionMessages %d %v", sId, err)
+		}
+	}
+	l.purgeMessageDependents(sId, cutoff, run)
+	l.resetSessionLastMessage(sId, baseDto.ThkClaims{})
+}
+
+// purgeMessageDependents 清理会话中msg_id小于cutoff的消息的置顶、话题、@记录、表情回应、已读记录、编辑记录、搜索索引和合并转发快照
+func (l *MessageLogic) purgeMessageDependents(sId, cutoff int64, run *messagePurgeRun) {
+	deletes := []func() (int64, error){
+		func() (int64, error) {
+			return l.appCtx.SessionPinModel().DeletePinsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.MessageThreadModel().DeleteThreadsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.UserThreadModel().DeleteSessionThreadsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.UserMentionModel().DeleteSessionMentionsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.SessionMentionModel().DeleteMentionsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.MessageReactionModel().DeleteReactionsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.MessageReadModel().DeleteReadsBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.MessageEditHistoryModel().DeleteHistoriesBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			return l.appCtx.MessageSearchIndex().DeleteMessagesBefore(sId, cutoff, run.batch)
+		},
+		func() (int64, error) {
+			snapshotCutoff := model.MinMsgIdAt(model.MsgIdTime(cutoff) - purgeSnapshotMarginMs)
+			return l.appCtx.MessageSnapshotModel().DeleteSessionSnapshotsBefore(sId, snapshotCutoff, run.batch)
+		},
+	}
+	// 关联数据不受任务截止时间限制, 否则下次任务没有可清理的消息时不会再清理剩余的关联数据
+	for _, purge := range deletes {
+		l.purgeInBatches(run.batch, 0, purge)
+	}
+}
+
+// retentionCutoff 会话生效的保留规则对应的分界msg_id, 小于分界的消息需要清理, 0表示不需要清理.
+// nthLatest查询倒数第n条消息的msg_id
+func (l *MessageLogic) retentionCutoff(session *model.Session, now int64, nthLatest func(n int64) (int64, error)) (int64, error) {
+	days, count := l.sessionRetention(session)
+	cutoff := int64(0)
+	if days > 0 {
+		cutoff = model.MinMsgIdAt(now - int64(days)*retentionDayMs)
+	}
+	if count > 0 {
+		nth, err := nthLatest(count)
+		if err != nil {
+			return 0, err
+		}
+		if nth > cutoff {
+			cutoff = nth
+		}
+	}
+	return cutoff, nil
+}
+
+// lockPurgeShard 多个节点同时只有一个清理同一个分表, 单次任务最多执行一个清理间隔, 锁的超时时间为两个间隔, 避免任务重叠
+func (l *MessageLogic) lockPurgeShard(lockKey string) (func(), bool) {
+	interval := l.appCtx.MsgApiConfig().IM.MessageRetention.Interval
+	locker := l.appCtx.NewLocker(lockKey, 0, int(2*interval*1000))
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return nil, false
+	}
+	return func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}, true
+}
+
+// loadPurgeResume 读取分表上次未完成的清理进度, 没有进度时从头开始
+func (l *MessageLogic) loadPurgeResume(table string, shard int64) [2]int64 {
+	position := [2]int64{}
+	key := fmt.Sprintf(messagePurgeResumeKey, l.appCtx.Config().Name, table, shard)
+	value, err := l.appCtx.RedisCache().Get(context.Background(), key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			l.appCtx.Logger().Errorf("loadPurgeResume %s %v", key, err)
+		}
+		return position
+	}
+	for i, field := range strings.SplitN(value, ":", len(position)) {
+		position[i], _ = strconv.ParseInt(field, 10, 64)
+	}
+	return position
+}
+
+// savePurgeResume 记录分表已清理到的位置, position为空表示分表已清理完成
+func (l *MessageLogic) savePurgeResume(table string, shard int64, position ...int64) {
+	key := fmt.Sprintf(messagePurgeResumeKey, l.appCtx.Config().Name, table, shard)
+	var err error
+	if len(position) == 0 {
+		err = l.appCtx.RedisCache().Del(context.Background(), key).Err()
+	} else {
+		fields := make([]string, 0, len(position))
+		for _, p := range position {
+			fields = append(fields, strconv.FormatInt(p, 10))
+		}
+		err = l.appCtx.RedisCache().Set(context.Background(), key, strings.Join(fields, ":"), messagePurgeResumeExpire).Err()
+	}
+	if err != nil {
+		l.appCtx.Logger().Errorf("savePurgeResume %s %v %v", key, position, err)
+	}
+}
+
+// purgeInBatches 分批删除直到不足一批或超过截止时间, deadline为0时不限制时间, 返回删除的总行数
+func (l *MessageLogic) purgeInBatches(batch int, deadline int64, purge func() (int64, error)) int64 {
+	total := int64(0)
+	for {
+		affected, err := purge()
+		if err != nil {
+			l.appCtx.Logger().Errorf("purgeInBatches %v", err)
+			return total
+		}
+		total += affected
+		if affected < int64(batch) || (deadline > 0 && time.Now().UnixMilli() >= deadline) {
+			return total
+		}
+	}
+}
+
+// findPurgeSession 查询会话, 会话不存在或已删除时返回nil, 只清理其中的软删除消息
+func (l *MessageLogic) findPurgeSession(sId int64, run *messagePurgeRun) *model.Session {
+	if session, ok := run.sessions[sId]; ok {
+		return session
+	}
+	session, err := l.appCtx.SessionModel().FindSession(sId)
+	if err != nil {
+		l.appCtx.Logger().Errorf("findPurgeSession %d %v", sId, err)
+		return nil
+	}
+	if session.Id <= 0 {
+		session = nil
+	}
+	run.sessions[sId] = session
+	return session
+}
+
+// sessionRetention 会话生效的保留天数和条数, 会话单独配置优先, 不大于0表示该项不限制
+func (l *MessageLogic) sessionRetention(session *model.Session) (int, int64) {
+	days, count := 0, int64(0)
+	if rule := l.appCtx.MsgApiConfig().IM.MessageRetention.Rule(session.Type); rule != nil {
+		days, count = rule.Days, rule.Count
+	}
+	if session.RetentionDays != 0 {
+		days = session.RetentionDays
+	}
+	if session.RetentionCount != 0 {
+		count = session.RetentionCount
+	}
+	return days, count
+}
+
+func (l *MessageLogic) deletedCutoff(now int64) int64 {
+	return now - int64(l.appCtx.MsgApiConfig().IM.MessageRetention.DeletedKeepDays)*retentionDayMs
+}
+
+// recordPurgedCounts 按天累计清理的消息数
+func (l *MessageLogic) recordPurgedCounts(counts map[string]int64) {
+	key := fmt.Sprintf(messagePurgedCountKey, l.appCtx.Config().Name, time.Now().Format(messagePurgedDateLayout))
+	pipe := l.appCtx.RedisCache().Pipeline()
+	for field, count := range counts {
+		pipe.HIncrBy(context.Background(), key, field, count)
+	}
+	pipe.Expire(context.Background(), key, messagePurgedCountExpire)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		l.appCtx.Logger().Errorf("recordPurgedCounts %s %v %v", key, counts, err)
+	}
+}
+
+// QueryPurgedCounts 查询某天清理的消息数
+func (l *MessageLogic) QueryPurgedCounts(req dto.QueryMessagePurgedReq, claims baseDto.ThkClaims) (*dto.QueryMessagePurgedRes, error) {
+	if req.Date == "" {
+		req.Date = time.Now().Format(messagePurgedDateLayout)
+	}
+	key := fmt.Sprintf(messagePurgedCountKey, l.appCtx.Config().Name, req.Date)
+	values, err := l.appCtx.RedisCache().HGetAll(context.Background(), key).Result()
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryPurgedCounts %v, %v", req, err)
+		return nil, err
+	}
+	data := make(map[string]int64, len(values))
+	for field, value := range values {
+		count, _ := strconv.ParseInt(value, 10, 64)
+		data[field] = count
+	}
+	return &dto.QueryMessagePurgedRes{Date: req.Date, Data: data}, nil
+}
@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"strings"
+	"time"
+)
+
+const (
+	messageReviewsMaxCount = 100
+)
+
+// addMessageReview 记录命中待审核敏感词的消息, 记录失败不影响消息发送
+func (l *MessageLogic) addMessageReview(sId, msgId, fUid int64, content string, categories []string, claims baseDto.ThkClaims) {
+	review := &model.MessageReview{
+		SessionId:  sId,
+		MsgId:      msgId,
+		FromUserId: fUid,
+		Categories: strings.Join(categories, ","),
+		MsgContent: content,
+		Status:     model.MessageReviewPending,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	if err := l.appCtx.MessageReviewModel().Insert(review); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("addMessageReview %v, %v", review, err)
+	}
+}
+
+// QueryMessageReviews 查询会话中命中待审核敏感词的消息记录
+func (l *MessageLogic) QueryMessageReviews(req dto.QueryMessageReviewsReq, claims baseDto.ThkClaims) (*dto.QueryMessageReviewsRes, error) {
+	if req.Count <= 0 || req.Count > messageReviewsMaxCount {
+		req.Count = messageReviewsMaxCount
+	}
+	if req.CTime <= 0 {
+		req.CTime = time.Now().UnixMilli()
+	}
+	reviews, err := l.appCtx.MessageReviewModel().FindReviews(req.SId, req.CTime, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryMessageReviews %v, %v", req, err)
+		return nil, err
+	}
+	dtoReviews := make([]*dto.MessageReview, 0, len(reviews))
+	for _, review := range reviews {
+		categories := make([]string, 0)
+		if review.Categories != "" {
+			categories = strings.Split(review.Categories, ",")
+		}
+		dtoReviews = append(dtoReviews, &dto.MessageReview{
+			SId:        review.SessionId,
+			MsgId:      review.MsgId,
+			FUid:       review.FromUserId,
+			Categories: categories,
+			Body:       review.MsgContent,
+			Status:     review.Status,
+			CTime:      review.CreateTime,
+		})
+	}
+	return &dto.QueryMessageReviewsRes{Data: dtoReviews}, nil
+}
@@ -0,0 +1,201 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"time"
+)
+
+const (
+	scheduledMessageBatchCount = 100
+	scheduledMessageMaxCount   = 100
+	// 发送中状态超过该时间未更新视为发送进程中断
+	scheduledMessageSendingTimeoutMs = 5 * 60 * 1000
+)
+
+func (l *MessageLogic) isScheduled(sendAt *int64) bool {
+	return sendAt != nil && *sendAt > time.Now().UnixMilli()
+}
+
+func (l *MessageLogic) convScheduledMessage2Dto(m *model.ScheduledMessage) *dto.ScheduledMessage {
+	return &dto.ScheduledMessage{
+		Id:      m.Id,
+		Type:    m.Type,
+		SId:     m.SessionId,
+		FUid:    m.FromUserId,
+		MsgType: m.MsgType,
+		Content: m.Content,
+		SendAt:  m.SendAt,
+		CTime:   m.CreateTime,
+	}
+}
+
+func (l *MessageLogic) scheduleMessage(t int, fUid, sId int64, msgType int, sendAt int64, req interface{}, claims baseDto.ThkClaims) (*model.ScheduledMessage, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("scheduleMessage %v, %v", req, err)
+		return nil, err
+	}
+	scheduledMessage := &model.ScheduledMessage{
+		Type:       t,
+		FromUserId: fUid,
+		SessionId:  sId,
+		MsgType:    msgType,
+		Content:    string(content),
+		SendAt:     sendAt,
+	}
+	if err = l.appCtx.ScheduledMessageModel().Insert(scheduledMessage); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("scheduleMessage %v, %v", req, err)
+		return nil, err
+	}
+	return scheduledMessage, nil
+}
+
+func (l *MessageLogic) scheduleSessionMessage(req dto.SendMessageReq, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
+	scheduledMessage, err := l.scheduleMessage(model.ScheduledSessionMessage, req.FUid, req.SId, req.Type, *req.SendAt, req, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.SendMessageRes{
+		CreateTime: scheduledMessage.CreateTime,
+		ScheduleId: scheduledMessage.Id,
+	}, nil
+}
+
+func (l *MessageLogic) scheduleSysMessage(req dto.SendSysMessageReq, claims baseDto.ThkClaims) (*dto.SendSysMessageRes, error) {
+	scheduledMessage, err := l.scheduleMessage(model.ScheduledSystemMessage, 0, 0, req.Type, *req.SendAt, req, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.SendSysMessageRes{
+		CreateTime: scheduledMessage.CreateTime,
+		ScheduleId: scheduledMessage.Id,
+	}, nil
+}
+
+func (l *MessageLogic) QueryScheduledMessages(req dto.QueryScheduledMessageReq, claims baseDto.ThkClaims) (*dto.QueryScheduledMessageRes, error) {
+	if req.Count <= 0 || req.Count > scheduledMessageMaxCount {
+		req.Count = scheduledMessageMaxCount
+	}
+	scheduledMessages, err := l.appCtx.ScheduledMessageModel().FindScheduledMessages(req.UId, req.SId, req.Offset, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryScheduledMessages %v, %v", req, err)
+		return nil, err
+	}
+	dtoMessages := make([]*dto.ScheduledMessage, 0)
+	for _, m := range scheduledMessages {
+		dtoMessages = append(dtoMessages, l.convScheduledMessage2Dto(m))
+	}
+	return &dto.QueryScheduledMessageRes{Data: dtoMessages}, nil
+}
+
+func (l *MessageLogic) CancelScheduledMessage(req dto.CancelScheduledMessageReq, claims baseDto.ThkClaims) error {
+	affected, err := l.appCtx.ScheduledMessageModel().CancelScheduledMessage(req.UId, req.Id)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("CancelScheduledMessage %v, %v", req, err)
+		return err
+	}
+	// 已发送/已取消/不存在
+	if affected == 0 {
+		return errorx.ErrScheduledMsgInvalid
+	}
+	return nil
+}
+
+// SendScheduledMessages 发送所有分表中到期的定时消息
+func (l *MessageLogic) SendScheduledMessages() {
+	for shard := int64(0); shard < l.appCtx.ScheduledMessageModel().Shards(); shard++ {
+		l.sendScheduledMessages(shard)
+	}
+}
+
+func (l *MessageLogic) sendScheduledMessages(shard int64) {
+	claims := baseDto.ThkClaims{}
+	lockKey := fmt.Sprintf(scheduledMessageLockKey, l.appCtx.Config().Name, shard)
+	locker := l.appCtx.NewLocker(lockKey, 0, 30*1000)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+	l.recoverStuckScheduledMessages(shard)
+	scheduledMessages, err := l.appCtx.ScheduledMessageModel().FindDueScheduledMessages(shard, time.Now().UnixMilli(), scheduledMessageBatchCount)
+	if err != nil {
+		l.appCtx.Logger().Errorf("sendScheduledMessages %d %v", shard, err)
+		return
+	}
+	for _, m := range scheduledMessages {
+		// 抢占失败说明已被取消
+		affected, errClaim := l.appCtx.ScheduledMessageModel().ClaimScheduledMessage(m.FromUserId, m.Id)
+		if errClaim != nil || affected == 0 {
+			continue
+		}
+		status := model.ScheduledStatusSent
+		msgId, errSend := l.sendScheduledMessage(m, claims)
+		if errSend != nil {
+			l.appCtx.Logger().Errorf("sendScheduledMessages %d %v", m.Id, errSend)
+			status = model.ScheduledStatusFailed
+		}
+		if err = l.appCtx.ScheduledMessageModel().UpdateScheduledMessageStatus(m.FromUserId, m.Id, status, msgId); err != nil {
+			l.appCtx.Logger().Errorf("sendScheduledMessages %d %v", m.Id, err)
+		}
+	}
+}
+
+// recoverStuckScheduledMessages 恢复发送中途进程中断的定时消息, 会话消息按客户端id去重可以重新发送,
+// 系统消息不落库无法去重, 标记为发送失败
+func (l *MessageLogic) recoverStuckScheduledMessages(shard int64) {
+	before := time.Now().UnixMilli() - scheduledMessageSendingTimeoutMs
+	scheduledMessages, err := l.appCtx.ScheduledMessageModel().FindStuckScheduledMessages(shard, before, scheduledMessageBatchCount)
+	if err != nil {
+		l.appCtx.Logger().Errorf("recoverStuckScheduledMessages %d %v", shard, err)
+		return
+	}
+	for _, m := range scheduledMessages {
+		status := model.ScheduledStatusPending
+		if m.Type == model.ScheduledSystemMessage {
+			status = model.ScheduledStatusFailed
+		}
+		if _, err = l.appCtx.ScheduledMessageModel().RecoverScheduledMessage(m.FromUserId, m.Id, status, before); err != nil {
+			l.appCtx.Logger().Errorf("recoverStuckScheduledMessages %d %v", m.Id, err)
+		}
+	}
+}
+
+func (l *MessageLogic) sendScheduledMessage(m *model.ScheduledMessage, claims baseDto.ThkClaims) (int64, error) {
+	now := time.Now().UnixMilli()
+	if m.Type == model.ScheduledSystemMessage {
+		req := dto.SendSysMessageReq{}
+		if err := json.Unmarshal([]byte(m.Content), &req); err != nil {
+			return 0, err
+		}
+		req.SendAt = nil
+		req.CTime = now
+		res, err := l.SendSysMessage(req, claims)
+		if err != nil {
+			return 0, err
+		}
+		return res.MsgId, nil
+	} else {
+		req := dto.SendMessageReq{}
+		if err := json.Unmarshal([]byte(m.Content), &req); err != nil {
+			return 0, err
+		}
+		req.SendAt = nil
+		req.CTime = now
+		res, err := l.sendMessage(req, false, claims)
+		if err != nil {
+			return 0, err
+		}
+		return res.MsgId, nil
+	}
+}
@@ -0,0 +1,30 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+// checkMessageSchema 按消息类型注册的schema校验消息体和扩展数据, 未注册的类型按配置策略处理(系统消息/状态操作消息/撤回消息不受限制)
+func (l *MessageLogic) checkMessageSchema(req dto.SendMessageReq, claims baseDto.ThkClaims) error {
+	registry := l.appCtx.MessageSchemaRegistry()
+	if registry == nil {
+		return nil
+	}
+	if !registry.Has(req.Type) {
+		if req.FUid > 0 && req.Type > 0 && req.Type != model.MsgTypeRevoke &&
+			l.appCtx.MsgApiConfig().MsgSchema.UnknownType == app.MsgSchemaUnknownTypeDeny {
+			return errorx.ErrMessageTypeNotSupport
+		}
+		return nil
+	}
+	if err := registry.Validate(req.Type, req.BodyVer, req.Body, req.ExtData); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("checkMessageSchema %d %d %d, %v", req.SId, req.Type, req.BodyVer, err)
+		return errorx.ErrMessageBodyInvalid
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"strings"
+)
+
+const (
+	messageSearchMaxCount = 50
+	messageSearchMaxPages = 5
+)
+
+// isMessageSearchable 只有文本和富文本消息建索引, 媒体类消息的内容为json, 不参与搜索
+func isMessageSearchable(msgType int) bool {
+	return msgType == model.MsgTypeText || msgType == model.MsgTypeRichText
+}
+
+// indexMessage 消息入库后写入搜索索引, 阅后即焚和定时销毁的消息不建索引, 避免过期后仍能被搜索到
+func (l *MessageLogic) indexMessage(req dto.SendMessageReq, msgId, cTime int64, claims baseDto.ThkClaims) {
+	if !isMessageSearchable(req.Type) || req.BurnAfterRead || req.TtlMs > 0 || strings.TrimSpace(req.Body) == "" {
+		return
+	}
+	doc := &model.MessageSearchDoc{
+		SessionId:  req.SId,
+		MsgId:      msgId,
+		FromUserId: req.FUid,
+		MsgType:    req.Type,
+		MsgContent: req.Body,
+		CreateTime: cTime,
+	}
+	if err := l.appCtx.MessageSearchIndex().IndexMessage(doc); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("indexMessage %v, %v", req, err)
+	}
+}
+
+func (l *MessageLogic) reindexMessage(sId, msgId int64, content string, claims baseDto.ThkClaims) {
+	if err := l.appCtx.MessageSearchIndex().UpdateMessageContent(sId, msgId, content); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("reindexMessage %d %d, %v", sId, msgId, err)
+	}
+}
+
+// unindexMessages 消息撤回/删除/过期后移除索引, msgIds为空时按时间范围移除
+func (l *MessageLogic) unindexMessages(sId int64, msgIds []int64, from, to int64, claims baseDto.ThkClaims) {
+	if err := l.appCtx.MessageSearchIndex().DeleteMessages(sId, msgIds, from, to); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unindexMessages %d %v, %v", sId, msgIds, err)
+	}
+}
+
+func (l *MessageLogic) SearchMessages(req dto.SearchMessageReq, claims baseDto.ThkClaims) (*dto.SearchMessageRes, error) {
+	if req.Count <= 0 || req.Count > messageSearchMaxCount {
+		req.Count = messageSearchMaxCount
+	}
+	var sessionIds []int64
+	if req.SId != nil {
+		if _, err := l.findMemberUserSession(req.UId, *req.SId, claims); err != nil {
+			return nil, err
+		}
+		sessionIds = []int64{*req.SId}
+	} else {
+		ids, err := l.appCtx.UserSessionModel().FindUserSessionIds(req.UId)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SearchMessages %v, %v", req, err)
+			return nil, err
+		}
+		sessionIds = ids
+	}
+	messages := make([]*dto.Message, 0)
+	if len(sessionIds) == 0 {
+		return &dto.SearchMessageRes{Data: messages}, nil
+	}
+	// 多取一些, 用户删除的消息和非本人可见的消息在回表时过滤, 过滤后不足count条时继续向前翻页
+	query := &model.MessageSearchQuery{
+		SessionIds: sessionIds,
+		Keywords:   req.Keywords,
+		FromUserId: req.FUid,
+		MsgType:    req.Type,
+		TimeFrom:   req.TimeFrom,
+		TimeTo:     req.TimeTo,
+		Count:      req.Count * 2,
+	}
+	for page := 0; page < messageSearchMaxPages && len(messages) < req.Count; page++ {
+		docs, err := l.appCtx.MessageSearchIndex().SearchMessages(query)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SearchMessages %v, %v", req, err)
+			return nil, err
+		}
+		messages = append(messages, l.findSearchedMessages(req.UId, docs, req.Count-len(messages), claims)...)
+		if len(docs) < query.Count {
+			break
+		}
+		last := docs[len(docs)-1]
+		query.CursorTime, query.CursorMsgId = last.CreateTime, last.MsgId
+	}
+	return &dto.SearchMessageRes{Data: messages}, nil
+}
+
+// findSearchedMessages 按索引结果回表查询消息, 超级群查session_message, 其他会话查用户自己的消息副本, 被删除的消息不返回
+func (l *MessageLogic) findSearchedMessages(uId int64, docs []*model.MessageSearchDoc, count int, claims baseDto.ThkClaims) []*dto.Message {
+	sessionMsgIds := make(map[int64][]int64)
+	for _, doc := range docs {
+		sessionMsgIds[doc.SessionId] = append(sessionMsgIds[doc.SessionId], doc.MsgId)
+	}
+	messageMap := make(map[int64]map[int64]*dto.Message)
+	for sId, msgIds := range sessionMsgIds {
+		messageMap[sId] = make(map[int64]*dto.Message)
+		for _, message := range l.findMessagesByIds(uId, sId, msgIds, claims) {
+			messageMap[sId][message.MsgId] = message
+		}
+	}
+	messages := make([]*dto.Message, 0)
+	for _, doc := range docs {
+		if len(messages) >= count {
+			break
+		}
+		if message, ok := messageMap[doc.SessionId][doc.MsgId]; ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
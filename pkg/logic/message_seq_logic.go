@@ -0,0 +1,124 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+const (
+	maxSeqQueryCount = 500
+	// 数据库中预留的序号段长度, 每分配完一段才写一次数据库
+	msgSeqReserveStep = 100
+	// redis中的序号丢失后从数据库中预留的序号上限恢复, 恢复后会跳过未使用的预留序号; 序号小于ARGV[3]时先推进到ARGV[3]
+	incrMsgSeqScript = `if redis.call("EXISTS", KEYS[1]) == 0 then ` +
+		`redis.call("SET", KEYS[1], ARGV[1]) ` +
+		`end ` +
+		`if tonumber(redis.call("GET", KEYS[1])) < tonumber(ARGV[3]) then ` +
+		`redis.call("SET", KEYS[1], ARGV[3]) ` +
+		`end ` +
+		`return redis.call("INCRBY", KEYS[1], ARGV[2])`
+)
+
+// needReserveMsgSeq 分配的序号达到数据库中预留的上限时需要继续预留
+func needReserveMsgSeq(seq, reserved int64) bool {
+	return seq >= reserved
+}
+
+// nextMsgSeqReserve 下一次预留的序号上限
+func nextMsgSeqReserve(seq int64) int64 {
+	return seq + msgSeqReserveStep
+}
+
+// allocMessageSeq 分配会话内严格递增的消息序号, 序号只由redis自增分配, 数据库中记录已预留的序号上限,
+// 保证redis数据丢失后恢复的序号不会小于已分配的序号, 预留失败时本次发送失败
+func (l *MessageLogic) allocMessageSeq(session *model.Session, claims baseDto.ThkClaims) (int64, error) {
+	return l.allocMessageSeqs(session, 0, 1, claims)
+}
+
+// allocMessageSeqs 一次分配count个大于minSeq的连续序号, 返回其中最大的序号, count为0时只把会话序号推进到不小于minSeq
+func (l *MessageLogic) allocMessageSeqs(session *model.Session, minSeq int64, count int, claims baseDto.ThkClaims) (int64, error) {
+	key := fmt.Sprintf(sessionMsgSeqKey, l.appCtx.Config().Name, session.Id)
+	seq, err := l.appCtx.RedisCache().Eval(context.Background(), incrMsgSeqScript, []string{key}, session.MsgSeq, count, minSeq).Int64()
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("allocMessageSeq redis %d %v", session.Id, err)
+		return 0, err
+	}
+	if needReserveMsgSeq(seq, session.MsgSeq) {
+		if err = l.appCtx.SessionModel().UpdateSessionMsgSeq(session.Id, nextMsgSeqReserve(seq)); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("allocMessageSeq db %d %d %v", session.Id, seq, err)
+			return 0, err
+		}
+	}
+	return seq, nil
+}
+
+// GetMessagesBySeq 查询会话内序号在(from_seq, to_seq]之间的消息, 用于客户端补齐缺失的消息.
+// 不大于已清理序号的消息不再返回, 客户端根据返回的purged_seq停止补齐
+func (l *MessageLogic) GetMessagesBySeq(req dto.GetMessageBySeqReq, claims baseDto.ThkClaims) (*dto.GetMessageRes, error) {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessagesBySeq FindSession %v, %v", req, errSession)
+		return nil, errorx.ErrSessionInvalid
+	}
+	messages := make([]*dto.Message, 0)
+	if session.Type == model.SuperGroupSessionType {
+		sessionUser, err := l.appCtx.SessionUserModel().FindSessionUser(req.SId, req.UId)
+		if err != nil || sessionUser.UserId <= 0 {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessagesBySeq FindSessionUser %v, %v", req, err)
+			return nil, errorx.ErrSessionInvalid
+		}
+		fromSeq, count := seqQueryRange(req.FromSeq, req.ToSeq, session.PurgedSeq)
+		if count <= 0 {
+			return &dto.GetMessageRes{Data: messages, PurgedSeq: session.PurgedSeq}, nil
+		}
+		sessionMessages, err := l.appCtx.SessionMessageModel().GetSessionMessagesBySeq(req.SId, fromSeq, req.ToSeq, count)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessagesBySeq %v, %v", req, err)
+			return nil, err
+		}
+		for _, sessionMessage := range sessionMessages {
+			messages = append(messages, l.convSessionMessage2Message(sessionMessage))
+		}
+		l.fillMessages(req.UId, messages, claims)
+		return &dto.GetMessageRes{Data: messages, PurgedSeq: session.PurgedSeq}, nil
+	}
+	userSession, err := l.appCtx.UserSessionModel().GetUserSession(req.UId, req.SId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessagesBySeq GetUserSession %v, %v", req, err)
+		return nil, err
+	}
+	fromSeq, count := seqQueryRange(req.FromSeq, req.ToSeq, userSession.PurgedSeq)
+	if count <= 0 {
+		return &dto.GetMessageRes{Data: messages, PurgedSeq: userSession.PurgedSeq}, nil
+	}
+	userMessages, err := l.appCtx.UserMessageModel().GetUserMessagesBySeq(req.UId, req.SId, fromSeq, req.ToSeq, count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessagesBySeq %v, %v", req, err)
+		return nil, err
+	}
+	for _, userMessage := range userMessages {
+		messages = append(messages, l.convUserMessage2Message(userMessage))
+	}
+	l.fillMessages(req.UId, messages, claims)
+	return &dto.GetMessageRes{Data: messages, PurgedSeq: userSession.PurgedSeq}, nil
+}
+
+// seqQueryRange 跳过已清理的序号, 返回实际查询的起始序号(不包含)和条数
+func seqQueryRange(fromSeq, toSeq, purgedSeq int64) (int64, int) {
+	if fromSeq < purgedSeq {
+		fromSeq = purgedSeq
+	}
+	count := toSeq - fromSeq
+	if count < 0 {
+		count = 0
+	}
+	if count > maxSeqQueryCount {
+		count = maxSeqQueryCount
+	}
+	return fromSeq, int(count)
+}
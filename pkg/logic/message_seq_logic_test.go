@@ -0,0 +1,56 @@
+package logic
+
+import "testing"
+
+func TestMsgSeqReserve(t *testing.T) {
+	cases := []struct {
+		name        string
+		seq         int64
+		reserved    int64
+		wantReserve bool
+		wantNext    int64
+	}{
+		{"first seq", 1, 0, true, 1 + msgSeqReserveStep},
+		{"below reserved", 50, 101, false, 50 + msgSeqReserveStep},
+		{"reach reserved", 101, 101, true, 101 + msgSeqReserveStep},
+		{"beyond reserved after redis loss", 150, 101, true, 150 + msgSeqReserveStep},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := needReserveMsgSeq(c.seq, c.reserved); got != c.wantReserve {
+				t.Errorf("needReserveMsgSeq(%d, %d) = %v, want %v", c.seq, c.reserved, got, c.wantReserve)
+			}
+			if got := nextMsgSeqReserve(c.seq); got != c.wantNext {
+				t.Errorf("nextMsgSeqReserve(%d) = %d, want %d", c.seq, got, c.wantNext)
+			}
+		})
+	}
+}
+
+func TestSeqQueryRange(t *testing.T) {
+	cases := []struct {
+		name      string
+		fromSeq   int64
+		toSeq     int64
+		purgedSeq int64
+		wantFrom  int64
+		wantCount int
+	}{
+		{"nothing purged", 10, 20, 0, 10, 10},
+		{"purged below range", 10, 20, 5, 10, 10},
+		{"purged inside range", 10, 20, 15, 15, 5},
+		{"purged beyond range", 10, 20, 30, 30, 0},
+		{"inverted range", 20, 10, 0, 20, 0},
+		{"clamp count", 0, 1000, 0, 0, maxSeqQueryCount},
+		{"clamp count after purge", 0, 1000, 100, 100, maxSeqQueryCount},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			from, count := seqQueryRange(c.fromSeq, c.toSeq, c.purgedSeq)
+			if from != c.wantFrom || count != c.wantCount {
+				t.Errorf("seqQueryRange(%d, %d, %d) = %d %d, want %d %d",
+					c.fromSeq, c.toSeq, c.purgedSeq, from, count, c.wantFrom, c.wantCount)
+			}
+		})
+	}
+}
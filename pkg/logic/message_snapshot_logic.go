@@ -0,0 +1,243 @@
+package logic
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"sort"
+	"time"
+)
+
+const (
+	maxMergedForwardCount    = 100
+	mergedForwardPreviewSize = 3
+	maxSnapshotNestedDepth   = 10
+)
+
+// ForwardMergedMessages 合并转发: 校验转发人能看到这些消息, 生成一份聊天记录快照, 再发送一条引用快照的消息
+func (l *MessageLogic) ForwardMergedMessages(req dto.ForwardMergedMessageReq, claims baseDto.ThkClaims) (*dto.SendMessageRes, error) {
+	if len(req.MsgIds) == 0 || len(req.MsgIds) > maxMergedForwardCount {
+		return nil, errorx.ErrSessionMessageInvalid
+	}
+	if err := l.checkForwardable(req.FUid, req.ForwardSId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	if _, err := l.findMemberUserSession(req.FUid, req.ForwardSId, claims); err != nil {
+		return nil, err
+	}
+	// 客户端重试时已经发送过的合并转发消息直接按原消息体重发, 不重复生成快照
+	if body, sent := l.findSentMessageBody(req.SId, req.FUid, req.CId, claims); sent {
+		return l.SendMessage(l.newMergedForwardSendReq(req, body), claims)
+	}
+	messages := l.findMessagesByIds(req.FUid, req.ForwardSId, req.MsgIds, claims)
+	for _, message := range messages {
+		if isExpiringMessage(message) {
+			return nil, errorx.ErrMessageNotPersistent
+		}
+	}
+	snapshotMessages := make([]*dto.SnapshotMessage, 0, len(messages))
+	fromUIds := make([]int64, 0, len(messages))
+	clientIds := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		// 状态操作消息和已撤回的消息不进入聊天记录
+		if message.Type < 0 || message.Type == model.MsgTypeRevoke {
+			continue
+		}
+		snapshotMessages = append(snapshotMessages, &dto.SnapshotMessage{
+			MsgId:   message.MsgId,
+			Type:    message.Type,
+			FUid:    message.FUid,
+			CTime:   message.CTime,
+			Body:    message.Body,
+			ExtData: message.ExtData,
+		})
+		fromUIds = append(fromUIds, message.FUid)
+		clientIds = append(clientIds, message.CId)
+	}
+	if len(snapshotMessages) == 0 {
+		return nil, errorx.ErrSessionMessageInvalid
+	}
+	sort.Slice(snapshotMessages, func(i, j int) bool {
+		return snapshotMessages[i].CTime < snapshotMessages[j].CTime
+	})
+
+	content, err := json.Marshal(snapshotMessages)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &model.MessageSnapshot{
+		Id:         l.appCtx.MessageSnapshotModel().NewSnapshotId(),
+		SessionId:  req.SId,
+		FromSId:    req.ForwardSId,
+		FromUserId: req.FUid,
+		MsgCount:   len(snapshotMessages),
+		Content:    string(content),
+		CreateTime: time.Now().UnixMilli(),
+	}
+	if err = l.appCtx.MessageSnapshotModel().Insert(snapshot); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ForwardMergedMessages Insert %v, %v", req, err)
+		return nil, err
+	}
+
+	// 快照中的媒体对象授权给目标会话, 授权记录在合并转发消息名下
+	ids, err := l.appCtx.SessionObjectModel().AddSessionObjects(req.ForwardSId, fromUIds, clientIds, req.FUid, req.CId, req.SId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ForwardMergedMessages AddSessionObjects %v, %v", req, err)
+		l.undoMergedForward(req, snapshot.Id, nil, claims)
+		return nil, err
+	}
+	if len(ids) > 0 {
+		if err = l.appCtx.ObjectModel().AddSessions(ids, req.SId); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("ForwardMergedMessages AddSessions %v, %v", req, err)
+			l.undoMergedForward(req, snapshot.Id, ids, claims)
+			return nil, err
+		}
+	}
+
+	preview := snapshotMessages
+	if len(preview) > mergedForwardPreviewSize {
+		preview = preview[:mergedForwardPreviewSize]
+	}
+	body, err := json.Marshal(&dto.MergedForwardBody{
+		SnapshotId: snapshot.Id,
+		FromSId:    req.ForwardSId,
+		Title:      req.Title,
+		Count:      len(snapshotMessages),
+		Preview:    preview,
+	})
+	if err != nil {
+		l.undoMergedForward(req, snapshot.Id, ids, claims)
+		return nil, err
+	}
+	res, errSend := l.SendMessage(l.newMergedForwardSendReq(req, string(body)), claims)
+	if errSend != nil {
+		l.undoMergedForward(req, snapshot.Id, ids, claims)
+		return nil, errSend
+	}
+	return res, nil
+}
+
+func (l *MessageLogic) newMergedForwardSendReq(req dto.ForwardMergedMessageReq, body string) dto.SendMessageReq {
+	return dto.SendMessageReq{
+		CId:     req.CId,
+		SId:     req.SId,
+		Type:    req.Type,
+		CTime:   req.CTime,
+		Body:    body,
+		FUid:    req.FUid,
+		ExtData: req.ExtData,
+	}
+}
+
+// findSentMessageBody 按发送人和客户端消息id查询目标会话中已发送的消息
+func (l *MessageLogic) findSentMessageBody(sId, fUid, cId int64, claims baseDto.ThkClaims) (string, bool) {
+	session, err := l.appCtx.SessionModel().FindSession(sId)
+	if err != nil || session.Id == 0 {
+		return "", false
+	}
+	if session.Type == model.SuperGroupSessionType {
+		sessionMessage, errMessage := l.appCtx.SessionMessageModel().FindMessageByClientId(sId, cId, fUid)
+		if errMessage != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("findSentMessageBody %d %d %d, %v", sId, fUid, cId, errMessage)
+			return "", false
+		}
+		return sessionMessage.MsgContent, sessionMessage.MsgId > 0
+	}
+	userMessage, errMessage := l.appCtx.UserMessageModel().FindUserMessageByClientId(fUid, sId, cId)
+	if errMessage != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("findSentMessageBody %d %d %d, %v", sId, fUid, cId, errMessage)
+		return "", false
+	}
+	return userMessage.MsgContent, userMessage.MsgId > 0
+}
+
+// undoMergedForward 合并转发消息发送失败时删除快照, 并取消只被该消息引用的媒体对象授权
+func (l *MessageLogic) undoMergedForward(req dto.ForwardMergedMessageReq, snapshotId int64, objectIds []int64, claims baseDto.ThkClaims) {
+	if err := l.appCtx.MessageSnapshotModel().Delete(snapshotId); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("undoMergedForward Delete %d, %v", snapshotId, err)
+	}
+	if err := l.appCtx.SessionObjectModel().DeleteSessionObjects(req.SId, req.FUid, req.CId); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("undoMergedForward DeleteSessionObjects %v, %v", req, err)
+		return
+	}
+	if len(objectIds) == 0 {
+		return
+	}
+	referenced, err := l.appCtx.SessionObjectModel().FindReferencedObjectIds(req.SId, objectIds)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("undoMergedForward FindReferencedObjectIds %v, %v", req, err)
+		return
+	}
+	referencedIds := make(map[int64]bool, len(referenced))
+	for _, id := range referenced {
+		referencedIds[id] = true
+	}
+	removeIds := make([]int64, 0, len(objectIds))
+	for _, id := range objectIds {
+		if !referencedIds[id] {
+			removeIds = append(removeIds, id)
+		}
+	}
+	if len(removeIds) == 0 {
+		return
+	}
+	if err = l.appCtx.ObjectModel().RemoveSessions(removeIds, req.SId); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("undoMergedForward RemoveSessions %v, %v", req, err)
+	}
+}
+
+// GetMessageSnapshot 查询合并转发的聊天记录, 只有快照目标会话的成员可以查看;
+// 嵌套的聊天记录通过PIds传入从外到内的上级快照链, 第一个快照属于当前会话, 每一级都需要被上一级快照引用
+func (l *MessageLogic) GetMessageSnapshot(req dto.GetMessageSnapshotReq, claims baseDto.ThkClaims) (*dto.GetMessageSnapshotRes, error) {
+	if len(req.PIds) > maxSnapshotNestedDepth {
+		return nil, errorx.ErrSessionMessageInvalid
+	}
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	var (
+		snapshot *model.MessageSnapshot
+		messages []*dto.SnapshotMessage
+	)
+	for i, id := range append(req.PIds, req.Id) {
+		if i > 0 && !snapshotReferences(messages, id) {
+			return nil, errorx.ErrSessionMessageInvalid
+		}
+		var err error
+		snapshot, err = l.appCtx.MessageSnapshotModel().FindSnapshot(id)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessageSnapshot %v, %v", req, err)
+			return nil, err
+		}
+		if snapshot.Id == 0 || (i == 0 && snapshot.SessionId != req.SId) {
+			return nil, errorx.ErrSessionMessageInvalid
+		}
+		messages = make([]*dto.SnapshotMessage, 0)
+		if err = json.Unmarshal([]byte(snapshot.Content), &messages); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetMessageSnapshot Unmarshal %v, %v", req, err)
+			return nil, err
+		}
+	}
+	return &dto.GetMessageSnapshotRes{
+		Id:       snapshot.Id,
+		SId:      snapshot.SessionId,
+		FromSId:  snapshot.FromSId,
+		FUid:     snapshot.FromUserId,
+		CTime:    snapshot.CreateTime,
+		Messages: messages,
+	}, nil
+}
+
+// snapshotReferences 快照中是否有引用snapshotId的合并转发消息
+func snapshotReferences(messages []*dto.SnapshotMessage, snapshotId int64) bool {
+	for _, message := range messages {
+		body := &dto.MergedForwardBody{}
+		if err := json.Unmarshal([]byte(message.Body), body); err == nil && body.SnapshotId == snapshotId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+const (
+	threadRepliesMaxCount = 200
+	userThreadsMaxCount   = 100
+)
+
+// isThreadReply 发给会话所有人的普通消息且指定了回复消息才计入话题
+func (l *MessageLogic) isThreadReply(req dto.SendMessageReq) bool {
+	return req.RMsgId != nil && *req.RMsgId > 0 && len(req.Receivers) == 0 && req.Type >= 0 && req.Type != model.MsgTypeRevoke
+}
+
+// updateMessageThread 更新根消息的回复数和最后回复时间, 并记录根消息发件人和回复人参与了该话题
+func (l *MessageLogic) updateMessageThread(session *model.Session, req dto.SendMessageReq, msgId, replyTime int64, claims baseDto.ThkClaims) {
+	if !l.isThreadReply(req) {
+		return
+	}
+	rootMsgId := *req.RMsgId
+	rootFromUId := int64(0)
+	if session.Type == model.SuperGroupSessionType {
+		rootMessage, err := l.appCtx.SessionMessageModel().FindSessionMessageByMsgId(req.SId, rootMsgId)
+		if err != nil || rootMessage.MsgId == 0 || rootMessage.MsgType < 0 {
+			return
+		}
+		rootFromUId = rootMessage.FromUserId
+	} else {
+		// 系统消息没有发件人消息副本, 无法确认根消息
+		if req.FUid <= 0 {
+			return
+		}
+		rootMessage, err := l.appCtx.UserMessageModel().FindUserMessage(req.FUid, req.SId, rootMsgId)
+		if err != nil || rootMessage.MsgId == 0 || rootMessage.MsgType < 0 {
+			return
+		}
+		rootFromUId = rootMessage.FromUserId
+	}
+	if err := l.appCtx.MessageThreadModel().IncrThreadReply(req.SId, rootMsgId, msgId, replyTime); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateMessageThread %d %d %v", req.SId, rootMsgId, err)
+		return
+	}
+	participants := make([]int64, 0)
+	if rootFromUId > 0 {
+		participants = append(participants, rootFromUId)
+	}
+	if req.FUid > 0 && req.FUid != rootFromUId {
+		participants = append(participants, req.FUid)
+	}
+	if err := l.appCtx.UserThreadModel().JoinThread(participants, req.SId, rootMsgId, replyTime); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("updateMessageThread %d %d %v", req.SId, rootMsgId, err)
+	}
+}
+
+// isThreadReplyMessage 已发送的消息是否计入了话题回复数
+func (l *MessageLogic) isThreadReplyMessage(msgType int, replyMsgId *int64) bool {
+	return replyMsgId != nil && *replyMsgId > 0 && msgType >= 0 && msgType != model.MsgTypeRevoke
+}
+
+// revertThreadReplies 回复被撤回或删除后扣减根消息的回复数, rootReplyCounts为根消息id到扣减数的映射
+func (l *MessageLogic) revertThreadReplies(sId int64, rootReplyCounts map[int64]int, claims baseDto.ThkClaims) {
+	for rootMsgId, count := range rootReplyCounts {
+		if count <= 0 {
+			continue
+		}
+		if err := l.appCtx.MessageThreadModel().DecrThreadReply(sId, rootMsgId, count); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("revertThreadReplies %d %d %v", sId, rootMsgId, err)
+		}
+	}
+}
+
+func (l *MessageLogic) GetThreadReplies(req dto.GetThreadRepliesReq, claims baseDto.ThkClaims) (*dto.GetMessageRes, error) {
+	session, errSession := l.appCtx.SessionModel().FindSession(req.SId)
+	if errSession != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetThreadReplies FindSession %v, %v", req, errSession)
+		return nil, errorx.ErrSessionInvalid
+	}
+	if _, err := l.findMemberUserSession(req.UId, req.SId, claims); err != nil {
+		return nil, err
+	}
+	if req.Count <= 0 || req.Count > threadRepliesMaxCount {
+		req.Count = threadRepliesMaxCount
+	}
+	messages := make([]*dto.Message, 0)
+	if session.Type == model.SuperGroupSessionType {
+		sessionMessages, err := l.appCtx.SessionMessageModel().GetSessionThreadReplies(req.SId, req.RootMsgId, req.CTime, req.Count)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetThreadReplies %v, %v", req, err)
+			return nil, err
+		}
+		for _, sessionMessage := range sessionMessages {
+			messages = append(messages, l.convSessionMessage2Message(sessionMessage))
+		}
+	} else {
+		userMessages, err := l.appCtx.UserMessageModel().GetUserThreadReplies(req.UId, req.SId, req.RootMsgId, req.CTime, req.Count)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetThreadReplies %v, %v", req, err)
+			return nil, err
+		}
+		for _, userMessage := range userMessages {
+			messages = append(messages, l.convUserMessage2Message(userMessage))
+		}
+	}
+	l.fillMessages(req.UId, messages, claims)
+	return &dto.GetMessageRes{Data: messages}, nil
+}
+
+func (l *MessageLogic) QueryUserThreads(req dto.QueryUserThreadsReq, claims baseDto.ThkClaims) (*dto.QueryUserThreadsRes, error) {
+	if req.Count <= 0 || req.Count > userThreadsMaxCount {
+		req.Count = userThreadsMaxCount
+	}
+	userThreads, err := l.appCtx.UserThreadModel().FindUserThreads(req.UId, req.SId, req.Offset, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryUserThreads %v, %v", req, err)
+		return nil, err
+	}
+	sessionRootMsgIds := make(map[int64][]int64)
+	for _, userThread := range userThreads {
+		sessionRootMsgIds[userThread.SessionId] = append(sessionRootMsgIds[userThread.SessionId], userThread.RootMsgId)
+	}
+	// 按会话批量查询话题统计和根消息
+	threadMap := make(map[int64]map[int64]*model.MessageThread)
+	rootMessageMap := make(map[int64]map[int64]*dto.Message)
+	for sId, rootMsgIds := range sessionRootMsgIds {
+		threadMap[sId] = make(map[int64]*model.MessageThread)
+		rootMessageMap[sId] = make(map[int64]*dto.Message)
+		threads, errThread := l.appCtx.MessageThreadModel().FindThreads(sId, rootMsgIds)
+		if errThread != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryUserThreads %d, %v", sId, errThread)
+			return nil, errThread
+		}
+		for _, thread := range threads {
+			threadMap[sId][thread.RootMsgId] = thread
+		}
+		for _, rootMessage := range l.findMessagesByIds(req.UId, sId, rootMsgIds, claims) {
+			rootMessageMap[sId][rootMessage.MsgId] = rootMessage
+		}
+	}
+	dtoThreads := make([]*dto.UserThread, 0)
+	for _, userThread := range userThreads {
+		dtoThread := &dto.UserThread{
+			SId:         userThread.SessionId,
+			RootMsgId:   userThread.RootMsgId,
+			JoinTime:    userThread.CreateTime,
+			ActiveTime:  userThread.UpdateTime,
+			RootMessage: rootMessageMap[userThread.SessionId][userThread.RootMsgId],
+		}
+		if thread, ok := threadMap[userThread.SessionId][userThread.RootMsgId]; ok {
+			dtoThread.ReplyCount = thread.ReplyCount
+			dtoThread.LastReplyMsgId = thread.LastReplyMsgId
+			dtoThread.LastReplyTime = thread.LastReplyTime
+		}
+		dtoThreads = append(dtoThreads, dtoThread)
+	}
+	return &dto.QueryUserThreadsRes{Data: dtoThreads}, nil
+}
+
+// fillMessageThreads 填充根消息的回复数和最后回复时间
+func (l *MessageLogic) fillMessageThreads(messages []*dto.Message, claims baseDto.ThkClaims) {
+	sessionMessages := make(map[int64]map[int64]*dto.Message)
+	for _, message := range messages {
+		if message.Type < 0 || message.SId <= 0 {
+			continue
+		}
+		if sessionMessages[message.SId] == nil {
+			sessionMessages[message.SId] = make(map[int64]*dto.Message)
+		}
+		sessionMessages[message.SId][message.MsgId] = message
+	}
+	for sId, msgMap := range sessionMessages {
+		msgIds := make([]int64, 0, len(msgMap))
+		for msgId := range msgMap {
+			msgIds = append(msgIds, msgId)
+		}
+		threads, err := l.appCtx.MessageThreadModel().FindThreads(sId, msgIds)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillMessageThreads %d %v", sId, err)
+			continue
+		}
+		for _, thread := range threads {
+			if message, ok := msgMap[thread.RootMsgId]; ok {
+				message.ReplyCount = thread.ReplyCount
+				message.LastReplyTime = thread.LastReplyTime
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+// isUnreadCounted 计入未读数的消息, 状态操作消息和撤回消息不计入
+func isUnreadCounted(msgType int) bool {
+	return msgType >= 0 && msgType != model.MsgTypeRevoke
+}
+
+// incrUnreadCount 写扩散会话发送消息后增加接收人的未读数, 超级群按已读游标计算不在此维护
+func (l *MessageLogic) incrUnreadCount(req dto.SendMessageReq, receiverUIds []int64, claims baseDto.ThkClaims) {
+	if !isUnreadCounted(req.Type) {
+		return
+	}
+	uIds := make([]int64, 0, len(receiverUIds))
+	for _, uId := range receiverUIds {
+		if uId != req.FUid {
+			uIds = append(uIds, uId)
+		}
+	}
+	if len(uIds) == 0 {
+		return
+	}
+	if err := l.appCtx.UserSessionModel().IncrUnreadCount(uIds, req.SId, mentionedReceivers(req, uIds)); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("incrUnreadCount %v, %v", req, err)
+	}
+}
+
+// decrUnreadCount 已读消息后减少未读数, userMessages需为设置已读前查询的消息
+func (l *MessageLogic) decrUnreadCount(uId, sId int64, userMessages []*model.UserMessage, claims baseDto.ThkClaims) {
+	count, mentionCount := 0, 0
+	for _, userMessage := range userMessages {
+		if userMessage.MsgId == 0 || userMessage.FromUserId == uId || !isUnreadCounted(userMessage.MsgType) {
+			continue
+		}
+		if userMessage.Status&model.MsgStatusServerRead > 0 {
+			continue
+		}
+		count++
+		if isUserMentioned(userMessage.AtUsers, uId) {
+			mentionCount++
+		}
+	}
+	if count == 0 {
+		return
+	}
+	if err := l.appCtx.UserSessionModel().DecrUnreadCount(uId, sId, count, mentionCount); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("decrUnreadCount %d %d, %v", uId, sId, err)
+	}
+}
@@ -11,6 +11,10 @@ import (
 	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
 )
 
+const (
+	unreadCountBatchSize = 200 // 超级群未读数每批计算的会话数
+)
+
 type SessionLogic struct {
 	appCtx *app.Context
 }
@@ -236,7 +240,7 @@ func (l *SessionLogic) UpdateSession(req dto.UpdateSessionReq, claims baseDto.Th
 
 func (l *SessionLogic) UpdateSessionType(req dto.UpdateSessionTypeReq, claims baseDto.ThkClaims) error {
 	lockKey := fmt.Sprintf(sessionUpdateLockKey, l.appCtx.Config().Name, req.Id)
-	locker := l.appCtx.NewLocker(lockKey, 1000, 1000)
+	locker := l.appCtx.NewLocker(lockKey, 1000, promoteLockTimeout)
 	success, lockErr := locker.Lock()
 	if lockErr != nil || !success {
 		return baseErrorx.ErrServerBusy
@@ -246,11 +250,25 @@ func (l *SessionLogic) UpdateSessionType(req dto.UpdateSessionTypeReq, claims ba
 			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("release locker success: %t, error: %s", success, lockErr.Error())
 		}
 	}()
-	err := l.appCtx.SessionModel().UpdateSessionType(req.Id, req.Type)
+	if req.Type == model.SuperGroupSessionType {
+		// 群升级为超级群需要迁移历史消息
+		session, err := l.appCtx.SessionModel().FindSession(req.Id)
+		if err != nil {
+			return err
+		}
+		if session.Type == model.GroupSessionType {
+			return l.promoteSuperGroup(session, claims)
+		}
+	}
+	return l.updateSessionType(req.Id, req.Type)
+}
+
+func (l *SessionLogic) updateSessionType(sId int64, sessionType int) error {
+	err := l.appCtx.SessionModel().UpdateSessionType(sId, sessionType)
 	if err != nil {
 		return err
 	}
-	sessionUsers, errSessionUsers := l.appCtx.SessionUserModel().FindAllSessionUsers(req.Id)
+	sessionUsers, errSessionUsers := l.appCtx.SessionUserModel().FindAllSessionUsers(sId)
 	if errSessionUsers != nil {
 		return errSessionUsers
 	}
@@ -258,9 +276,26 @@ func (l *SessionLogic) UpdateSessionType(req dto.UpdateSessionTypeReq, claims ba
 	for _, su := range sessionUsers {
 		uIds = append(uIds, su.UserId)
 	}
-	err = l.appCtx.UserSessionModel().UpdateUserSessionType(uIds, req.Id, req.Type)
+	err = l.appCtx.UserSessionModel().UpdateUserSessionType(uIds, sId, sessionType)
 	if err == nil {
-		err = l.appCtx.SessionUserModel().UpdateType(req.Id, req.Type)
+		err = l.appCtx.SessionUserModel().UpdateType(sId, sessionType)
+	}
+	return err
+}
+
+// UpdateSessionRetention 更新会话单独配置的消息保留规则, 由清理任务在下次执行时生效
+func (l *SessionLogic) UpdateSessionRetention(req dto.UpdateSessionRetentionReq, claims baseDto.ThkClaims) error {
+	if (req.Days != nil && *req.Days < -1) || (req.Count != nil && *req.Count < -1) {
+		return baseErrorx.ErrParamsError
+	}
+	session, err := l.appCtx.SessionModel().FindSession(req.Id)
+	if err != nil || session.Id <= 0 {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("UpdateSessionRetention %v, %v", req, err)
+		return errorx.ErrSessionInvalid
+	}
+	err = l.appCtx.SessionModel().UpdateRetention(req.Id, req.Days, req.Count)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("UpdateSessionRetention %v, %v", req, err)
 	}
 	return err
 }
@@ -302,6 +337,7 @@ func (l *SessionLogic) SearchUserSessions(req dto.SearchUserSessionReq, claims b
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("SearchUserSessions, %v %v", req, err)
 		return nil, err
 	}
+	l.fillSuperGroupUserSessions(userSessions, claims)
 	dtoUserSessions := make([]*dto.UserSession, 0)
 	for _, userSession := range userSessions {
 		dtoUserSession := l.convUserSession(userSession)
@@ -316,6 +352,7 @@ func (l *SessionLogic) QueryLatestUserSessions(req dto.QueryLatestUserSessionReq
 		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("QueryLatestUserSessions, %v %v", req, err)
 		return nil, err
 	}
+	l.fillSuperGroupUserSessions(userSessions, claims)
 	dtoUserSessions := make([]*dto.UserSession, 0)
 	for _, userSession := range userSessions {
 		dtoUserSession := l.convUserSession(userSession)
@@ -324,6 +361,119 @@ func (l *SessionLogic) QueryLatestUserSessions(req dto.QueryLatestUserSessionReq
 	return &dto.QueryLatestUserSessionsRes{Data: dtoUserSessions}, nil
 }
 
+func (l *SessionLogic) GetUserSessionUnreadTotal(req dto.GetUserSessionUnreadTotalReq, claims baseDto.ThkClaims) (*dto.GetUserSessionUnreadTotalRes, error) {
+	unread, err := l.appCtx.UserSessionModel().SumUnreadCount(req.UId)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetUserSessionUnreadTotal, %v %v", req, err)
+		return nil, err
+	}
+	res := &dto.GetUserSessionUnreadTotalRes{UnreadCount: unread.UnreadCount, MentionCount: unread.MentionCount}
+	superGroupSessions, errSuperGroup := l.appCtx.UserSessionModel().FindUserSessionsByType(req.UId, model.SuperGroupSessionType)
+	if errSuperGroup != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("GetUserSessionUnreadTotal, %v %v", req, errSuperGroup)
+		return nil, errSuperGroup
+	}
+	l.fillSuperGroupUnreadCounts(superGroupSessions, claims)
+	for _, userSession := range superGroupSessions {
+		res.UnreadCount += userSession.UnreadCount
+		res.MentionCount += userSession.MentionCount
+	}
+	return res, nil
+}
+
+// fillSuperGroupUserSessions 超级群的未读数和最后一条消息不写入user_session, 查询时批量补齐
+func (l *SessionLogic) fillSuperGroupUserSessions(userSessions []*model.UserSession, claims baseDto.ThkClaims) {
+	superGroupSessions := make([]*model.UserSession, 0)
+	sessionIds := make([]int64, 0)
+	for _, userSession := range userSessions {
+		if userSession.Type == model.SuperGroupSessionType && userSession.Deleted == 0 {
+			superGroupSessions = append(superGroupSessions, userSession)
+			sessionIds = append(sessionIds, userSession.SessionId)
+		}
+	}
+	if len(superGroupSessions) == 0 {
+		return
+	}
+	l.fillSuperGroupUnreadCounts(superGroupSessions, claims)
+	sessions, err := l.appCtx.SessionModel().FindSessions(sessionIds)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillSuperGroupUserSessions, %v %v", sessionIds, err)
+		return
+	}
+	sessionMap := make(map[int64]*model.Session)
+	for _, session := range sessions {
+		sessionMap[session.Id] = session
+	}
+	for _, userSession := range superGroupSessions {
+		session, ok := sessionMap[userSession.SessionId]
+		if !ok {
+			continue
+		}
+		userSession.LastMsgId = session.LastMsgId
+		userSession.LastMsgType = session.LastMsgType
+		userSession.LastMsgFUid = session.LastMsgFUid
+		userSession.LastMsgBody = session.LastMsgBody
+		userSession.LastMsgTime = session.LastMsgTime
+	}
+}
+
+// fillSuperGroupUnreadCounts 超级群不维护未读数, 按已读游标分批计算, 从未读过(包括游标上线前的存量成员)时从加入会话的时间开始计算
+func (l *SessionLogic) fillSuperGroupUnreadCounts(userSessions []*model.UserSession, claims baseDto.ThkClaims) {
+	for start := 0; start < len(userSessions); start += unreadCountBatchSize {
+		end := start + unreadCountBatchSize
+		if end > len(userSessions) {
+			end = len(userSessions)
+		}
+		l.fillSuperGroupUnreadCountBatch(userSessions[start:end], claims)
+	}
+}
+
+func (l *SessionLogic) fillSuperGroupUnreadCountBatch(userSessions []*model.UserSession, claims baseDto.ThkClaims) {
+	uId := int64(0)
+	readTimes := make(map[int64]int64)
+	for _, userSession := range userSessions {
+		if userSession.Type != model.SuperGroupSessionType || userSession.Deleted == 1 {
+			continue
+		}
+		uId = userSession.UserId
+		readTimes[userSession.SessionId] = superGroupReadTime(userSession)
+	}
+	if len(readTimes) == 0 {
+		return
+	}
+	counts, err := l.appCtx.SessionMessageModel().CountUnreadMessages(uId, readTimes)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillSuperGroupUnreadCounts, %d %v %v", uId, readTimes, err)
+		return
+	}
+	atUsersMap, errAtUsers := l.appCtx.SessionMessageModel().FindUnreadAtUsers(uId, readTimes)
+	if errAtUsers != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("fillSuperGroupUnreadCounts, %d %v %v", uId, readTimes, errAtUsers)
+	}
+	for _, userSession := range userSessions {
+		if _, ok := readTimes[userSession.SessionId]; !ok {
+			continue
+		}
+		userSession.UnreadCount = counts[userSession.SessionId]
+		userSession.MentionCount = 0
+		atUsers := atUsersMap[userSession.SessionId]
+		for i := range atUsers {
+			if isUserMentioned(&atUsers[i], userSession.UserId) {
+				userSession.MentionCount++
+			}
+		}
+	}
+}
+
+// superGroupReadTime 超级群已读的服务端时间, 没有已读游标时以成员加入会话的时间兜底, 加入前的消息不计入未读;
+// 草稿/置顶/免打扰等会更新userSession的更新时间, 不能作为已读时间
+func superGroupReadTime(userSession *model.UserSession) int64 {
+	if userSession.ReadMsgTime > 0 {
+		return userSession.ReadMsgTime
+	}
+	return userSession.CreateTime
+}
+
 func (l *SessionLogic) GetUserSession(uId, sId int64, claims baseDto.ThkClaims) (*dto.UserSession, error) {
 	userSession, err := l.appCtx.UserSessionModel().GetUserSession(uId, sId)
 	if err != nil {
@@ -345,6 +495,18 @@ func (l *SessionLogic) GetUserSessionByEntityId(req *dto.QueryUserSessionReq, cl
 }
 
 func (l *SessionLogic) convUserSession(userSession *model.UserSession) *dto.UserSession {
+	var lastMessage *dto.LastMessage
+	if userSession.LastMsgId > 0 {
+		lastMessage = &dto.LastMessage{
+			MsgId: userSession.LastMsgId,
+			Type:  userSession.LastMsgType,
+			FUid:  userSession.LastMsgFUid,
+			CTime: userSession.LastMsgTime,
+		}
+		if userSession.LastMsgBody != nil {
+			lastMessage.Body = *userSession.LastMsgBody
+		}
+	}
 	return &dto.UserSession{
 		SId:          userSession.SessionId,
 		Type:         userSession.Type,
@@ -360,6 +522,12 @@ func (l *SessionLogic) convUserSession(userSession *model.UserSession) *dto.User
 		NoteName:     userSession.NoteName,
 		NoteAvatar:   userSession.NoteAvatar,
 		Deleted:      userSession.Deleted,
+		UnreadCount:  userSession.UnreadCount,
+		MentionCount: userSession.MentionCount,
+		LastMessage:  lastMessage,
+		Draft:        convDraft(userSession),
+		ReadSeq:      userSession.ReadSeq,
+		ReadMsgTime:  userSession.ReadMsgTime,
 		CTime:        userSession.CreateTime,
 		MTime:        userSession.UpdateTime,
 	}
@@ -0,0 +1,27 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+func TestSuperGroupReadTime(t *testing.T) {
+	cases := []struct {
+		name        string
+		userSession *model.UserSession
+		want        int64
+	}{
+		{"read cursor", &model.UserSession{ReadMsgTime: 300, UpdateTime: 200, CreateTime: 100}, 300},
+		{"fallback join time", &model.UserSession{UpdateTime: 200, CreateTime: 100}, 100},
+		{"update time ignored", &model.UserSession{UpdateTime: 200}, 0},
+		{"nothing set", &model.UserSession{}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := superGroupReadTime(c.userSession); got != c.want {
+				t.Errorf("superGroupReadTime() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
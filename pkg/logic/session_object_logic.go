@@ -67,6 +67,16 @@ func (l *SessionObjectLogic) GetObjectByKey(req dto.GetDownloadUrlReq, claims ba
 		// 鉴权
 		userSessionTableName := l.appCtx.UserSessionModel().GenUserSessionTableName(req.UId)
 		object, err = l.appCtx.ObjectModel().FindObjectByUId(req.Id, req.UId, userSessionTableName)
+		if err == nil && object.Id == 0 {
+			// 不在对象所属会话中时, 收藏过引用该对象的消息也可以下载
+			favorite, errFavorite := l.appCtx.UserFavoriteObjectModel().HasObject(req.UId, req.Id)
+			if errFavorite != nil {
+				return nil, errFavorite
+			}
+			if favorite {
+				object, err = l.appCtx.ObjectModel().FindObject(req.Id)
+			}
+		}
 	}
 
 	if err != nil || object.Id == 0 {
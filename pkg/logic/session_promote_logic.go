@@ -0,0 +1,338 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	baseErrorx "github.com/thk-im/thk-im-base-server/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	promoteLockTimeout = 30 * 1000
+
+	// 标记群正在升级, 阻止新的群聊发送登记, 返回仍未结束的发送数
+	blockGroupSendsScript = `redis.call("SET", KEYS[2], 1, "PX", ARGV[2]) ` +
+		`redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[1]) ` +
+		`return redis.call("ZCARD", KEYS[1])`
+)
+
+// shouldPromote 群增加addCount个成员后是否需要升级为超级群
+func (l *SessionLogic) shouldPromote(session *model.Session, addCount int) bool {
+	if session.Type != model.GroupSessionType {
+		return false
+	}
+	count, err := l.appCtx.SessionUserModel().FindSessionUserCount(session.Id)
+	if err != nil {
+		return false
+	}
+	return l.appCtx.MsgApiConfig().IM.SuperGroupPromotion.ShouldPromote(count + addCount)
+}
+
+// promoteIfNeeded 调用方需持有会话锁. 增员成功后成员数超过阈值时升级为超级群, 升级失败不影响增员, 下次增员时重试
+func (l *SessionLogic) promoteIfNeeded(session *model.Session, claims baseDto.ThkClaims) {
+	if !l.shouldPromote(session, 0) {
+		return
+	}
+	if err := l.promoteSuperGroup(session, claims); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteIfNeeded %d, %v", session.Id, err)
+		return
+	}
+	session.Type = model.SuperGroupSessionType
+}
+
+// PromoteSuperGroup 把群升级为超级群, 已经是超级群时直接返回
+func (l *SessionLogic) PromoteSuperGroup(sId int64, claims baseDto.ThkClaims) error {
+	lockKey := fmt.Sprintf(sessionUpdateLockKey, l.appCtx.Config().Name, sId)
+	locker := l.appCtx.NewLocker(lockKey, 1000, promoteLockTimeout)
+	success, lockErr := locker.Lock()
+	if lockErr != nil || !success {
+		return baseErrorx.ErrServerBusy
+	}
+	defer func() {
+		if success, lockErr = locker.Release(); lockErr != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("release locker success: %t, error: %s", success, lockErr.Error())
+		}
+	}()
+	session, err := l.appCtx.SessionModel().FindSession(sId)
+	if err != nil || session.Id <= 0 {
+		return errorx.ErrSessionInvalid
+	}
+	if session.Type == model.SuperGroupSessionType {
+		return nil
+	}
+	if session.Type != model.GroupSessionType {
+		return errorx.ErrSessionInvalid
+	}
+	return l.promoteSuperGroup(session, claims)
+}
+
+// promoteSuperGroup 调用方需持有会话锁. 先阻止新的群聊发送并等待已登记的发送结束, 迁移期间不会有按群聊写入的新消息.
+// 最近的历史消息保留原有的会话序号写入会话消息表, 序号上线前的消息按时间顺序分配新序号, 再切换会话类型
+func (l *SessionLogic) promoteSuperGroup(session *model.Session, claims baseDto.ThkClaims) error {
+	if err := l.blockGroupSends(session.Id, claims); err != nil {
+		return err
+	}
+	defer l.unblockGroupSends(session.Id, claims)
+	sessionUsers, err := l.appCtx.SessionUserModel().FindAllSessionUsers(session.Id)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup %d, %v", session.Id, err)
+		return err
+	}
+	members := make([]*model.SessionUser, 0, len(sessionUsers))
+	for _, su := range sessionUsers {
+		if su.Deleted == 0 {
+			members = append(members, su)
+		}
+	}
+	history, err := l.findPromoteHistory(session)
+	if err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup history %d, %v", session.Id, err)
+		return err
+	}
+	maxSeq, unsequenced := promoteHistorySeqs(history)
+	if len(history) > 0 {
+		// 会话序号推进到迁移的最大序号之后, 再为没有序号的消息分配序号
+		messageLogic := NewMessageLogic(l.appCtx)
+		lastSeq, errSeq := messageLogic.allocMessageSeqs(session, maxSeq, unsequenced, claims)
+		if errSeq != nil {
+			return errSeq
+		}
+		assignPromoteHistorySeqs(history, lastSeq)
+		if err = l.appCtx.SessionMessageModel().InsertMessages(session.Id, history); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup copy %d, %v", session.Id, err)
+			return err
+		}
+	}
+	if err = l.updateSessionType(session.Id, model.SuperGroupSessionType); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup %d, %v", session.Id, err)
+		return err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		latest := history[i]
+		if !isUnreadCounted(latest.MsgType) {
+			continue
+		}
+		lastMessage := newLastMessage(latest.MsgId, latest.MsgType, latest.FromUserId, latest.MsgContent, latest.CreateTime)
+		if errLast := l.appCtx.SessionModel().UpdateLastMessage(session.Id, lastMessage); errLast != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("promoteSuperGroup last message %d, %v", session.Id, errLast)
+		}
+		break
+	}
+	l.initReadCursors(session.Id, members, history, maxSeq, claims)
+	l.appCtx.Logger().WithFields(logrus.Fields(claims)).Infof("promoteSuperGroup %d, members: %d, history: %d", session.Id, len(members), len(history))
+	return nil
+}
+
+// blockGroupSends 标记群正在升级并等待已登记的群聊发送结束, 登记超时的发送不再等待
+func (l *SessionLogic) blockGroupSends(sId int64, claims baseDto.ThkClaims) error {
+	keys := []string{
+		fmt.Sprintf(sessionSendingKey, l.appCtx.Config().Name, sId),
+		fmt.Sprintf(sessionPromotingKey, l.appCtx.Config().Name, sId),
+	}
+	deadline := time.Now().Add(2 * groupSendGuardTimeout * time.Millisecond)
+	for {
+		sending, err := l.appCtx.RedisCache().Eval(context.Background(), blockGroupSendsScript, keys, time.Now().UnixMilli(), promoteLockTimeout).Int64()
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("blockGroupSends %d, %v", sId, err)
+			l.unblockGroupSends(sId, claims)
+			return err
+		}
+		if sending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			l.unblockGroupSends(sId, claims)
+			return baseErrorx.ErrServerBusy
+		}
+		time.Sleep(groupSendGuardRetry)
+	}
+}
+
+func (l *SessionLogic) unblockGroupSends(sId int64, claims baseDto.ThkClaims) {
+	key := fmt.Sprintf(sessionPromotingKey, l.appCtx.Config().Name, sId)
+	if err := l.appCtx.RedisCache().Del(context.Background(), key).Err(); err != nil {
+		l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("unblockGroupSends %d, %v", sId, err)
+	}
+}
+
+// findPromoteHistory 合并所有成员用户消息表中的记录和会话待投递表中的记录, 后者包含异步落库尚未写入用户消息表的消息,
+// 单个成员删除消息或较晚加入不影响迁移的历史. 返回按时间升序、需要迁移的最近消息
+func (l *SessionLogic) findPromoteHistory(session *model.Session) ([]*model.SessionMessage, error) {
+	historyCount := l.appCtx.MsgApiConfig().IM.SuperGroupPromotion.HistoryCount
+	userMessages, err := l.appCtx.UserMessageModel().GetLatestSessionMessages(session.Id, historyCount)
+	if err != nil {
+		return nil, err
+	}
+	messages := make(map[int64]*model.SessionMessage)
+	for _, um := range userMessages {
+		if m, ok := messages[um.MsgId]; ok {
+			if um.Seq > m.Seq {
+				m.Seq = um.Seq
+			}
+			if um.BurnAfterRead == 1 {
+				m.BurnAfterRead = 1
+			}
+			continue
+		}
+		messages[um.MsgId] = &model.SessionMessage{
+			MsgId:         um.MsgId,
+			ClientId:      um.ClientId,
+			SessionId:     session.Id,
+			Seq:           um.Seq,
+			FromUserId:    um.FromUserId,
+			MsgType:       um.MsgType,
+			MsgContent:    um.MsgContent,
+			AtUsers:       um.AtUsers,
+			ReplyMsgId:    um.ReplyMsgId,
+			ExtData:       um.ExtData,
+			TtlMs:         um.TtlMs,
+			BurnAfterRead: um.BurnAfterRead,
+			ExpireTime:    um.ExpireTime,
+			CreateTime:    um.CreateTime,
+			UpdateTime:    um.UpdateTime,
+		}
+	}
+	outboxes, err := l.appCtx.MessageOutboxModel().FindSessionOutboxes(session.Id, 0, historyCount)
+	if err != nil {
+		return nil, err
+	}
+	for _, outbox := range outboxes {
+		msg := &dto.Message{}
+		if errJson := json.Unmarshal([]byte(outbox.MsgBody), msg); errJson != nil || msg.Type < 0 {
+			continue
+		}
+		if m, ok := messages[msg.MsgId]; ok {
+			if msg.Seq > m.Seq {
+				m.Seq = msg.Seq
+			}
+			continue
+		}
+		var burnAfterRead int8
+		if msg.BurnAfterRead {
+			burnAfterRead = 1
+		}
+		messages[msg.MsgId] = &model.SessionMessage{
+			MsgId:         msg.MsgId,
+			ClientId:      msg.CId,
+			SessionId:     session.Id,
+			Seq:           msg.Seq,
+			FromUserId:    msg.FUid,
+			MsgType:       msg.Type,
+			MsgContent:    msg.Body,
+			AtUsers:       msg.AtUsers,
+			ReplyMsgId:    msg.RMsgId,
+			ExtData:       msg.ExtData,
+			TtlMs:         msg.TtlMs,
+			BurnAfterRead: burnAfterRead,
+			ExpireTime:    msg.ExpireTime,
+			CreateTime:    msg.CTime,
+			UpdateTime:    outbox.UpdateTime,
+		}
+	}
+	history := make([]*model.SessionMessage, 0, len(messages))
+	for _, m := range messages {
+		history = append(history, m)
+	}
+	history = filterPromoteHistory(history, session.MsgSeq > 0)
+	if len(history) > historyCount {
+		history = history[len(history)-historyCount:]
+	}
+	return history, nil
+}
+
+// filterPromoteHistory 按时间升序返回需要迁移的消息. 超级群中的消息对所有成员可见, 跳过阅后即焚消息和指定接收人的消息:
+// 会话开始分配序号后序号为0的消息是指定接收人的消息, 早于第一条有序号消息的是分配序号之前发给全体成员的消息
+func filterPromoteHistory(messages []*model.SessionMessage, seqStarted bool) []*model.SessionMessage {
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].CreateTime != messages[j].CreateTime {
+			return messages[i].CreateTime < messages[j].CreateTime
+		}
+		return messages[i].MsgId < messages[j].MsgId
+	})
+	seqStartTime := int64(math.MaxInt64)
+	for _, m := range messages {
+		if m.Seq > 0 {
+			seqStartTime = m.CreateTime
+			break
+		}
+	}
+	if seqStartTime == math.MaxInt64 && seqStarted {
+		seqStartTime = math.MinInt64
+	}
+	result := make([]*model.SessionMessage, 0, len(messages))
+	for _, m := range messages {
+		if m.BurnAfterRead == 1 || (m.Seq <= 0 && m.CreateTime >= seqStartTime) {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// promoteHistorySeqs 返回迁移的消息中最大的原有序号和没有序号的消息数
+func promoteHistorySeqs(history []*model.SessionMessage) (int64, int) {
+	maxSeq, unsequenced := int64(0), 0
+	for _, m := range history {
+		if m.Seq <= 0 {
+			unsequenced++
+		} else if m.Seq > maxSeq {
+			maxSeq = m.Seq
+		}
+	}
+	return maxSeq, unsequenced
+}
+
+// assignPromoteHistorySeqs 保留消息原有的序号, 客户端本地的序号和缺失检测不受影响; 没有序号的消息按时间顺序分配以lastSeq结尾的连续序号
+func assignPromoteHistorySeqs(history []*model.SessionMessage, lastSeq int64) {
+	_, unsequenced := promoteHistorySeqs(history)
+	seq := lastSeq - int64(unsequenced)
+	for _, m := range history {
+		if m.Seq <= 0 {
+			seq++
+			m.Seq = seq
+		}
+	}
+}
+
+// promoteReadCursorSeq 已读的服务端时间对应的序号, 即已读消息中最大的原有序号(不大于maxSeq);
+// 迁移时新分配序号的是序号上线前的消息, 早于所有有序号的消息, 其已读状态由已读时间表示
+func promoteReadCursorSeq(history []*model.SessionMessage, readTime, maxSeq int64) int64 {
+	seq := int64(0)
+	for _, m := range history {
+		if m.Seq <= maxSeq && m.Seq > seq && model.MsgIdTime(m.MsgId) <= readTime {
+			seq = m.Seq
+		}
+	}
+	return seq
+}
+
+// initReadCursors 以成员最新一条已读或自己发送的消息初始化超级群已读游标, 保留升级前的未读状态
+func (l *SessionLogic) initReadCursors(sId int64, members []*model.SessionUser, history []*model.SessionMessage, maxSeq int64, claims baseDto.ThkClaims) {
+	for _, member := range members {
+		userMessage, err := l.appCtx.UserMessageModel().FindLatestReadUserMessage(member.UserId, sId)
+		if err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("initReadCursors %d %d, %v", sId, member.UserId, err)
+			continue
+		}
+		if userMessage.MsgId == 0 {
+			continue
+		}
+		readTime := model.MsgIdTime(userMessage.MsgId)
+		seq := promoteReadCursorSeq(history, readTime, maxSeq)
+		if _, err = l.appCtx.UserSessionModel().UpdateReadCursor(member.UserId, sId, seq, readTime); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("initReadCursors %d %d, %v", sId, member.UserId, err)
+			continue
+		}
+		if err = l.appCtx.SessionUserModel().UpdateReadCursor(sId, member.UserId, seq, readTime); err != nil {
+			l.appCtx.Logger().WithFields(logrus.Fields(claims)).Errorf("initReadCursors %d %d, %v", sId, member.UserId, err)
+		}
+	}
+}
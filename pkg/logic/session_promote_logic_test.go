@@ -0,0 +1,130 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thk-im/thk-im-msgapi-server/pkg/model"
+)
+
+func promoteMessage(msgId, seq, cTime int64, burn int8) *model.SessionMessage {
+	return &model.SessionMessage{MsgId: msgId, Seq: seq, CreateTime: cTime, BurnAfterRead: burn}
+}
+
+func promoteMsgIds(messages []*model.SessionMessage) []int64 {
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.MsgId)
+	}
+	return ids
+}
+
+func TestFilterPromoteHistory(t *testing.T) {
+	cases := []struct {
+		name       string
+		messages   []*model.SessionMessage
+		seqStarted bool
+		want       []int64
+	}{
+		{"empty", nil, false, []int64{}},
+		{
+			"sort by time then msg id",
+			[]*model.SessionMessage{promoteMessage(3, 3, 30, 0), promoteMessage(2, 2, 10, 0), promoteMessage(1, 1, 10, 0)},
+			false, []int64{1, 2, 3},
+		},
+		{
+			"skip burn after read",
+			[]*model.SessionMessage{promoteMessage(1, 1, 10, 0), promoteMessage(2, 2, 20, 1), promoteMessage(3, 3, 30, 0)},
+			false, []int64{1, 3},
+		},
+		{
+			"keep unsequenced before first seq",
+			[]*model.SessionMessage{promoteMessage(1, 0, 10, 0), promoteMessage(2, 0, 20, 0), promoteMessage(3, 1, 30, 0)},
+			true, []int64{1, 2, 3},
+		},
+		{
+			"skip targeted after first seq",
+			[]*model.SessionMessage{promoteMessage(1, 1, 10, 0), promoteMessage(2, 0, 20, 0), promoteMessage(3, 2, 30, 0)},
+			true, []int64{1, 3},
+		},
+		{
+			"no seq before seq started",
+			[]*model.SessionMessage{promoteMessage(1, 0, 10, 0), promoteMessage(2, 0, 20, 0)},
+			false, []int64{1, 2},
+		},
+		{
+			"no seq after seq started",
+			[]*model.SessionMessage{promoteMessage(1, 0, 10, 0), promoteMessage(2, 0, 20, 0)},
+			true, []int64{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := promoteMsgIds(filterPromoteHistory(c.messages, c.seqStarted))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("filterPromoteHistory() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAssignPromoteHistorySeqs(t *testing.T) {
+	cases := []struct {
+		name    string
+		seqs    []int64
+		lastSeq int64
+		want    []int64
+	}{
+		{"empty", []int64{}, 10, []int64{}},
+		{"keep existing seqs", []int64{8, 9, 10}, 10, []int64{8, 9, 10}},
+		{"unsequenced ending at last seq", []int64{0, 0, 0}, 10, []int64{8, 9, 10}},
+		{"unsequenced after max seq", []int64{0, 0, 5, 6}, 12, []int64{11, 12, 5, 6}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			history := make([]*model.SessionMessage, 0, len(c.seqs))
+			for i, seq := range c.seqs {
+				history = append(history, promoteMessage(int64(i+1), seq, int64(i+1), 0))
+			}
+			assignPromoteHistorySeqs(history, c.lastSeq)
+			got := make([]int64, 0, len(history))
+			for _, m := range history {
+				got = append(got, m.Seq)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("assignPromoteHistorySeqs() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPromoteReadCursorSeq(t *testing.T) {
+	base := int64(1700000000000)
+	// 序号上线前的消息迁移时分配了新序号11, 原有的最大序号为10
+	history := []*model.SessionMessage{
+		promoteMessage(model.MinMsgIdAt(base+5), 11, base+5, 0),
+		promoteMessage(model.MinMsgIdAt(base+10), 8, base+10, 0),
+		promoteMessage(model.MinMsgIdAt(base+20), 9, base+20, 0),
+		promoteMessage(model.MinMsgIdAt(base+30), 10, base+30, 0),
+	}
+	cases := []struct {
+		name     string
+		history  []*model.SessionMessage
+		readTime int64
+		want     int64
+	}{
+		{"empty history", nil, base + 100, 0},
+		{"read nothing", history, base + 1, 0},
+		{"read only unsequenced", history, base + 6, 0},
+		{"read at message", history, base + 20, 9},
+		{"read between messages", history, base + 25, 9},
+		{"read all", history, base + 100, 10},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := promoteReadCursorSeq(c.history, c.readTime, 10); got != c.want {
+				t.Errorf("promoteReadCursorSeq(%d) = %d, want %d", c.readTime, got, c.want)
+			}
+		})
+	}
+}
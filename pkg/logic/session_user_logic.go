@@ -45,7 +45,8 @@ func (l *SessionLogic) QuerySessionUserCount(sessionId int64, claims baseDto.Thk
 
 func (l *SessionLogic) AddSessionUser(sid int64, req dto.SessionAddUserReq, claims baseDto.ThkClaims) error {
 	lockKey := fmt.Sprintf(sessionUpdateLockKey, l.appCtx.Config().Name, sid)
-	locker := l.appCtx.NewLocker(lockKey, 1000, 1000)
+	// 增员可能触发升级为超级群, 锁的超时时间需要覆盖迁移历史消息
+	locker := l.appCtx.NewLocker(lockKey, 1000, promoteLockTimeout)
 	success, lockErr := locker.Lock()
 	if lockErr != nil || !success {
 		return baseErrorx.ErrServerBusy
@@ -59,8 +60,9 @@ func (l *SessionLogic) AddSessionUser(sid int64, req dto.SessionAddUserReq, clai
 	if err != nil {
 		return err
 	}
+	// 增员后需要升级的群按超级群的成员上限校验, 增员成功后才升级, 被拒绝或失败的增员不会触发升级
 	maxCount := l.appCtx.Config().IM.MaxGroupMember
-	if session.Type == model.SuperGroupSessionType {
+	if session.Type == model.SuperGroupSessionType || l.shouldPromote(session, len(req.UIds)) {
 		maxCount = l.appCtx.Config().IM.MaxSuperGroupMember
 	}
 	roles := make([]int, 0)
@@ -81,8 +83,11 @@ func (l *SessionLogic) AddSessionUser(sid int64, req dto.SessionAddUserReq, clai
 			noteAvatars = append(noteAvatars, "")
 		}
 	}
-	_, err = l.appCtx.SessionUserModel().AddUser(session, entityIds, req.UIds, roles, noteNames, noteAvatars, maxCount)
-	return err
+	if _, err = l.appCtx.SessionUserModel().AddUser(session, entityIds, req.UIds, roles, noteNames, noteAvatars, maxCount); err != nil {
+		return err
+	}
+	l.promoteIfNeeded(session, claims)
+	return nil
 }
 
 func (l *SessionLogic) DelSessionUser(sid int64, deleteMsg bool, req dto.SessionDelUserReq, claims baseDto.ThkClaims) error {
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+)
+
+type (
+	MessageEditHistory struct {
+		Id         int64  `gorm:"id" json:"id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		MsgId      int64  `gorm:"msg_id" json:"msg_id"`
+		UserId     int64  `gorm:"user_id" json:"user_id"`
+		MsgContent string `gorm:"msg_content" json:"msg_content"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageEditHistoryModel interface {
+		Insert(m *MessageEditHistory) error
+		FindHistories(sessionId, msgId int64) ([]*MessageEditHistory, error)
+		DeleteHistoriesBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultMessageEditHistoryModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageEditHistoryModel) Insert(m *MessageEditHistory) error {
+	return d.db.Table(d.genMessageEditHistoryTableName(m.SessionId)).Create(m).Error
+}
+
+func (d defaultMessageEditHistoryModel) FindHistories(sessionId, msgId int64) ([]*MessageEditHistory, error) {
+	result := make([]*MessageEditHistory, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and msg_id = ? order by create_time", d.genMessageEditHistoryTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgId).Scan(&result).Error
+	return result, err
+}
+
+// DeleteHistoriesBefore 删除会话中msg_id小于before的编辑记录, 每次最多删除count条
+func (d defaultMessageEditHistoryModel) DeleteHistoriesBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genMessageEditHistoryTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageEditHistoryModel) genMessageEditHistoryTableName(sessionId int64) string {
+	return fmt.Sprintf("message_edit_history_%d", sessionId%(d.shards))
+}
+
+func NewMessageEditHistoryModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageEditHistoryModel {
+	return defaultMessageEditHistoryModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
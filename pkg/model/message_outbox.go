@@ -0,0 +1,99 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	OutboxStatusPending   = 0
+	OutboxStatusDelivered = 1
+	OutboxStatusFailed    = 2
+)
+
+type (
+	MessageOutbox struct {
+		Id               int64  `gorm:"id" json:"id"`
+		SessionId        int64  `gorm:"session_id" json:"session_id"`
+		MsgId            int64  `gorm:"msg_id" json:"msg_id"`
+		SessionType      int    `gorm:"session_type" json:"session_type"`
+		MsgBody          string `gorm:"msg_body" json:"msg_body"`
+		Receivers        string `gorm:"receivers" json:"receivers"`
+		OfflineReceivers string `gorm:"offline_receivers" json:"offline_receivers"`
+		Status           int    `gorm:"status" json:"status"`
+		RetryCount       int    `gorm:"retry_count" json:"retry_count"`
+		NextRetryTime    int64  `gorm:"next_retry_time" json:"next_retry_time"`
+		CreateTime       int64  `gorm:"create_time" json:"create_time"`
+		UpdateTime       int64  `gorm:"update_time" json:"update_time"`
+	}
+
+	MessageOutboxModel interface {
+		Insert(outbox *MessageOutbox) error
+		FindPendingOutboxes(shard int64, now int64, count int) ([]*MessageOutbox, error)
+		FindSessionOutboxes(sessionId int64, cTime int64, count int) ([]*MessageOutbox, error)
+		UpdateOutboxStatus(sessionId, id int64, status, retryCount int, nextRetryTime int64) error
+		DeleteDeliveredOutboxes(shard int64, before int64, count int) (int64, error)
+		GenMessageOutboxTableName(sessionId int64) string
+		Shards() int64
+	}
+
+	defaultMessageOutboxModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageOutboxModel) Insert(outbox *MessageOutbox) error {
+	return d.db.Table(d.genMessageOutboxTableName(outbox.SessionId)).Clauses(clause.OnConflict{DoNothing: true}).Create(outbox).Error
+}
+
+func (d defaultMessageOutboxModel) FindPendingOutboxes(shard int64, now int64, count int) ([]*MessageOutbox, error) {
+	result := make([]*MessageOutbox, 0)
+	sqlStr := fmt.Sprintf("select * from message_outbox_%d where status = ? and next_retry_time <= ? order by id limit ?", shard)
+	err := d.db.Raw(sqlStr, OutboxStatusPending, now, count).Scan(&result).Error
+	return result, err
+}
+
+// FindSessionOutboxes 查询会话中create_time >= cTime的最近count条记录(含已投递未清理的), 按时间倒序
+func (d defaultMessageOutboxModel) FindSessionOutboxes(sessionId int64, cTime int64, count int) ([]*MessageOutbox, error) {
+	result := make([]*MessageOutbox, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and create_time >= ? order by create_time desc limit ?",
+		d.genMessageOutboxTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, cTime, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageOutboxModel) UpdateOutboxStatus(sessionId, id int64, status, retryCount int, nextRetryTime int64) error {
+	sqlStr := fmt.Sprintf("update %s set status = ?, retry_count = ?, next_retry_time = ?, update_time = ? where id = ? and session_id = ?",
+		d.genMessageOutboxTableName(sessionId))
+	return d.db.Exec(sqlStr, status, retryCount, nextRetryTime, time.Now().UnixMilli(), id, sessionId).Error
+}
+
+// DeleteDeliveredOutboxes 删除分表中投递成功时间早于before的记录
+func (d defaultMessageOutboxModel) DeleteDeliveredOutboxes(shard int64, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from message_outbox_%d where status = ? and update_time < ? limit ?", shard)
+	tx := d.db.Exec(sqlStr, OutboxStatusDelivered, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageOutboxModel) GenMessageOutboxTableName(sessionId int64) string {
+	return d.genMessageOutboxTableName(sessionId)
+}
+
+func (d defaultMessageOutboxModel) Shards() int64 {
+	return d.shards
+}
+
+func (d defaultMessageOutboxModel) genMessageOutboxTableName(sessionId int64) string {
+	return fmt.Sprintf("message_outbox_%d", sessionId%(d.shards))
+}
+
+func NewMessageOutboxModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageOutboxModel {
+	return defaultMessageOutboxModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
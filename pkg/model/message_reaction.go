@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	MessageReaction struct {
+		Id         int64  `gorm:"id" json:"id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		MsgId      int64  `gorm:"msg_id" json:"msg_id"`
+		UserId     int64  `gorm:"user_id" json:"user_id"`
+		Emoji      string `gorm:"emoji" json:"emoji"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageReactionCount struct {
+		MsgId int64  `gorm:"msg_id" json:"msg_id"`
+		Emoji string `gorm:"emoji" json:"emoji"`
+		Count int    `gorm:"count" json:"count"`
+	}
+
+	MessageReactionModel interface {
+		AddReaction(m *MessageReaction) (int64, error)
+		DelReaction(sessionId, msgId, userId int64, emoji string) (int64, error)
+		FindReactions(sessionId, msgId int64, offset, count int) ([]*MessageReaction, error)
+		CountReactions(sessionId int64, msgIds []int64) ([]*MessageReactionCount, error)
+		FindUserReactions(sessionId, userId int64, msgIds []int64) ([]*MessageReaction, error)
+		DeleteReactionsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultMessageReactionModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageReactionModel) AddReaction(m *MessageReaction) (int64, error) {
+	tx := d.db.Table(d.genMessageReactionTableName(m.SessionId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageReactionModel) DelReaction(sessionId, msgId, userId int64, emoji string) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id = ? and user_id = ? and emoji = ?", d.genMessageReactionTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, msgId, userId, emoji)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageReactionModel) FindReactions(sessionId, msgId int64, offset, count int) ([]*MessageReaction, error) {
+	result := make([]*MessageReaction, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and msg_id = ? order by create_time limit ? offset ?", d.genMessageReactionTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgId, count, offset).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageReactionModel) CountReactions(sessionId int64, msgIds []int64) ([]*MessageReactionCount, error) {
+	result := make([]*MessageReactionCount, 0)
+	sqlStr := fmt.Sprintf("select msg_id, emoji, count(0) as count from %s where session_id = ? and msg_id in ? group by msg_id, emoji",
+		d.genMessageReactionTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgIds).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageReactionModel) FindUserReactions(sessionId, userId int64, msgIds []int64) ([]*MessageReaction, error) {
+	result := make([]*MessageReaction, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and msg_id in ? and user_id = ?", d.genMessageReactionTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgIds, userId).Scan(&result).Error
+	return result, err
+}
+
+// DeleteReactionsBefore 删除会话中msg_id小于before的表情回应, 每次最多删除count条
+func (d defaultMessageReactionModel) DeleteReactionsBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genMessageReactionTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageReactionModel) genMessageReactionTableName(sessionId int64) string {
+	return fmt.Sprintf("message_reaction_%d", sessionId%(d.shards))
+}
+
+func NewMessageReactionModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageReactionModel {
+	return defaultMessageReactionModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
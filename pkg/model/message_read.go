@@ -0,0 +1,73 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	MessageRead struct {
+		Id         int64 `gorm:"id" json:"id"`
+		SessionId  int64 `gorm:"session_id" json:"session_id"`
+		MsgId      int64 `gorm:"msg_id" json:"msg_id"`
+		UserId     int64 `gorm:"user_id" json:"user_id"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageReadCount struct {
+		MsgId int64 `gorm:"msg_id" json:"msg_id"`
+		Count int   `gorm:"count" json:"count"`
+	}
+
+	MessageReadModel interface {
+		AddMessageRead(m *MessageRead) (int64, error)
+		CountMessageReads(sessionId int64, msgIds []int64) ([]*MessageReadCount, error)
+		FindMessageReads(sessionId, msgId int64) ([]*MessageRead, error)
+		DeleteReadsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultMessageReadModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageReadModel) AddMessageRead(m *MessageRead) (int64, error) {
+	tx := d.db.Table(d.genMessageReadTableName(m.SessionId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageReadModel) CountMessageReads(sessionId int64, msgIds []int64) ([]*MessageReadCount, error) {
+	result := make([]*MessageReadCount, 0)
+	sqlStr := fmt.Sprintf("select msg_id, count(0) as count from %s where session_id = ? and msg_id in ? group by msg_id",
+		d.genMessageReadTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgIds).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageReadModel) FindMessageReads(sessionId, msgId int64) ([]*MessageRead, error) {
+	result := make([]*MessageRead, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and msg_id = ? order by create_time", d.genMessageReadTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, msgId).Scan(&result).Error
+	return result, err
+}
+
+// DeleteReadsBefore 删除会话中msg_id小于before的已读记录, 每次最多删除count条
+func (d defaultMessageReadModel) DeleteReadsBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genMessageReadTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageReadModel) genMessageReadTableName(sessionId int64) string {
+	return fmt.Sprintf("message_read_%d", sessionId%(d.shards))
+}
+
+func NewMessageReadModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageReadModel {
+	return defaultMessageReadModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+)
+
+const (
+	MessageReviewPending  = 0
+	MessageReviewApproved = 1
+	MessageReviewRejected = 2
+)
+
+type (
+	MessageReview struct {
+		Id         int64  `gorm:"id" json:"id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		MsgId      int64  `gorm:"msg_id" json:"msg_id"`
+		FromUserId int64  `gorm:"from_user_id" json:"from_user_id"`
+		Categories string `gorm:"categories" json:"categories"`
+		MsgContent string `gorm:"msg_content" json:"msg_content"`
+		Status     int8   `gorm:"status" json:"status"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageReviewModel interface {
+		Insert(m *MessageReview) error
+		FindReviews(sessionId, ctime int64, count int) ([]*MessageReview, error)
+	}
+
+	defaultMessageReviewModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageReviewModel) Insert(m *MessageReview) error {
+	return d.db.Table(d.genMessageReviewTableName(m.SessionId)).Create(m).Error
+}
+
+func (d defaultMessageReviewModel) FindReviews(sessionId, ctime int64, count int) ([]*MessageReview, error) {
+	result := make([]*MessageReview, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and create_time < ? order by create_time desc limit 0, ?", d.genMessageReviewTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, ctime, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageReviewModel) genMessageReviewTableName(sessionId int64) string {
+	return fmt.Sprintf("message_review_%d", sessionId%(d.shards))
+}
+
+func NewMessageReviewModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageReviewModel {
+	return defaultMessageReviewModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+)
+
+type (
+	MessageRevokeAudit struct {
+		Id           int64  `gorm:"id" json:"id"`
+		SessionId    int64  `gorm:"session_id" json:"session_id"`
+		MsgId        int64  `gorm:"msg_id" json:"msg_id"`
+		FromUserId   int64  `gorm:"from_user_id" json:"from_user_id"`
+		OperatorId   int64  `gorm:"operator_id" json:"operator_id"`
+		OperatorRole int    `gorm:"operator_role" json:"operator_role"`
+		MsgContent   string `gorm:"msg_content" json:"msg_content"`
+		CreateTime   int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageRevokeAuditModel interface {
+		Insert(m *MessageRevokeAudit) error
+		FindRevokeAudits(sessionId, ctime int64, count int) ([]*MessageRevokeAudit, error)
+	}
+
+	defaultMessageRevokeAuditModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageRevokeAuditModel) Insert(m *MessageRevokeAudit) error {
+	return d.db.Table(d.genMessageRevokeAuditTableName(m.SessionId)).Create(m).Error
+}
+
+func (d defaultMessageRevokeAuditModel) FindRevokeAudits(sessionId, ctime int64, count int) ([]*MessageRevokeAudit, error) {
+	result := make([]*MessageRevokeAudit, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and create_time < ? order by create_time desc limit 0, ?", d.genMessageRevokeAuditTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, ctime, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultMessageRevokeAuditModel) genMessageRevokeAuditTableName(sessionId int64) string {
+	return fmt.Sprintf("message_revoke_audit_%d", sessionId%(d.shards))
+}
+
+func NewMessageRevokeAuditModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageRevokeAuditModel {
+	return defaultMessageRevokeAuditModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+)
+
+type (
+	MessageSearchDoc struct {
+		Id         int64  `gorm:"id" json:"id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		MsgId      int64  `gorm:"msg_id" json:"msg_id"`
+		FromUserId int64  `gorm:"from_user_id" json:"from_user_id"`
+		MsgType    int    `gorm:"msg_type" json:"msg_type"`
+		MsgContent string `gorm:"msg_content" json:"msg_content"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageSearchQuery struct {
+		SessionIds []int64
+		Keywords   string
+		FromUserId *int64
+		MsgType    *int
+		TimeFrom   int64 // 包含, 为0不限制
+		TimeTo     int64 // 不包含, 为0不限制
+		// CursorTime/CursorMsgId 翻页游标, 从该消息之前开始查询, 为0从最新开始
+		CursorTime  int64
+		CursorMsgId int64
+		Count       int
+	}
+
+	// MessageSearchIndex 消息搜索索引, 按会话维护消息文档, 默认实现为mysql ngram全文索引, 可替换为其他搜索引擎
+	MessageSearchIndex interface {
+		IndexMessage(doc *MessageSearchDoc) error
+		UpdateMessageContent(sessionId, msgId int64, content string) error
+		DeleteMessages(sessionId int64, msgIds []int64, from, to int64) error
+		DeleteMessagesBefore(sessionId, before int64, count int) (int64, error)
+		SearchMessages(query *MessageSearchQuery) ([]*MessageSearchDoc, error)
+	}
+
+	mysqlMessageSearchIndex struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d mysqlMessageSearchIndex) IndexMessage(doc *MessageSearchDoc) error {
+	sqlStr := fmt.Sprintf("insert into %s (session_id, msg_id, from_user_id, msg_type, msg_content, create_time) values (?, ?, ?, ?, ?, ?) "+
+		"on duplicate key update msg_content = ?", d.genMessageSearchTableName(doc.SessionId))
+	return d.db.Exec(sqlStr, doc.SessionId, doc.MsgId, doc.FromUserId, doc.MsgType, doc.MsgContent, doc.CreateTime, doc.MsgContent).Error
+}
+
+func (d mysqlMessageSearchIndex) UpdateMessageContent(sessionId, msgId int64, content string) error {
+	sqlStr := fmt.Sprintf("update %s set msg_content = ? where session_id = ? and msg_id = ?", d.genMessageSearchTableName(sessionId))
+	return d.db.Exec(sqlStr, content, sessionId, msgId).Error
+}
+
+// DeleteMessages msgIds不为空时按消息id删除, 否则按时间范围删除
+func (d mysqlMessageSearchIndex) DeleteMessages(sessionId int64, msgIds []int64, from, to int64) error {
+	if len(msgIds) > 0 {
+		sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id in ?", d.genMessageSearchTableName(sessionId))
+		return d.db.Exec(sqlStr, sessionId, msgIds).Error
+	}
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and create_time >= ? and create_time <= ?", d.genMessageSearchTableName(sessionId))
+	return d.db.Exec(sqlStr, sessionId, from, to).Error
+}
+
+// DeleteMessagesBefore 删除会话中msg_id小于before的索引, 每次最多删除count条
+func (d mysqlMessageSearchIndex) DeleteMessagesBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genMessageSearchTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+// SearchMessages 按分表分别查询后合并, 结果按消息时间倒序
+func (d mysqlMessageSearchIndex) SearchMessages(query *MessageSearchQuery) ([]*MessageSearchDoc, error) {
+	shardSessionIds := make(map[string][]int64)
+	for _, sessionId := range query.SessionIds {
+		tableName := d.genMessageSearchTableName(sessionId)
+		shardSessionIds[tableName] = append(shardSessionIds[tableName], sessionId)
+	}
+	// 按短语匹配, 去掉布尔模式下的双引号
+	keywords := fmt.Sprintf("\"%s\"", strings.ReplaceAll(query.Keywords, "\"", " "))
+	result := make([]*MessageSearchDoc, 0)
+	for tableName, sessionIds := range shardSessionIds {
+		sqlBuffer := bytes.NewBufferString(fmt.Sprintf("select * from %s where session_id in ? and match(msg_content) against(? in boolean mode) ", tableName))
+		params := []interface{}{sessionIds, keywords}
+		if query.FromUserId != nil {
+			sqlBuffer.WriteString("and from_user_id = ? ")
+			params = append(params, *query.FromUserId)
+		}
+		if query.MsgType != nil {
+			sqlBuffer.WriteString("and msg_type = ? ")
+			params = append(params, *query.MsgType)
+		}
+		if query.TimeFrom > 0 {
+			sqlBuffer.WriteString("and create_time >= ? ")
+			params = append(params, query.TimeFrom)
+		}
+		if query.TimeTo > 0 {
+			sqlBuffer.WriteString("and create_time < ? ")
+			params = append(params, query.TimeTo)
+		}
+		if query.CursorMsgId > 0 {
+			sqlBuffer.WriteString("and (create_time < ? or (create_time = ? and msg_id < ?)) ")
+			params = append(params, query.CursorTime, query.CursorTime, query.CursorMsgId)
+		}
+		sqlBuffer.WriteString("order by create_time desc, msg_id desc limit ?")
+		params = append(params, query.Count)
+		docs := make([]*MessageSearchDoc, 0)
+		if err := d.db.Raw(sqlBuffer.String(), params...).Scan(&docs).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, docs...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreateTime == result[j].CreateTime {
+			return result[i].MsgId > result[j].MsgId
+		}
+		return result[i].CreateTime > result[j].CreateTime
+	})
+	if len(result) > query.Count {
+		result = result[:query.Count]
+	}
+	return result, nil
+}
+
+func (d mysqlMessageSearchIndex) genMessageSearchTableName(sessionId int64) string {
+	return fmt.Sprintf("message_search_%d", sessionId%(d.shards))
+}
+
+func NewMysqlMessageSearchIndex(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageSearchIndex {
+	return mysqlMessageSearchIndex{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+)
+
+type (
+	// MessageSnapshot 合并转发的聊天记录快照, 按快照id分表, 创建后不再修改
+	MessageSnapshot struct {
+		Id         int64  `gorm:"id" json:"id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		FromSId    int64  `gorm:"from_sid" json:"from_sid"`
+		FromUserId int64  `gorm:"from_user_id" json:"from_user_id"`
+		MsgCount   int    `gorm:"msg_count" json:"msg_count"`
+		Content    string `gorm:"content" json:"content"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+	}
+
+	MessageSnapshotModel interface {
+		NewSnapshotId() int64
+		Insert(m *MessageSnapshot) error
+		FindSnapshot(id int64) (*MessageSnapshot, error)
+		Delete(id int64) error
+		DeleteSessionSnapshotsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultMessageSnapshotModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultMessageSnapshotModel) NewSnapshotId() int64 {
+	return d.snowflakeNode.Generate().Int64()
+}
+
+func (d defaultMessageSnapshotModel) Insert(m *MessageSnapshot) error {
+	return d.db.Table(d.genMessageSnapshotTableName(m.Id)).Create(m).Error
+}
+
+func (d defaultMessageSnapshotModel) FindSnapshot(id int64) (*MessageSnapshot, error) {
+	result := &MessageSnapshot{}
+	sqlStr := fmt.Sprintf("select * from %s where id = ?", d.genMessageSnapshotTableName(id))
+	err := d.db.Raw(sqlStr, id).Scan(result).Error
+	return result, err
+}
+
+func (d defaultMessageSnapshotModel) Delete(id int64) error {
+	sqlStr := fmt.Sprintf("delete from %s where id = ?", d.genMessageSnapshotTableName(id))
+	return d.db.Exec(sqlStr, id).Error
+}
+
+// DeleteSessionSnapshotsBefore 删除所有分表中目标会话快照id小于before的快照, 每个分表每次最多删除count条
+func (d defaultMessageSnapshotModel) DeleteSessionSnapshotsBefore(sessionId, before int64, count int) (int64, error) {
+	total := int64(0)
+	for i := int64(0); i < d.shards; i++ {
+		sqlStr := fmt.Sprintf("delete from message_snapshot_%d where session_id = ? and id < ? limit ?", i)
+		tx := d.db.Exec(sqlStr, sessionId, before, count)
+		if tx.Error != nil {
+			return total, tx.Error
+		}
+		total += tx.RowsAffected
+	}
+	return total, nil
+}
+
+func (d defaultMessageSnapshotModel) genMessageSnapshotTableName(id int64) string {
+	return fmt.Sprintf("message_snapshot_%d", id%(d.shards))
+}
+
+func NewMessageSnapshotModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageSnapshotModel {
+	return defaultMessageSnapshotModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
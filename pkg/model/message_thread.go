@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"time"
+)
+
+type (
+	MessageThread struct {
+		Id             int64 `gorm:"id" json:"id"`
+		SessionId      int64 `gorm:"session_id" json:"session_id"`
+		RootMsgId      int64 `gorm:"root_msg_id" json:"root_msg_id"`
+		ReplyCount     int   `gorm:"reply_count" json:"reply_count"`
+		LastReplyMsgId int64 `gorm:"last_reply_msg_id" json:"last_reply_msg_id"`
+		LastReplyTime  int64 `gorm:"last_reply_time" json:"last_reply_time"`
+		CreateTime     int64 `gorm:"create_time" json:"create_time"`
+		UpdateTime     int64 `gorm:"update_time" json:"update_time"`
+	}
+
+	MessageThreadModel interface {
+		IncrThreadReply(sessionId, rootMsgId, replyMsgId, replyTime int64) error
+		DecrThreadReply(sessionId, rootMsgId int64, count int) error
+		FindThreads(sessionId int64, rootMsgIds []int64) ([]*MessageThread, error)
+		DeleteThreadsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultMessageThreadModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+// IncrThreadReply 根消息回复数加1, 并记录最后一条回复
+func (d defaultMessageThreadModel) IncrThreadReply(sessionId, rootMsgId, replyMsgId, replyTime int64) error {
+	now := time.Now().UnixMilli()
+	sqlStr := fmt.Sprintf("insert into %s (session_id, root_msg_id, reply_count, last_reply_msg_id, last_reply_time, create_time, update_time) "+
+		"values (?, ?, 1, ?, ?, ?, ?) on duplicate key update reply_count = reply_count + 1, "+
+		"last_reply_msg_id = if(last_reply_time > ?, last_reply_msg_id, ?), last_reply_time = greatest(last_reply_time, ?), update_time = ?",
+		d.genMessageThreadTableName(sessionId))
+	return d.db.Exec(sqlStr, sessionId, rootMsgId, replyMsgId, replyTime, now, now, replyTime, replyMsgId, replyTime, now).Error
+}
+
+// DecrThreadReply 回复被撤回或删除后根消息回复数减count, 最小为0
+func (d defaultMessageThreadModel) DecrThreadReply(sessionId, rootMsgId int64, count int) error {
+	sqlStr := fmt.Sprintf("update %s set reply_count = greatest(reply_count - ?, 0), update_time = ? where session_id = ? and root_msg_id = ?",
+		d.genMessageThreadTableName(sessionId))
+	return d.db.Exec(sqlStr, count, time.Now().UnixMilli(), sessionId, rootMsgId).Error
+}
+
+func (d defaultMessageThreadModel) FindThreads(sessionId int64, rootMsgIds []int64) ([]*MessageThread, error) {
+	result := make([]*MessageThread, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? and root_msg_id in ?", d.genMessageThreadTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId, rootMsgIds).Scan(&result).Error
+	return result, err
+}
+
+// DeleteThreadsBefore 删除会话中根消息id小于before的话题, 回复的msg_id总是大于根消息, 根消息保留时回复也保留
+func (d defaultMessageThreadModel) DeleteThreadsBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and root_msg_id < ? limit ?", d.genMessageThreadTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultMessageThreadModel) genMessageThreadTableName(sessionId int64) string {
+	return fmt.Sprintf("message_thread_%d", sessionId%(d.shards))
+}
+
+func NewMessageThreadModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) MessageThreadModel {
+	return defaultMessageThreadModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -20,6 +20,7 @@ type (
 
 	ObjectModel interface {
 		AddSessions(ids []int64, sId int64) error
+		RemoveSessions(ids []int64, sId int64) error
 		Insert(sId int64, engine, key string) (int64, error)
 		FindObject(id int64) (*Object, error)
 		FindObjectByUId(id, uId int64, usTableName string) (*Object, error)
@@ -55,6 +56,22 @@ func (d defaultObjectModel) AddSessions(ids []int64, sId int64) error {
 	return nil
 }
 
+// RemoveSessions 取消对象对会话的授权
+func (d defaultObjectModel) RemoveSessions(ids []int64, sId int64) error {
+	shardIds := make(map[string][]int64)
+	for _, id := range ids {
+		tableName := d.genObjectTableName(id)
+		shardIds[tableName] = append(shardIds[tableName], id)
+	}
+	for tableName, v := range shardIds {
+		sql := fmt.Sprintf("delete from %s where id in ? and s_id = ?", tableName)
+		if err := d.db.Exec(sql, v, sId).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d defaultObjectModel) Insert(sId int64, engine, key string) (int64, error) {
 	id := d.snowflakeNode.Generate().Int64()
 	o := &Object{
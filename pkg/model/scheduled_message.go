@@ -0,0 +1,169 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+const (
+	ScheduledSessionMessage = 1
+	ScheduledSystemMessage  = 2
+
+	ScheduledStatusPending   = 0
+	ScheduledStatusSending   = 1
+	ScheduledStatusSent      = 2
+	ScheduledStatusCancelled = 3
+	ScheduledStatusFailed    = 4
+)
+
+type (
+	ScheduledMessage struct {
+		Id         int64  `gorm:"id" json:"id"`
+		Type       int    `gorm:"type" json:"type"`
+		FromUserId int64  `gorm:"from_user_id" json:"from_user_id"`
+		SessionId  int64  `gorm:"session_id" json:"session_id"`
+		MsgType    int    `gorm:"msg_type" json:"msg_type"`
+		Content    string `gorm:"content" json:"content"`
+		SendAt     int64  `gorm:"send_at" json:"send_at"`
+		Status     int    `gorm:"status" json:"status"`
+		MsgId      int64  `gorm:"msg_id" json:"msg_id"`
+		CreateTime int64  `gorm:"create_time" json:"create_time"`
+		UpdateTime int64  `gorm:"update_time" json:"update_time"`
+	}
+
+	ScheduledMessageModel interface {
+		Insert(m *ScheduledMessage) error
+		FindScheduledMessages(fromUId int64, sessionId *int64, offset, count int) ([]*ScheduledMessage, error)
+		FindDueScheduledMessages(shard int64, now int64, count int) ([]*ScheduledMessage, error)
+		CancelScheduledMessage(fromUId, id int64) (int64, error)
+		ClaimScheduledMessage(fromUId, id int64) (int64, error)
+		UpdateScheduledMessageStatus(fromUId, id int64, status int, msgId int64) error
+		FindStuckScheduledMessages(shard int64, before int64, count int) ([]*ScheduledMessage, error)
+		RecoverScheduledMessage(fromUId, id int64, status int, before int64) (int64, error)
+		Shards() int64
+	}
+
+	defaultScheduledMessageModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultScheduledMessageModel) Insert(m *ScheduledMessage) error {
+	now := time.Now().UnixMilli()
+	m.Id = d.snowflakeNode.Generate().Int64()
+	m.Status = ScheduledStatusPending
+	m.CreateTime = now
+	m.UpdateTime = now
+	return d.db.Table(d.genScheduledMessageTableName(m.FromUserId, m.Id)).Create(m).Error
+}
+
+// FindScheduledMessages 查询待发送的定时消息, 系统定时消息按消息id分散在各分表中, 需要查询所有分表后合并分页
+func (d defaultScheduledMessageModel) FindScheduledMessages(fromUId int64, sessionId *int64, offset, count int) ([]*ScheduledMessage, error) {
+	if fromUId > 0 {
+		return d.findShardScheduledMessages(d.genScheduledMessageTableName(fromUId, 0), fromUId, sessionId, offset, count)
+	}
+	result := make([]*ScheduledMessage, 0)
+	for i := int64(0); i < d.shards; i++ {
+		messages, err := d.findShardScheduledMessages(fmt.Sprintf("scheduled_message_%d", i), fromUId, sessionId, 0, offset+count)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, messages...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SendAt == result[j].SendAt {
+			return result[i].Id < result[j].Id
+		}
+		return result[i].SendAt < result[j].SendAt
+	})
+	if len(result) <= offset {
+		return make([]*ScheduledMessage, 0), nil
+	}
+	result = result[offset:]
+	if len(result) > count {
+		result = result[:count]
+	}
+	return result, nil
+}
+
+func (d defaultScheduledMessageModel) findShardScheduledMessages(tableName string, fromUId int64, sessionId *int64, offset, count int) ([]*ScheduledMessage, error) {
+	result := make([]*ScheduledMessage, 0)
+	sqlBuffer := bytes.NewBufferString("select * from " + tableName + " where from_user_id = ? and status = ? ")
+	var err error
+	if sessionId != nil {
+		sqlBuffer.WriteString("and session_id = ? order by send_at, id limit ? offset ?")
+		err = d.db.Raw(sqlBuffer.String(), fromUId, ScheduledStatusPending, *sessionId, count, offset).Scan(&result).Error
+	} else {
+		sqlBuffer.WriteString("order by send_at, id limit ? offset ?")
+		err = d.db.Raw(sqlBuffer.String(), fromUId, ScheduledStatusPending, count, offset).Scan(&result).Error
+	}
+	return result, err
+}
+
+func (d defaultScheduledMessageModel) FindDueScheduledMessages(shard int64, now int64, count int) ([]*ScheduledMessage, error) {
+	result := make([]*ScheduledMessage, 0)
+	sqlStr := fmt.Sprintf("select * from scheduled_message_%d where status = ? and send_at <= ? order by send_at limit ?", shard)
+	err := d.db.Raw(sqlStr, ScheduledStatusPending, now, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultScheduledMessageModel) CancelScheduledMessage(fromUId, id int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set status = ?, update_time = ? where id = ? and from_user_id = ? and status = ?",
+		d.genScheduledMessageTableName(fromUId, id))
+	tx := d.db.Exec(sqlStr, ScheduledStatusCancelled, time.Now().UnixMilli(), id, fromUId, ScheduledStatusPending)
+	return tx.RowsAffected, tx.Error
+}
+
+// ClaimScheduledMessage 将待发送状态改为发送中, 影响行数为1表示抢占成功
+func (d defaultScheduledMessageModel) ClaimScheduledMessage(fromUId, id int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set status = ?, update_time = ? where id = ? and from_user_id = ? and status = ?",
+		d.genScheduledMessageTableName(fromUId, id))
+	tx := d.db.Exec(sqlStr, ScheduledStatusSending, time.Now().UnixMilli(), id, fromUId, ScheduledStatusPending)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultScheduledMessageModel) UpdateScheduledMessageStatus(fromUId, id int64, status int, msgId int64) error {
+	sqlStr := fmt.Sprintf("update %s set status = ?, msg_id = ?, update_time = ? where id = ? and from_user_id = ?",
+		d.genScheduledMessageTableName(fromUId, id))
+	return d.db.Exec(sqlStr, status, msgId, time.Now().UnixMilli(), id, fromUId).Error
+}
+
+// FindStuckScheduledMessages 查询分表中发送中状态超过before仍未更新的定时消息
+func (d defaultScheduledMessageModel) FindStuckScheduledMessages(shard int64, before int64, count int) ([]*ScheduledMessage, error) {
+	result := make([]*ScheduledMessage, 0)
+	sqlStr := fmt.Sprintf("select * from scheduled_message_%d where status = ? and update_time < ? order by update_time limit ?", shard)
+	err := d.db.Raw(sqlStr, ScheduledStatusSending, before, count).Scan(&result).Error
+	return result, err
+}
+
+// RecoverScheduledMessage 将发送中状态超时的定时消息改为status, 影响行数为1表示恢复成功
+func (d defaultScheduledMessageModel) RecoverScheduledMessage(fromUId, id int64, status int, before int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set status = ?, update_time = ? where id = ? and from_user_id = ? and status = ? and update_time < ?",
+		d.genScheduledMessageTableName(fromUId, id))
+	tx := d.db.Exec(sqlStr, status, time.Now().UnixMilli(), id, fromUId, ScheduledStatusSending, before)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultScheduledMessageModel) Shards() int64 {
+	return d.shards
+}
+
+// genScheduledMessageTableName 用户的定时消息按发送者分表, 系统定时消息没有发送者, 按消息id分散到各分表
+func (d defaultScheduledMessageModel) genScheduledMessageTableName(fromUId, id int64) string {
+	if fromUId <= 0 {
+		return fmt.Sprintf("scheduled_message_%d", id%(d.shards))
+	}
+	return fmt.Sprintf("scheduled_message_%d", fromUId%(d.shards))
+}
+
+func NewScheduledMessageModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) ScheduledMessageModel {
+	return defaultScheduledMessageModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
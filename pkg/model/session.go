@@ -16,23 +16,40 @@ const (
 
 type (
 	Session struct {
-		Id           int64   `gorm:"id" json:"id"`
-		Name         string  `gorm:"name" json:"name"`
-		Remark       string  `gorm:"remark" json:"remark"`
-		FunctionFlag int64   `gorm:"function_flag" json:"function_flag"`
-		Type         int     `gorm:"type" json:"type"`
-		Mute         int8    `gorm:"mute" json:"mute"`
-		ExtData      *string `json:"ext_data" json:"ext_data"`
-		CreateTime   int64   `gorm:"create_time" json:"create_time"`
-		UpdateTime   int64   `gorm:"update_time" json:"update_time"`
-		Deleted      int8    `gorm:"deleted" json:"deleted"`
+		Id             int64   `gorm:"id" json:"id"`
+		Name           string  `gorm:"name" json:"name"`
+		Remark         string  `gorm:"remark" json:"remark"`
+		FunctionFlag   int64   `gorm:"function_flag" json:"function_flag"`
+		Type           int     `gorm:"type" json:"type"`
+		Mute           int8    `gorm:"mute" json:"mute"`
+		ExtData        *string `json:"ext_data" json:"ext_data"`
+		MsgSeq         int64   `gorm:"msg_seq" json:"msg_seq"`
+		LastMsgId      int64   `gorm:"last_msg_id" json:"last_msg_id"`
+		LastMsgType    int     `gorm:"last_msg_type" json:"last_msg_type"`
+		LastMsgFUid    int64   `gorm:"last_msg_fuid" json:"last_msg_fuid"`
+		LastMsgBody    *string `gorm:"last_msg_body" json:"last_msg_body"`
+		LastMsgTime    int64   `gorm:"last_msg_time" json:"last_msg_time"`
+		RetentionDays  int     `gorm:"retention_days" json:"retention_days"`
+		RetentionCount int64   `gorm:"retention_count" json:"retention_count"`
+		PurgedSeq      int64   `gorm:"purged_seq" json:"purged_seq"`
+		CreateTime     int64   `gorm:"create_time" json:"create_time"`
+		UpdateTime     int64   `gorm:"update_time" json:"update_time"`
+		Deleted        int8    `gorm:"deleted" json:"deleted"`
 	}
 
 	SessionModel interface {
 		UpdateSessionType(sessionId int64, sessionType int) error
 		UpdateSession(sessionId int64, name, remark *string, mute *int, extData *string, functionFlag *int64) error
 		FindSession(sessionId int64) (*Session, error)
+		FindSessions(sessionIds []int64) ([]*Session, error)
+		UpdateSessionMsgSeq(sessionId, seq int64) error
+		UpdatePurgedSeq(sessionId, seq int64) error
 		CreateEmptySession(sessionType int, extData *string, name string, remark string, functionFlag int64) (*Session, error)
+		UpdateLastMessage(sessionId int64, lastMessage *LastMessage) error
+		ResetLastMessage(sessionId int64, lastMessage *LastMessage) error
+		RevokeLastMessage(sessionId, msgId int64) error
+		UpdateLastMessageBody(sessionId, msgId int64, body string) error
+		UpdateRetention(sessionId int64, days *int, count *int64) error
 	}
 
 	defaultSessionModel struct {
@@ -81,6 +98,80 @@ func (d defaultSessionModel) FindSession(sessionId int64) (*Session, error) {
 	return session, err
 }
 
+// FindSessions 按分表批量查询会话
+func (d defaultSessionModel) FindSessions(sessionIds []int64) ([]*Session, error) {
+	sharedSessionIds := make(map[int64][]int64)
+	for _, sessionId := range sessionIds {
+		share := sessionId % d.shards
+		sharedSessionIds[share] = append(sharedSessionIds[share], sessionId)
+	}
+	result := make([]*Session, 0, len(sessionIds))
+	for k, v := range sharedSessionIds {
+		sessions := make([]*Session, 0)
+		sqlStr := fmt.Sprintf("select * from session_%d where id in ? and deleted = 0", k)
+		if err := d.db.Raw(sqlStr, v).Scan(&sessions).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, sessions...)
+	}
+	return result, nil
+}
+
+func (d defaultSessionModel) UpdateSessionMsgSeq(sessionId, seq int64) error {
+	sqlStr := fmt.Sprintf("update %s set msg_seq = ? where id = ? and msg_seq < ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, seq, sessionId, seq).Error
+}
+
+// UpdatePurgedSeq 记录超级群已被清理的最大消息序号, 只会增大
+func (d defaultSessionModel) UpdatePurgedSeq(sessionId, seq int64) error {
+	sqlStr := fmt.Sprintf("update %s set purged_seq = ? where id = ? and purged_seq < ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, seq, sessionId, seq).Error
+}
+
+// UpdateLastMessage 超级群的最后一条消息快照记录在session上, 只会被更新的消息覆盖
+func (d defaultSessionModel) UpdateLastMessage(sessionId int64, lastMessage *LastMessage) error {
+	sqlStr := fmt.Sprintf("update %s set last_msg_id = ?, last_msg_type = ?, last_msg_fuid = ?, last_msg_body = ?, last_msg_time = ? "+
+		"where id = ? and last_msg_id < ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, lastMessage.MsgId, lastMessage.MsgType, lastMessage.FromUserId, lastMessage.Body, lastMessage.CreateTime,
+		sessionId, lastMessage.MsgId).Error
+}
+
+func (d defaultSessionModel) ResetLastMessage(sessionId int64, lastMessage *LastMessage) error {
+	if lastMessage == nil {
+		lastMessage = &LastMessage{}
+	}
+	sqlStr := fmt.Sprintf("update %s set last_msg_id = ?, last_msg_type = ?, last_msg_fuid = ?, last_msg_body = ?, last_msg_time = ? "+
+		"where id = ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, lastMessage.MsgId, lastMessage.MsgType, lastMessage.FromUserId, lastMessage.Body, lastMessage.CreateTime,
+		sessionId).Error
+}
+
+func (d defaultSessionModel) RevokeLastMessage(sessionId, msgId int64) error {
+	sqlStr := fmt.Sprintf("update %s set last_msg_type = ?, last_msg_body = '' where id = ? and last_msg_id = ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, MsgTypeRevoke, sessionId, msgId).Error
+}
+
+func (d defaultSessionModel) UpdateLastMessageBody(sessionId, msgId int64, body string) error {
+	sqlStr := fmt.Sprintf("update %s set last_msg_body = ? where id = ? and last_msg_id = ?", d.genSessionTableName(sessionId))
+	return d.db.Exec(sqlStr, body, sessionId, msgId).Error
+}
+
+// UpdateRetention 更新会话单独配置的消息保留规则
+func (d defaultSessionModel) UpdateRetention(sessionId int64, days *int, count *int64) error {
+	if days == nil && count == nil {
+		return nil
+	}
+	updateMap := make(map[string]interface{})
+	if days != nil {
+		updateMap["retention_days"] = *days
+	}
+	if count != nil {
+		updateMap["retention_count"] = *count
+	}
+	updateMap["update_time"] = time.Now().UnixMilli()
+	return d.db.Table(d.genSessionTableName(sessionId)).Where("id = ?", sessionId).Updates(updateMap).Error
+}
+
 func (d defaultSessionModel) CreateEmptySession(sessionType int, extData *string, name string, remark string, functionFlag int64) (*Session, error) {
 	sessionId := int64(d.snowflakeNode.Generate())
 	currTime := time.Now().UnixMilli()
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+)
+
+type (
+	// SessionMention @全体成员的消息每个会话只记录一条, 查询时与user_mention合并
+	SessionMention struct {
+		Id         int64 `gorm:"id" json:"id"`
+		SessionId  int64 `gorm:"session_id" json:"session_id"`
+		MsgId      int64 `gorm:"msg_id" json:"msg_id"`
+		FromUserId int64 `gorm:"from_user_id" json:"from_user_id"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+	}
+
+	SessionMentionModel interface {
+		AddMention(mention *SessionMention) error
+		FindSessionMentions(sessionIds []int64, excludeUserId, ctime int64, count int) ([]*SessionMention, error)
+		DeleteMentionsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultSessionMentionModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultSessionMentionModel) AddMention(mention *SessionMention) error {
+	return d.db.Table(d.genSessionMentionTableName(mention.SessionId)).Clauses(clause.OnConflict{DoNothing: true}).Create(mention).Error
+}
+
+// FindSessionMentions 按时间倒序查询多个会话中@全体成员的记录, 不包含excludeUserId发送的, ctime为0时从最新开始
+func (d defaultSessionMentionModel) FindSessionMentions(sessionIds []int64, excludeUserId, ctime int64, count int) ([]*SessionMention, error) {
+	result := make([]*SessionMention, 0)
+	shardSIds := make(map[int64][]int64)
+	for _, sId := range sessionIds {
+		share := sId % d.shards
+		shardSIds[share] = append(shardSIds[share], sId)
+	}
+	for share, sIds := range shardSIds {
+		sqlStr := fmt.Sprintf("select * from %s where session_id in ? and from_user_id != ? ", d.genSessionMentionTableName(share))
+		params := []interface{}{sIds, excludeUserId}
+		if ctime > 0 {
+			sqlStr += "and create_time < ? "
+			params = append(params, ctime)
+		}
+		sqlStr += "order by create_time desc limit ?"
+		params = append(params, count)
+		mentions := make([]*SessionMention, 0)
+		if err := d.db.Raw(sqlStr, params...).Scan(&mentions).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, mentions...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreateTime > result[j].CreateTime
+	})
+	if len(result) > count {
+		result = result[:count]
+	}
+	return result, nil
+}
+
+// DeleteMentionsBefore 删除会话中msg_id小于before的@全体成员记录, 每次最多删除count条
+func (d defaultSessionMentionModel) DeleteMentionsBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genSessionMentionTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultSessionMentionModel) genSessionMentionTableName(sessionId int64) string {
+	return fmt.Sprintf("session_mention_%d", sessionId%(d.shards))
+}
+
+func NewSessionMentionModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) SessionMentionModel {
+	return defaultSessionMentionModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -6,10 +6,26 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/thk-im/thk-im-base-server/snowflake"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
 	"time"
 )
 
 const (
+	// MsgTypeText 文本消息
+	MsgTypeText = 1
+	// MsgTypeEmoji 表情消息
+	MsgTypeEmoji = 2
+	// MsgTypeAudio 语音消息
+	MsgTypeAudio = 3
+	// MsgTypeImage 图片消息
+	MsgTypeImage = 4
+	// MsgTypeRichText 富文本消息
+	MsgTypeRichText = 5
+	// MsgTypeVideo 视频消息
+	MsgTypeVideo = 6
+	// MsgTypeRecord 聊天记录消息
+	MsgTypeRecord = 7
 	// MsgTypeRevoke 撤回消息
 	MsgTypeRevoke = 100
 	// MsgTypeReceived 已接收消息
@@ -18,23 +34,39 @@ const (
 	MsgTypeRead = -2
 	// MsgTypeReedit 重编辑消息
 	MsgTypeReedit = -3
+	// MsgTypeExpired 消息过期销毁(定时销毁/阅后即焚)
+	MsgTypeExpired = -4
+	// MsgTypeReaction 消息表情回应变更
+	MsgTypeReaction = -5
+	// MsgTypePin 消息置顶变更
+	MsgTypePin = -6
+	// MsgTypeReadCount 群消息已读数变更
+	MsgTypeReadCount = -7
+	// MsgTypeDraft 会话草稿变更, 用于多端同步
+	MsgTypeDraft = -8
+	// MsgTypeReadCursor 超级群已读游标变更, 用于多端同步
+	MsgTypeReadCursor = -9
 )
 
 type (
 	SessionMessage struct {
-		Id         int64   `gorm:"id" json:"id"`
-		MsgId      int64   `gorm:"msg_id" json:"msg_id"`
-		ClientId   int64   `gorm:"client_id" json:"client_id"`
-		SessionId  int64   `gorm:"session_id" json:"session_id"`
-		FromUserId int64   `gorm:"from_user_id" json:"from_user_id"`
-		MsgType    int     `gorm:"msg_type" json:"msg_type"`
-		MsgContent string  `gorm:"msg_content" json:"msg_content"`
-		AtUsers    *string `gorm:"at_users" json:"at_users"`
-		ReplyMsgId *int64  `gorm:"reply_msg_id" json:"reply_msg_id"`
-		ExtData    *string `gorm:"ext_data" json:"ext_data"`
-		CreateTime int64   `gorm:"create_time" json:"create_time"`
-		UpdateTime int64   `gorm:"update_time" json:"update_time"`
-		Deleted    int8    `gorm:"deleted" json:"deleted"`
+		Id            int64   `gorm:"id" json:"id"`
+		MsgId         int64   `gorm:"msg_id" json:"msg_id"`
+		ClientId      int64   `gorm:"client_id" json:"client_id"`
+		SessionId     int64   `gorm:"session_id" json:"session_id"`
+		Seq           int64   `gorm:"seq" json:"seq"`
+		FromUserId    int64   `gorm:"from_user_id" json:"from_user_id"`
+		MsgType       int     `gorm:"msg_type" json:"msg_type"`
+		MsgContent    string  `gorm:"msg_content" json:"msg_content"`
+		AtUsers       *string `gorm:"at_users" json:"at_users"`
+		ReplyMsgId    *int64  `gorm:"reply_msg_id" json:"reply_msg_id"`
+		ExtData       *string `gorm:"ext_data" json:"ext_data"`
+		TtlMs         int64   `gorm:"ttl_ms" json:"ttl_ms"`
+		BurnAfterRead int8    `gorm:"burn_after_read" json:"burn_after_read"`
+		ExpireTime    int64   `gorm:"expire_time" json:"expire_time"`
+		CreateTime    int64   `gorm:"create_time" json:"create_time"`
+		UpdateTime    int64   `gorm:"update_time" json:"update_time"`
+		Deleted       int8    `gorm:"deleted" json:"deleted"`
 	}
 
 	SessionMessageModel interface {
@@ -42,11 +74,28 @@ type (
 		UpdateSessionMessageContent(sessionId, msgId, fUid int64, content string) (int64, error)
 		DeleteSessionMessage(sessionId, msgId int64, fUid int64) (int64, error)
 		DelMessages(sessionId int64, messageIds []int64, from, to int64) error
-		InsertMessage(clientId int64, fromUserId int64, sessionId int64, msgId int64, msgContent string, extData *string,
+		InsertMessage(clientId int64, fromUserId int64, sessionId int64, msgId int64, seq int64, msgContent string, extData *string,
 			msgType int, atUserIds *string, replayMsgId *int64, creatTime int64) (*SessionMessage, error)
+		InsertMessageWithOutbox(sessionMessage *SessionMessage, outbox *MessageOutbox, outboxTableName string) error
+		InsertMessages(sessionId int64, messages []*SessionMessage) error
 		FindMessageByClientId(sessionId, clientId, fromUId int64) (*SessionMessage, error)
 		FindSessionMessage(sessionId, msgId, fUid int64) (*SessionMessage, error)
+		FindSessionMessageByMsgId(sessionId, msgId int64) (*SessionMessage, error)
+		FindLatestSessionMessage(sessionId int64) (*SessionMessage, error)
 		GetSessionMessages(sessionId, ctime int64, offset, count int, msgIds []int64, asc int8) ([]*SessionMessage, error)
+		GetSessionMessagesBySeq(sessionId, fromSeq, toSeq int64, count int) ([]*SessionMessage, error)
+		GetSessionThreadReplies(sessionId, rootMsgId, ctime int64, count int) ([]*SessionMessage, error)
+		CountThreadReplies(sessionId int64, messageIds []int64, from, to int64) (map[int64]int, error)
+		FindExpiredSessionMessages(shard int64, now int64, count int) ([]*SessionMessage, error)
+		ExpireSessionMessage(sessionId, msgId int64) (int64, error)
+		FindMessageSessionIds(shard, fromSessionId int64, count int) ([]int64, error)
+		FindNthLatestMsgId(sessionId, n int64) (int64, error)
+		FindMaxSeqBefore(sessionId, before int64) (int64, error)
+		PurgeMessagesBefore(sessionId, before int64, count int) (int64, error)
+		PurgeDeletedMessages(shard, before int64, count int) (int64, error)
+		CountUnreadMessages(userId int64, readTimes map[int64]int64) (map[int64]int, error)
+		FindUnreadAtUsers(userId int64, readTimes map[int64]int64) (map[int64][]string, error)
+		Shards() int64
 	}
 
 	defaultSessionMessageModel struct {
@@ -61,37 +110,72 @@ func (d defaultSessionMessageModel) NewMsgId() int64 {
 	return d.snowflakeNode.Generate().Int64()
 }
 
+// MsgIdTime 返回snowflake消息id中的服务端生成时间(毫秒), 不受客户端时钟影响
+func MsgIdTime(msgId int64) int64 {
+	return (msgId >> (snowflake.NodeBits + snowflake.StepBits)) + snowflake.Epoch
+}
+
+// MinMsgIdAt 返回服务端时间t(毫秒)生成的最小消息id, 用于按服务端时间比较消息先后
+func MinMsgIdAt(t int64) int64 {
+	return (t - snowflake.Epoch) << (snowflake.NodeBits + snowflake.StepBits)
+}
+
 func (d defaultSessionMessageModel) UpdateSessionMessageContent(sessionId, msgId, fUid int64, content string) (int64, error) {
-	sqlStr := fmt.Sprintf("update %s set msg_content = ?, status , update_time = ?  where session_id = ? and msg_id = ? and from_user_id = ? ", d.genSessionMessageTableName(sessionId))
+	sqlStr := fmt.Sprintf("update %s set msg_content = ?, update_time = ? where session_id = ? and msg_id = ? and from_user_id = ? and deleted = 0", d.genSessionMessageTableName(sessionId))
 	tx := d.db.Exec(sqlStr, content, time.Now().UnixMilli(), sessionId, msgId, fUid)
 	return tx.RowsAffected, tx.Error
 }
 
 func (d defaultSessionMessageModel) DeleteSessionMessage(sessionId, msgId int64, fUid int64) (int64, error) {
-	sqlStr := fmt.Sprintf("update %s set deleted = 1 where session_id = ? and msg_id = ? and from_user_id = ? and deleted = 0", d.genSessionMessageTableName(sessionId))
-	tx := d.db.Exec(sqlStr, sessionId, msgId, fUid)
+	sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where session_id = ? and msg_id = ? and from_user_id = ? and deleted = 0", d.genSessionMessageTableName(sessionId))
+	tx := d.db.Exec(sqlStr, time.Now().UnixMilli(), sessionId, msgId, fUid)
 	return tx.RowsAffected, tx.Error
 }
 
 func (d defaultSessionMessageModel) DelMessages(sessionId int64, messageIds []int64, from, to int64) error {
 	if len(messageIds) > 0 {
-		sqlStr := fmt.Sprintf("update %s set deleted = 1 where session_id = ? and msg_id in ? and create_time >= ? and create_time <= ? ", d.genSessionMessageTableName(sessionId))
-		err := d.db.Exec(sqlStr, sessionId, messageIds, from, to).Error
+		sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where session_id = ? and msg_id in ? and create_time >= ? and create_time <= ? ", d.genSessionMessageTableName(sessionId))
+		err := d.db.Exec(sqlStr, time.Now().UnixMilli(), sessionId, messageIds, from, to).Error
 		return err
 	} else {
-		sqlStr := fmt.Sprintf("update %s set deleted = 1 where session_id = ? and create_time >= ? and create_time <= ?", d.genSessionMessageTableName(sessionId))
-		err := d.db.Exec(sqlStr, sessionId, from, to).Error
+		sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where session_id = ? and create_time >= ? and create_time <= ?", d.genSessionMessageTableName(sessionId))
+		err := d.db.Exec(sqlStr, time.Now().UnixMilli(), sessionId, from, to).Error
 		return err
 	}
 }
 
-func (d defaultSessionMessageModel) InsertMessage(clientId int64, fromUserId int64, sessionId int64, msgId int64,
+// CountThreadReplies 按根消息统计将被删除的话题回复数, 条件和DelMessages一致
+func (d defaultSessionMessageModel) CountThreadReplies(sessionId int64, messageIds []int64, from, to int64) (map[int64]int, error) {
+	rows := make([]*struct {
+		ReplyMsgId int64 `gorm:"reply_msg_id"`
+		Count      int   `gorm:"count"`
+	}, 0)
+	sqlBuffer := bytes.NewBufferString(fmt.Sprintf("select reply_msg_id, count(0) as count from %s where session_id = ? "+
+		"and reply_msg_id > 0 and msg_type >= 0 and msg_type != ? and deleted = 0 and create_time >= ? and create_time <= ? ",
+		d.genSessionMessageTableName(sessionId)))
+	var err error
+	if len(messageIds) > 0 {
+		sqlBuffer.WriteString("and msg_id in ? group by reply_msg_id")
+		err = d.db.Raw(sqlBuffer.String(), sessionId, MsgTypeRevoke, from, to, messageIds).Scan(&rows).Error
+	} else {
+		sqlBuffer.WriteString("group by reply_msg_id")
+		err = d.db.Raw(sqlBuffer.String(), sessionId, MsgTypeRevoke, from, to).Scan(&rows).Error
+	}
+	result := make(map[int64]int)
+	for _, row := range rows {
+		result[row.ReplyMsgId] = row.Count
+	}
+	return result, err
+}
+
+func (d defaultSessionMessageModel) InsertMessage(clientId int64, fromUserId int64, sessionId int64, msgId int64, seq int64,
 	msgContent string, extData *string, msgType int, atUserIds *string, replayMsgId *int64, creatTime int64) (*SessionMessage, error) {
 	currTime := time.Now().UnixMilli()
 	sessionMessage := &SessionMessage{
 		MsgId:      msgId,
 		ClientId:   clientId,
 		SessionId:  sessionId,
+		Seq:        seq,
 		FromUserId: fromUserId,
 		AtUsers:    atUserIds,
 		MsgType:    msgType,
@@ -109,6 +193,32 @@ func (d defaultSessionMessageModel) InsertMessage(clientId int64, fromUserId int
 	return sessionMessage, nil
 }
 
+// InsertMessageWithOutbox 消息和待投递记录在同一事务中写入, 待投递记录表名由MessageOutboxModel按其分表数生成
+func (d defaultSessionMessageModel) InsertMessageWithOutbox(sessionMessage *SessionMessage, outbox *MessageOutbox, outboxTableName string) (err error) {
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+	if err = tx.Table(d.genSessionMessageTableName(sessionMessage.SessionId)).Create(sessionMessage).Error; err != nil {
+		return err
+	}
+	err = tx.Table(outboxTableName).Create(outbox).Error
+	return
+}
+
+// InsertMessages 批量写入会话消息, 已存在的消息忽略
+func (d defaultSessionMessageModel) InsertMessages(sessionId int64, messages []*SessionMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return d.db.Table(d.genSessionMessageTableName(sessionId)).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(messages, 100).Error
+}
+
 func (d defaultSessionMessageModel) FindSessionMessage(sessionId, msgId, fUid int64) (*SessionMessage, error) {
 	result := &SessionMessage{}
 	strSql := "select * from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? and msg_id = ? and from_user_id = ?"
@@ -116,6 +226,22 @@ func (d defaultSessionMessageModel) FindSessionMessage(sessionId, msgId, fUid in
 	return result, err
 }
 
+func (d defaultSessionMessageModel) FindSessionMessageByMsgId(sessionId, msgId int64) (*SessionMessage, error) {
+	result := &SessionMessage{}
+	strSql := "select * from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? and msg_id = ?"
+	err := d.db.Raw(strSql, sessionId, msgId).Scan(result).Error
+	return result, err
+}
+
+// FindLatestSessionMessage 查询会话中最新的一条未删除的非状态操作消息
+func (d defaultSessionMessageModel) FindLatestSessionMessage(sessionId int64) (*SessionMessage, error) {
+	result := &SessionMessage{}
+	strSql := "select * from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? and msg_type >= 0 and deleted = 0 " +
+		"order by create_time desc limit 1"
+	err := d.db.Raw(strSql, sessionId).Scan(result).Error
+	return result, err
+}
+
 func (d defaultSessionMessageModel) FindMessageByClientId(sessionId, clientId, fromUId int64) (*SessionMessage, error) {
 	result := &SessionMessage{}
 	strSql := "select * from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? and client_id = ? and from_user_id = ?"
@@ -145,6 +271,149 @@ func (d defaultSessionMessageModel) GetSessionMessages(sessionId, ctime int64, o
 	}
 }
 
+func (d defaultSessionMessageModel) GetSessionMessagesBySeq(sessionId, fromSeq, toSeq int64, count int) ([]*SessionMessage, error) {
+	result := make([]*SessionMessage, 0)
+	strSql := "select * from " + d.genSessionMessageTableName(sessionId) +
+		" where session_id = ? and seq > ? and seq <= ? order by seq limit ?"
+	err := d.db.Raw(strSql, sessionId, fromSeq, toSeq, count).Scan(&result).Error
+	return result, err
+}
+
+// GetSessionThreadReplies 查询根消息下的回复, 不包含状态操作消息和撤回消息
+func (d defaultSessionMessageModel) GetSessionThreadReplies(sessionId, rootMsgId, ctime int64, count int) ([]*SessionMessage, error) {
+	result := make([]*SessionMessage, 0)
+	strSql := "select * from " + d.genSessionMessageTableName(sessionId) +
+		" where session_id = ? and reply_msg_id = ? and msg_type >= 0 and msg_type != ? and deleted = 0 and create_time > ? order by create_time limit ?"
+	err := d.db.Raw(strSql, sessionId, rootMsgId, MsgTypeRevoke, ctime, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultSessionMessageModel) FindExpiredSessionMessages(shard int64, now int64, count int) ([]*SessionMessage, error) {
+	result := make([]*SessionMessage, 0)
+	strSql := fmt.Sprintf("select * from session_message_%d where deleted = 0 and expire_time > 0 and expire_time <= ? limit ?", shard)
+	err := d.db.Raw(strSql, now, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultSessionMessageModel) ExpireSessionMessage(sessionId, msgId int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where session_id = ? and msg_id = ? and deleted = 0", d.genSessionMessageTableName(sessionId))
+	tx := d.db.Exec(sqlStr, time.Now().UnixMilli(), sessionId, msgId)
+	return tx.RowsAffected, tx.Error
+}
+
+// CountUnreadMessages 按分表批量统计超级群中用户已读时间之后他人发送的消息数, readTimes为会话id到已读的服务端时间的映射
+func (d defaultSessionMessageModel) CountUnreadMessages(userId int64, readTimes map[int64]int64) (map[int64]int, error) {
+	result := make(map[int64]int)
+	for shard, sessionIds := range d.groupSessionIdsByShard(readTimes) {
+		rows := make([]*struct {
+			SessionId int64 `gorm:"session_id"`
+			Count     int   `gorm:"count"`
+		}, 0)
+		condition, args := d.genReadCursorCondition(sessionIds, readTimes)
+		sqlStr := fmt.Sprintf("select session_id, count(0) as count from session_message_%d where (%s) and from_user_id != ? "+
+			"and msg_type >= 0 and msg_type != ? and deleted = 0 group by session_id", shard, condition)
+		args = append(args, userId, MsgTypeRevoke)
+		if err := d.db.Raw(sqlStr, args...).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			result[row.SessionId] = row.Count
+		}
+	}
+	return result, nil
+}
+
+// FindUnreadAtUsers 按分表批量查询超级群中用户已读时间之后带@的消息的at_users, 返回会话id到at_users列表的映射
+func (d defaultSessionMessageModel) FindUnreadAtUsers(userId int64, readTimes map[int64]int64) (map[int64][]string, error) {
+	result := make(map[int64][]string)
+	for shard, sessionIds := range d.groupSessionIdsByShard(readTimes) {
+		rows := make([]*struct {
+			SessionId int64  `gorm:"session_id"`
+			AtUsers   string `gorm:"at_users"`
+		}, 0)
+		condition, args := d.genReadCursorCondition(sessionIds, readTimes)
+		sqlStr := fmt.Sprintf("select session_id, at_users from session_message_%d where (%s) and from_user_id != ? "+
+			"and msg_type >= 0 and deleted = 0 and at_users is not null and at_users != ''", shard, condition)
+		args = append(args, userId)
+		if err := d.db.Raw(sqlStr, args...).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			result[row.SessionId] = append(result[row.SessionId], row.AtUsers)
+		}
+	}
+	return result, nil
+}
+
+func (d defaultSessionMessageModel) groupSessionIdsByShard(readTimes map[int64]int64) map[int64][]int64 {
+	sharedSessionIds := make(map[int64][]int64)
+	for sessionId := range readTimes {
+		share := sessionId % d.shards
+		sharedSessionIds[share] = append(sharedSessionIds[share], sessionId)
+	}
+	return sharedSessionIds
+}
+
+// genReadCursorCondition 已读时间为服务端时间, 按消息id比较, 不受客户端时钟影响
+func (d defaultSessionMessageModel) genReadCursorCondition(sessionIds []int64, readTimes map[int64]int64) (string, []interface{}) {
+	conditions := make([]string, 0, len(sessionIds))
+	args := make([]interface{}, 0, 2*len(sessionIds))
+	for _, sessionId := range sessionIds {
+		conditions = append(conditions, "(session_id = ? and msg_id >= ?)")
+		args = append(args, sessionId, MinMsgIdAt(readTimes[sessionId]+1))
+	}
+	return strings.Join(conditions, " or "), args
+}
+
+// FindMessageSessionIds 按session_id顺序分页查询分表中有消息的会话
+func (d defaultSessionMessageModel) FindMessageSessionIds(shard, fromSessionId int64, count int) ([]int64, error) {
+	result := make([]int64, 0)
+	strSql := fmt.Sprintf("select distinct session_id from session_message_%d where session_id > ? order by session_id limit ?", shard)
+	err := d.db.Raw(strSql, fromSessionId, count).Scan(&result).Error
+	return result, err
+}
+
+// FindNthLatestMsgId 查询会话中倒数第n条消息的msg_id, 消息不足n条返回0
+func (d defaultSessionMessageModel) FindNthLatestMsgId(sessionId, n int64) (int64, error) {
+	result := make([]int64, 0)
+	strSql := "select msg_id from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? " +
+		"order by msg_id desc limit 1 offset ?"
+	err := d.db.Raw(strSql, sessionId, n-1).Scan(&result).Error
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0], nil
+}
+
+// FindMaxSeqBefore 查询会话中msg_id小于before的消息的最大序号
+func (d defaultSessionMessageModel) FindMaxSeqBefore(sessionId, before int64) (int64, error) {
+	result := make([]int64, 0)
+	strSql := "select coalesce(max(seq), 0) from " + d.genSessionMessageTableName(sessionId) + " where session_id = ? and msg_id < ?"
+	err := d.db.Raw(strSql, sessionId, before).Scan(&result).Error
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0], nil
+}
+
+// PurgeMessagesBefore 物理删除会话中msg_id小于before的消息, 每次最多删除count条
+func (d defaultSessionMessageModel) PurgeMessagesBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genSessionMessageTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+// PurgeDeletedMessages 物理删除分表中update_time早于before的已软删除消息, 每次最多删除count条
+func (d defaultSessionMessageModel) PurgeDeletedMessages(shard, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from session_message_%d where deleted = 1 and update_time < ? limit ?", shard)
+	tx := d.db.Exec(sqlStr, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultSessionMessageModel) Shards() int64 {
+	return d.shards
+}
+
 func (d defaultSessionMessageModel) genSessionMessageTableName(sessionId int64) string {
 	return fmt.Sprintf("session_message_%d", sessionId%(d.shards))
 }
@@ -22,6 +22,9 @@ type (
 	SessionObjectModel interface {
 		AddSessionObjects(sId int64, fromUIds, clientMsgIds []int64, newFromUId, newClientMsgId, newSId int64) ([]int64, error)
 		Insert(id, sId, fromUId, clientId int64) (int64, error)
+		FindObjectIds(sId, fromUId, clientId int64) ([]int64, error)
+		FindReferencedObjectIds(sId int64, objectIds []int64) ([]int64, error)
+		DeleteSessionObjects(sId, fromUId, clientId int64) error
 	}
 
 	defaultSessionObjectModel struct {
@@ -70,6 +73,28 @@ func (d defaultSessionObjectModel) Insert(id, sId, fromUId, clientId int64) (int
 	return id, d.db.Table(tableName).Clauses(clause.OnConflict{DoNothing: true}).Create(o).Error
 }
 
+// FindObjectIds 查询会话中某条消息引用的对象id
+func (d defaultSessionObjectModel) FindObjectIds(sId, fromUId, clientId int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	sql := fmt.Sprintf("select object_id from %s where s_id = ? and from_user_id = ? and client_id = ?", d.genSessionObjectTableName(sId))
+	err := d.db.Raw(sql, sId, fromUId, clientId).Scan(&ids).Error
+	return ids, err
+}
+
+// FindReferencedObjectIds 查询仍被会话中消息引用的对象id
+func (d defaultSessionObjectModel) FindReferencedObjectIds(sId int64, objectIds []int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	sql := fmt.Sprintf("select distinct object_id from %s where s_id = ? and object_id in ?", d.genSessionObjectTableName(sId))
+	err := d.db.Raw(sql, sId, objectIds).Scan(&ids).Error
+	return ids, err
+}
+
+// DeleteSessionObjects 删除会话中某条消息引用的对象记录
+func (d defaultSessionObjectModel) DeleteSessionObjects(sId, fromUId, clientId int64) error {
+	sql := fmt.Sprintf("delete from %s where s_id = ? and from_user_id = ? and client_id = ?", d.genSessionObjectTableName(sId))
+	return d.db.Exec(sql, sId, fromUId, clientId).Error
+}
+
 func (d defaultSessionObjectModel) genSessionObjectTableName(sId int64) string {
 	return fmt.Sprintf("session_object_%d", sId%(d.shards))
 }
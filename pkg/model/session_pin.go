@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	SessionPin struct {
+		Id         int64 `gorm:"id" json:"id"`
+		SessionId  int64 `gorm:"session_id" json:"session_id"`
+		MsgId      int64 `gorm:"msg_id" json:"msg_id"`
+		UserId     int64 `gorm:"user_id" json:"user_id"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+	}
+
+	SessionPinModel interface {
+		PinMessage(m *SessionPin) (int64, error)
+		UnpinMessage(sessionId, msgId int64) (int64, error)
+		FindSessionPins(sessionId int64) ([]*SessionPin, error)
+		DeletePinsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultSessionPinModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultSessionPinModel) PinMessage(m *SessionPin) (int64, error) {
+	tx := d.db.Table(d.genSessionPinTableName(m.SessionId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultSessionPinModel) UnpinMessage(sessionId, msgId int64) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id = ?", d.genSessionPinTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, msgId)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultSessionPinModel) FindSessionPins(sessionId int64) ([]*SessionPin, error) {
+	result := make([]*SessionPin, 0)
+	sqlStr := fmt.Sprintf("select * from %s where session_id = ? order by create_time desc", d.genSessionPinTableName(sessionId))
+	err := d.db.Raw(sqlStr, sessionId).Scan(&result).Error
+	return result, err
+}
+
+// DeletePinsBefore 删除会话中msg_id小于before的置顶, 每次最多删除count条
+func (d defaultSessionPinModel) DeletePinsBefore(sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where session_id = ? and msg_id < ? limit ?", d.genSessionPinTableName(sessionId))
+	tx := d.db.Exec(sqlStr, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultSessionPinModel) genSessionPinTableName(sessionId int64) string {
+	return fmt.Sprintf("session_pin_%d", sessionId%(d.shards))
+}
+
+func NewSessionPinModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) SessionPinModel {
+	return defaultSessionPinModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -21,18 +21,20 @@ var ErrMemberCnt = errors.New("member count error")
 
 type (
 	SessionUser struct {
-		Id         int64  `gorm:"id" json:"id"`
-		SessionId  int64  `gorm:"session_id" json:"session_id"`
-		UserId     int64  `gorm:"user_id" json:"user_id"`
-		Type       int    `gorm:"type" json:"type"`
-		Role       int    `gorm:"role" json:"role"`
-		Mute       int    `gorm:"mute" json:"mute"`
-		Status     int    `gorm:"status" json:"status"`
-		NoteName   string `gorm:"note_name" json:"note_name"`
-		NoteAvatar string `gorm:"note_name" json:"note_avatar"`
-		CreateTime int64  `gorm:"create_time" json:"create_time"`
-		UpdateTime int64  `gorm:"update_time" json:"update_time"`
-		Deleted    int8   `gorm:"deleted" json:"deleted"`
+		Id          int64  `gorm:"id" json:"id"`
+		SessionId   int64  `gorm:"session_id" json:"session_id"`
+		UserId      int64  `gorm:"user_id" json:"user_id"`
+		Type        int    `gorm:"type" json:"type"`
+		Role        int    `gorm:"role" json:"role"`
+		Mute        int    `gorm:"mute" json:"mute"`
+		Status      int    `gorm:"status" json:"status"`
+		NoteName    string `gorm:"note_name" json:"note_name"`
+		NoteAvatar  string `gorm:"note_name" json:"note_avatar"`
+		ReadSeq     int64  `gorm:"read_seq" json:"read_seq"`
+		ReadMsgTime int64  `gorm:"read_msg_time" json:"read_msg_time"`
+		CreateTime  int64  `gorm:"create_time" json:"create_time"`
+		UpdateTime  int64  `gorm:"update_time" json:"update_time"`
+		Deleted     int8   `gorm:"deleted" json:"deleted"`
 	}
 
 	SessionUserModel interface {
@@ -47,6 +49,7 @@ type (
 		DelUser(session *Session, userIds []int64) (err error)
 		UpdateType(sessionId int64, sessionType int) (err error)
 		UpdateUser(sessionId int64, userIds []int64, role, status *int, noteName, noteAvatar, mute *string) (err error)
+		UpdateReadCursor(sessionId, userId, readSeq, readMsgTime int64) error
 		DelSession(sessionId int64) error
 	}
 
@@ -110,7 +113,7 @@ func (d defaultSessionUserModel) FindUIdsInSessionWithoutStatus(sessionId int64,
 	if len(userIds) > 0 {
 		uIdsCondition = " and user_id in ? "
 	}
-	sqlStr := fmt.Sprintf("select user_id from %s where session_id = ? %s and status & ? = 0 and deleted = 0",
+	sqlStr := fmt.Sprintf("select user_id, status, create_time from %s where session_id = ? %s and status & ? = 0 and deleted = 0",
 		d.genSessionUserTableName(sessionId), uIdsCondition)
 	if len(userIds) > 0 {
 		tx := d.db.Raw(sqlStr, sessionId, userIds, status).Scan(&sessionUsers)
@@ -172,7 +175,7 @@ func (d defaultSessionUserModel) AddUser(session *Session, entityIds []int64, us
 	sql1 := "insert into " + d.genSessionUserTableName(session.Id) + " " +
 		"(session_id, user_id, role, note_name, note_avatar, type, create_time, update_time) " +
 		"values (?, ?, ?, ?, ?, ?, ?, ?) " +
-		"on duplicate key update role = ?, note_name = ?, note_avatar = ?, deleted = ?, update_time = ? "
+		"on duplicate key update create_time = if(deleted = 1, ?, create_time), role = ?, note_name = ?, note_avatar = ?, deleted = ?, update_time = ? "
 	userMute := 0
 	if session.Mute == 1 {
 		userMute = 1
@@ -180,7 +183,7 @@ func (d defaultSessionUserModel) AddUser(session *Session, entityIds []int64, us
 	userSessions = make([]*UserSession, 0)
 	for index, id := range userIds {
 		if err = tx.Exec(sql1, session.Id, id, role[index], noteNames[index], noteAvatars[index], session.Type, t, t,
-			role[index], noteNames[index], noteAvatars[index], 0, t,
+			t, role[index], noteNames[index], noteAvatars[index], 0, t,
 		).Error; err != nil {
 			return nil, err
 		}
@@ -190,12 +193,12 @@ func (d defaultSessionUserModel) AddUser(session *Session, entityIds []int64, us
 			"note_avatar, create_time, update_time) " +
 			"values (?, ?, ?, ?, ?, ?, ?, ?, " +
 			"?, ?, ?, ?, ?, ?, ?) " +
-			"on duplicate key update top = ?, role = ?, name = ?, remark = ?, function_flag = ?, mute = ?, " +
+			"on duplicate key update create_time = if(deleted = 1, ?, create_time), top = ?, role = ?, name = ?, remark = ?, function_flag = ?, mute = ?, " +
 			"deleted = ?, ext_data = ?, parent_id = ?, note_name = ?, note_avatar = ?, update_time = ? "
 		if err = tx.Exec(
 			sql2, session.Id, id, session.Type, entityIds[index], role[index], session.Name, session.Remark, session.FunctionFlag,
 			userMute, session.ExtData, 0, noteNames[index], noteAvatars[index], t, 0,
-			0, role[index], session.Name, session.Remark, session.FunctionFlag, userMute,
+			t, 0, role[index], session.Name, session.Remark, session.FunctionFlag, userMute,
 			0, session.ExtData, 0, noteNames[index], noteAvatars[index], t,
 		).Error; err != nil {
 			return nil, err
@@ -257,6 +260,13 @@ func (d defaultSessionUserModel) UpdateType(sessionId int64, sessionType int) (e
 	return d.db.Exec(sql, sessionType, t, sessionId).Error
 }
 
+// UpdateReadCursor 推进成员的已读游标, 游标只前进不后退, 不修改update_time避免成员列表增量同步被已读刷新
+func (d defaultSessionUserModel) UpdateReadCursor(sessionId, userId, readSeq, readMsgTime int64) error {
+	sqlStr := fmt.Sprintf("update %s set read_seq = greatest(read_seq, ?), read_msg_time = greatest(read_msg_time, ?) "+
+		"where session_id = ? and user_id = ?", d.genSessionUserTableName(sessionId))
+	return d.db.Exec(sqlStr, readSeq, readMsgTime, sessionId, userId).Error
+}
+
 func (d defaultSessionUserModel) UpdateUser(sessionId int64, userIds []int64, role, status *int, noteName, noteAvatar, mute *string) (err error) {
 	if role == nil && status == nil && mute == nil && noteName == nil && noteAvatar == nil {
 		return nil
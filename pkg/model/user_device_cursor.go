@@ -0,0 +1,61 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"time"
+)
+
+type (
+	// UserDeviceCursor 用户每个设备在每个会话内的消息同步游标, 同步时只下发游标之后的消息
+	UserDeviceCursor struct {
+		Id          int64  `gorm:"id" json:"id"`
+		UserId      int64  `gorm:"user_id" json:"user_id"`
+		Platform    string `gorm:"platform" json:"platform"`
+		Device      string `gorm:"device" json:"device"`
+		SessionId   int64  `gorm:"session_id" json:"session_id"`
+		CursorMsgId int64  `gorm:"cursor_msg_id" json:"cursor_msg_id"`
+		CreateTime  int64  `gorm:"create_time" json:"create_time"`
+		UpdateTime  int64  `gorm:"update_time" json:"update_time"`
+	}
+
+	UserDeviceCursorModel interface {
+		FindCursor(userId int64, platform, device string, sessionId int64) (*UserDeviceCursor, error)
+		AdvanceCursor(userId int64, platform, device string, sessionId, cursorMsgId int64) error
+		GenUserDeviceCursorTableName(userId int64) string
+	}
+
+	defaultUserDeviceCursorModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultUserDeviceCursorModel) FindCursor(userId int64, platform, device string, sessionId int64) (*UserDeviceCursor, error) {
+	cursor := &UserDeviceCursor{}
+	sqlStr := fmt.Sprintf("select * from %s where user_id = ? and platform = ? and device = ? and session_id = ?", d.GenUserDeviceCursorTableName(userId))
+	err := d.db.Raw(sqlStr, userId, platform, device, sessionId).Scan(cursor).Error
+	return cursor, err
+}
+
+// AdvanceCursor 游标只前进不后退, 多次ack乱序到达时保留最大的消息id
+func (d defaultUserDeviceCursorModel) AdvanceCursor(userId int64, platform, device string, sessionId, cursorMsgId int64) error {
+	now := time.Now().UnixMilli()
+	sqlStr := fmt.Sprintf("insert into %s (user_id, platform, device, session_id, cursor_msg_id, create_time, update_time) "+
+		"values (?, ?, ?, ?, ?, ?, ?) on duplicate key update "+
+		"cursor_msg_id = greatest(cursor_msg_id, values(cursor_msg_id)), update_time = values(update_time)",
+		d.GenUserDeviceCursorTableName(userId))
+	return d.db.Exec(sqlStr, userId, platform, device, sessionId, cursorMsgId, now, now).Error
+}
+
+func (d defaultUserDeviceCursorModel) GenUserDeviceCursorTableName(userId int64) string {
+	return fmt.Sprintf("user_device_cursor_%d", userId%(d.shards))
+}
+
+func NewUserDeviceCursorModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) UserDeviceCursorModel {
+	return defaultUserDeviceCursorModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
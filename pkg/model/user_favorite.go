@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// UserFavorite 用户收藏的消息快照, 与原消息和会话成员关系无关
+	UserFavorite struct {
+		Id         int64   `gorm:"id" json:"id"`
+		UserId     int64   `gorm:"user_id" json:"user_id"`
+		SessionId  int64   `gorm:"session_id" json:"session_id"`
+		MsgId      int64   `gorm:"msg_id" json:"msg_id"`
+		MsgType    int     `gorm:"msg_type" json:"msg_type"`
+		FromUserId int64   `gorm:"from_user_id" json:"from_user_id"`
+		MsgContent string  `gorm:"msg_content" json:"msg_content"`
+		ExtData    *string `gorm:"ext_data" json:"ext_data"`
+		MsgTime    int64   `gorm:"msg_time" json:"msg_time"`
+		CreateTime int64   `gorm:"create_time" json:"create_time"`
+	}
+
+	UserFavoriteModel interface {
+		NewFavoriteId() int64
+		AddFavorite(m *UserFavorite) (int64, error)
+		DelFavorite(userId, id int64) (int64, error)
+		FindFavorite(userId, sessionId, msgId int64) (*UserFavorite, error)
+		FindFavorites(userId int64, sessionId *int64, msgType *int, ctime int64, count int) ([]*UserFavorite, error)
+	}
+
+	defaultUserFavoriteModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultUserFavoriteModel) NewFavoriteId() int64 {
+	return d.snowflakeNode.Generate().Int64()
+}
+
+func (d defaultUserFavoriteModel) AddFavorite(m *UserFavorite) (int64, error) {
+	tx := d.db.Table(d.genUserFavoriteTableName(m.UserId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultUserFavoriteModel) DelFavorite(userId, id int64) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where user_id = ? and id = ?", d.genUserFavoriteTableName(userId))
+	tx := d.db.Exec(sqlStr, userId, id)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultUserFavoriteModel) FindFavorite(userId, sessionId, msgId int64) (*UserFavorite, error) {
+	result := &UserFavorite{}
+	sqlStr := fmt.Sprintf("select * from %s where user_id = ? and session_id = ? and msg_id = ?", d.genUserFavoriteTableName(userId))
+	err := d.db.Raw(sqlStr, userId, sessionId, msgId).Scan(result).Error
+	return result, err
+}
+
+func (d defaultUserFavoriteModel) FindFavorites(userId int64, sessionId *int64, msgType *int, ctime int64, count int) ([]*UserFavorite, error) {
+	result := make([]*UserFavorite, 0)
+	sqlBuffer := bytes.NewBufferString("select * from " + d.genUserFavoriteTableName(userId) + " where user_id = ? and create_time < ? ")
+	params := []interface{}{userId, ctime}
+	if sessionId != nil {
+		sqlBuffer.WriteString("and session_id = ? ")
+		params = append(params, *sessionId)
+	}
+	if msgType != nil {
+		sqlBuffer.WriteString("and msg_type = ? ")
+		params = append(params, *msgType)
+	}
+	sqlBuffer.WriteString("order by create_time desc limit 0, ?")
+	params = append(params, count)
+	err := d.db.Raw(sqlBuffer.String(), params...).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultUserFavoriteModel) genUserFavoriteTableName(userId int64) string {
+	return fmt.Sprintf("user_favorite_%d", userId%(d.shards))
+}
+
+func NewUserFavoriteModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) UserFavoriteModel {
+	return defaultUserFavoriteModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
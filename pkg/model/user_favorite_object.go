@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type (
+	// UserFavoriteObject 收藏消息引用的对象, 用户退出会话后仍可通过收藏下载
+	UserFavoriteObject struct {
+		Id         int64 `gorm:"id" json:"id"`
+		UserId     int64 `gorm:"user_id" json:"user_id"`
+		FavoriteId int64 `gorm:"favorite_id" json:"favorite_id"`
+		ObjectId   int64 `gorm:"object_id" json:"object_id"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+	}
+
+	UserFavoriteObjectModel interface {
+		AddObjects(userId, favoriteId int64, objectIds []int64) error
+		DelObjects(userId, favoriteId int64) error
+		HasObject(userId, objectId int64) (bool, error)
+	}
+
+	defaultUserFavoriteObjectModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+func (d defaultUserFavoriteObjectModel) AddObjects(userId, favoriteId int64, objectIds []int64) error {
+	if len(objectIds) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	objects := make([]*UserFavoriteObject, 0, len(objectIds))
+	for _, objectId := range objectIds {
+		objects = append(objects, &UserFavoriteObject{
+			UserId:     userId,
+			FavoriteId: favoriteId,
+			ObjectId:   objectId,
+			CreateTime: now,
+		})
+	}
+	return d.db.Table(d.genUserFavoriteObjectTableName(userId)).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(objects, len(objects)).Error
+}
+
+func (d defaultUserFavoriteObjectModel) DelObjects(userId, favoriteId int64) error {
+	sqlStr := fmt.Sprintf("delete from %s where user_id = ? and favorite_id = ?", d.genUserFavoriteObjectTableName(userId))
+	return d.db.Exec(sqlStr, userId, favoriteId).Error
+}
+
+func (d defaultUserFavoriteObjectModel) HasObject(userId, objectId int64) (bool, error) {
+	count := int64(0)
+	sqlStr := fmt.Sprintf("select count(0) from %s where user_id = ? and object_id = ?", d.genUserFavoriteObjectTableName(userId))
+	err := d.db.Raw(sqlStr, userId, objectId).Scan(&count).Error
+	return count > 0, err
+}
+
+func (d defaultUserFavoriteObjectModel) genUserFavoriteObjectTableName(userId int64) string {
+	return fmt.Sprintf("user_favorite_object_%d", userId%(d.shards))
+}
+
+func NewUserFavoriteObjectModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) UserFavoriteObjectModel {
+	return defaultUserFavoriteObjectModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	UserMention struct {
+		Id         int64 `gorm:"id" json:"id"`
+		UserId     int64 `gorm:"user_id" json:"user_id"`
+		SessionId  int64 `gorm:"session_id" json:"session_id"`
+		MsgId      int64 `gorm:"msg_id" json:"msg_id"`
+		FromUserId int64 `gorm:"from_user_id" json:"from_user_id"`
+		AtAll      int8  `gorm:"at_all" json:"at_all"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+	}
+
+	UserMentionModel interface {
+		AddMentions(mentions []*UserMention) error
+		FindUserMentions(userId int64, sessionId *int64, ctime int64, count int) ([]*UserMention, error)
+		DeleteUserMentionsBefore(userId, sessionId, before int64) error
+		DeleteSessionMentionsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultUserMentionModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+// AddMentions 按分表批量写入被@记录
+func (d defaultUserMentionModel) AddMentions(mentions []*UserMention) error {
+	shardMentions := make(map[string][]*UserMention)
+	for _, mention := range mentions {
+		tableName := d.genUserMentionTableName(mention.UserId)
+		shardMentions[tableName] = append(shardMentions[tableName], mention)
+	}
+	for tableName, ms := range shardMentions {
+		if err := d.db.Table(tableName).Clauses(clause.OnConflict{DoNothing: true}).Create(ms).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindUserMentions 按时间倒序查询用户被@的记录, ctime为0时从最新开始
+func (d defaultUserMentionModel) FindUserMentions(userId int64, sessionId *int64, ctime int64, count int) ([]*UserMention, error) {
+	result := make([]*UserMention, 0)
+	sqlStr := "select * from " + d.genUserMentionTableName(userId) + " where user_id = ? "
+	params := []interface{}{userId}
+	if sessionId != nil {
+		sqlStr += "and session_id = ? "
+		params = append(params, *sessionId)
+	}
+	if ctime > 0 {
+		sqlStr += "and create_time < ? "
+		params = append(params, ctime)
+	}
+	sqlStr += "order by create_time desc limit ?"
+	params = append(params, count)
+	err := d.db.Raw(sqlStr, params...).Scan(&result).Error
+	return result, err
+}
+
+// DeleteUserMentionsBefore 删除用户在会话中msg_id小于before的@记录
+func (d defaultUserMentionModel) DeleteUserMentionsBefore(userId, sessionId, before int64) error {
+	sqlStr := fmt.Sprintf("delete from %s where user_id = ? and session_id = ? and msg_id < ?", d.genUserMentionTableName(userId))
+	return d.db.Exec(sqlStr, userId, sessionId, before).Error
+}
+
+// DeleteSessionMentionsBefore 删除所有分表中会话msg_id小于before的@记录, 每个分表每次最多删除count条
+func (d defaultUserMentionModel) DeleteSessionMentionsBefore(sessionId, before int64, count int) (int64, error) {
+	total := int64(0)
+	for i := int64(0); i < d.shards; i++ {
+		sqlStr := fmt.Sprintf("delete from user_mention_%d where session_id = ? and msg_id < ? limit ?", i)
+		tx := d.db.Exec(sqlStr, sessionId, before, count)
+		if tx.Error != nil {
+			return total, tx.Error
+		}
+		total += tx.RowsAffected
+	}
+	return total, nil
+}
+
+func (d defaultUserMentionModel) genUserMentionTableName(userId int64) string {
+	return fmt.Sprintf("user_mention_%d", userId%(d.shards))
+}
+
+func NewUserMentionModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) UserMentionModel {
+	return defaultUserMentionModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
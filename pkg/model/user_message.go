@@ -6,6 +6,7 @@ import (
 	"github.com/thk-im/thk-im-base-server/snowflake"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
 const (
@@ -19,33 +20,57 @@ const (
 
 type (
 	UserMessage struct {
-		Id         int64   `gorm:"id" json:"id"`
-		MsgId      int64   `gorm:"msg_id" json:"msg_id"`
-		ClientId   int64   `gorm:"client_id" json:"client_id"`
-		UserId     int64   `gorm:"user_id" json:"user_id"`
-		SessionId  int64   `gorm:"session_id" json:"session_id"`
-		FromUserId int64   `gorm:"from_user_id" json:"from_user_id"`
-		MsgType    int     `gorm:"msg_type" json:"msg_type"`
-		MsgContent string  `gorm:"msg_content" json:"msg_content"`
-		ReplyMsgId *int64  `gorm:"reply_msg_id" json:"reply_msg_id"`
-		AtUsers    *string `gorm:"at_users" json:"at_users"`
-		ExtData    *string `gorm:"ext_data" json:"ext_data"`
-		Status     int     `gorm:"status" json:"status"`
-		CreateTime int64   `gorm:"create_time" json:"create_time"`
-		UpdateTime int64   `gorm:"update_time" json:"update_time"`
-		Deleted    int8    `gorm:"deleted" json:"deleted"`
+		Id            int64   `gorm:"id" json:"id"`
+		MsgId         int64   `gorm:"msg_id" json:"msg_id"`
+		ClientId      int64   `gorm:"client_id" json:"client_id"`
+		UserId        int64   `gorm:"user_id" json:"user_id"`
+		SessionId     int64   `gorm:"session_id" json:"session_id"`
+		Seq           int64   `gorm:"seq" json:"seq"`
+		FromUserId    int64   `gorm:"from_user_id" json:"from_user_id"`
+		MsgType       int     `gorm:"msg_type" json:"msg_type"`
+		MsgContent    string  `gorm:"msg_content" json:"msg_content"`
+		ReplyMsgId    *int64  `gorm:"reply_msg_id" json:"reply_msg_id"`
+		AtUsers       *string `gorm:"at_users" json:"at_users"`
+		ExtData       *string `gorm:"ext_data" json:"ext_data"`
+		Status        int     `gorm:"status" json:"status"`
+		TtlMs         int64   `gorm:"ttl_ms" json:"ttl_ms"`
+		BurnAfterRead int8    `gorm:"burn_after_read" json:"burn_after_read"`
+		ExpireTime    int64   `gorm:"expire_time" json:"expire_time"`
+		CreateTime    int64   `gorm:"create_time" json:"create_time"`
+		UpdateTime    int64   `gorm:"update_time" json:"update_time"`
+		Deleted       int8    `gorm:"deleted" json:"deleted"`
 	}
 
 	UserMessageModel interface {
 		FindUserMessages(userId, sessionId int64, messageIds []int64) ([]*UserMessage, error)
 		FindUserMessageByClientId(userId, sessionId, clientId int64) (*UserMessage, error)
+		FindLatestUserMessage(userId, sessionId int64) (*UserMessage, error)
 		FindUserMessage(userId, sessionId, messageId int64) (*UserMessage, error)
 		InsertUserMessage(m *UserMessage) error
+		InsertUserMessageWithOutbox(m *UserMessage, outbox *MessageOutbox, outboxTableName string) error
 		AckUserMessages(userId int64, sessionId int64, messageIds []int64) error
-		GetUserMessages(userId int64, ctime int64, offset, count int) ([]*UserMessage, error)
+		GetUserMessages(userId int64, ctime, msgId int64, offset, count int) ([]*UserMessage, error)
+		GetDeviceUserMessages(userId int64, cursorTableName, platform, device string, ctime, msgId int64, offset, count int) ([]*UserMessage, error)
+		FindUserMessageIdsAfter(userId, sessionId, fromMsgId, toMsgId int64, count int) ([]int64, error)
+		GetUserMessagesBySeq(userId, sessionId, fromSeq, toSeq int64, count int) ([]*UserMessage, error)
+		GetUserThreadReplies(userId, sessionId, rootMsgId, ctime int64, count int) ([]*UserMessage, error)
+		GetLatestSessionMessages(sessionId int64, count int) ([]*UserMessage, error)
+		FindLatestReadUserMessage(userId, sessionId int64) (*UserMessage, error)
 		DeleteMessages(userId int64, sessionId int64, messageIds []int64, from, to *int64) error
 		DeleteMessagesBySessionId(userId int64, sessionId int64) error
 		UpdateUserMessage(userId int64, sessionId int64, msgIds []int64, status int, content *string) error
+		UpdateUserMessagesContent(userIds []int64, sessionId, msgId int64, content string) error
+		StartBurnAfterReadCountdown(userId, sessionId int64, msgIds []int64, now int64) error
+		StartReaderBurnCountdown(userId, sessionId, msgId, ttlMs, now int64) error
+		FindExpiredUserMessages(shard int64, now int64, count int) ([]*UserMessage, error)
+		ExpireUserMessage(userId, sessionId, msgId int64) (int64, error)
+		FindMessageOwners(shard, fromUserId, fromSessionId int64, count int) ([]*UserMessage, error)
+		FindNthLatestMsgId(userId, sessionId, n int64) (int64, error)
+		FindMaxSeqBefore(userId, sessionId, before int64) (int64, error)
+		FindSessionMinMsgId(sessionId int64) (int64, error)
+		PurgeMessagesBefore(userId, sessionId, before int64, count int) (int64, error)
+		PurgeDeletedMessages(shard, before int64, count int) (int64, error)
+		Shards() int64
 	}
 
 	defaultUserMessageModel struct {
@@ -63,6 +88,44 @@ func (d defaultUserMessageModel) FindUserMessages(userId, sessionId int64, messa
 	return results, err
 }
 
+// FindLatestUserMessage 查询用户在会话中最新的一条未删除的非状态操作消息
+func (d defaultUserMessageModel) FindLatestUserMessage(userId, sessionId int64) (*UserMessage, error) {
+	result := &UserMessage{}
+	strSql := "select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and session_id = ? and msg_type >= 0 and deleted = 0 " +
+		"order by create_time desc limit 1"
+	err := d.db.Raw(strSql, userId, sessionId).Scan(result).Error
+	return result, err
+}
+
+// GetLatestSessionMessages 查询每个分表中会话最近count条消息, 不包含状态操作消息. 同一条消息在分表中只返回一条,
+// 序号和阅后即焚取所有成员记录中的最大值, 避免只有部分记录写入了这些字段
+func (d defaultUserMessageModel) GetLatestSessionMessages(sessionId int64, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	for i := int64(0); i < d.shards; i++ {
+		tableName := fmt.Sprintf("user_message_%d", i)
+		strSql := fmt.Sprintf("select m.id, m.msg_id, m.client_id, m.user_id, m.session_id, t.seq, m.from_user_id, m.msg_type, m.msg_content, "+
+			"m.at_users, m.reply_msg_id, m.ext_data, m.status, m.ttl_ms, t.burn_after_read, m.expire_time, m.create_time, m.update_time, m.deleted "+
+			"from %s m join (select min(id) as id, max(seq) as seq, max(burn_after_read) as burn_after_read from %s "+
+			"where session_id = ? and msg_type >= 0 and deleted = 0 group by msg_id order by max(create_time) desc limit ?) t on m.id = t.id",
+			tableName, tableName)
+		shardMessages := make([]*UserMessage, 0)
+		if err := d.db.Raw(strSql, sessionId, count).Scan(&shardMessages).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, shardMessages...)
+	}
+	return result, nil
+}
+
+// FindLatestReadUserMessage 查询用户在会话中最新一条已读或自己发送的消息
+func (d defaultUserMessageModel) FindLatestReadUserMessage(userId, sessionId int64) (*UserMessage, error) {
+	result := &UserMessage{}
+	strSql := "select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and session_id = ? and msg_type >= 0 " +
+		"and (from_user_id = ? or status & ? > 0) order by create_time desc limit 1"
+	err := d.db.Raw(strSql, userId, sessionId, userId, MsgStatusServerRead).Scan(result).Error
+	return result, err
+}
+
 func (d defaultUserMessageModel) FindUserMessageByClientId(userId, sessionId, clientId int64) (*UserMessage, error) {
 	result := &UserMessage{}
 	strSql := "select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and session_id = ? and from_user_id = ? and client_id = ?"
@@ -81,6 +144,23 @@ func (d defaultUserMessageModel) InsertUserMessage(m *UserMessage) error {
 	return d.db.Table(d.genUserMessageTableName(m.UserId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m).Error
 }
 
+// InsertUserMessageWithOutbox 消息和待投递记录在同一事务中写入, 待投递记录表名由MessageOutboxModel按其分表数生成
+func (d defaultUserMessageModel) InsertUserMessageWithOutbox(m *UserMessage, outbox *MessageOutbox, outboxTableName string) (err error) {
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+	if err = tx.Table(d.genUserMessageTableName(m.UserId)).Clauses(clause.OnConflict{DoNothing: true}).Create(m).Error; err != nil {
+		return err
+	}
+	err = tx.Table(outboxTableName).Create(outbox).Error
+	return
+}
+
 func (d defaultUserMessageModel) AckUserMessages(userId int64, sessionId int64, messageIds []int64) error {
 	sqlStr := fmt.Sprintf("update %s set status = (status | 1) where user_id = ?  and session_id = ? and msg_id in ? ",
 		d.genUserMessageTableName(userId))
@@ -88,30 +168,81 @@ func (d defaultUserMessageModel) AckUserMessages(userId int64, sessionId int64,
 	return err
 }
 
-func (d defaultUserMessageModel) GetUserMessages(userId int64, ctime int64, offset, count int) ([]*UserMessage, error) {
+func (d defaultUserMessageModel) GetUserMessages(userId int64, ctime, msgId int64, offset, count int) ([]*UserMessage, error) {
 	result := make([]*UserMessage, 0)
-	strSql := "(select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and create_time > ? and deleted = 0) " +
-		" union (select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and status = 0 and deleted = 0) " +
-		" order by create_time limit ? offset ?"
-
-	tx := d.db.Raw(strSql, userId, ctime, userId, count, offset).Scan(&result)
+	pageCondition, params := userMessagePageCondition("", ctime, msgId)
+	strSql := "select * from " + d.genUserMessageTableName(userId) + " where user_id = ? and " + pageCondition + " and deleted = 0 " +
+		" order by create_time, msg_id limit ? offset ?"
+	params = append([]interface{}{userId}, params...)
+	params = append(params, count, offset)
+	tx := d.db.Raw(strSql, params...).Scan(&result)
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 	return result, nil
 }
 
+// GetDeviceUserMessages 按设备在每个会话内的游标同步消息, 有游标的会话只下发游标之后的消息, 客户端从上次同步的位置重新同步时未ack的消息会重复下发;
+// 所有会话都按(create_time, msg_id)翻页, 保证未ack的消息超过一页时也能向后翻页
+func (d defaultUserMessageModel) GetDeviceUserMessages(userId int64, cursorTableName, platform, device string, ctime, msgId int64, offset, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	pageCondition, params := userMessagePageCondition("m.", ctime, msgId)
+	strSql := "select m.* from " + d.genUserMessageTableName(userId) + " m left join " + cursorTableName + " c " +
+		"on c.user_id = m.user_id and c.platform = ? and c.device = ? and c.session_id = m.session_id " +
+		"where m.user_id = ? and m.deleted = 0 and " + pageCondition + " and (c.id is null or m.msg_id > c.cursor_msg_id) " +
+		"order by m.create_time, m.msg_id limit ? offset ?"
+	params = append([]interface{}{platform, device, userId}, params...)
+	params = append(params, count, offset)
+	err := d.db.Raw(strSql, params...).Scan(&result).Error
+	return result, err
+}
+
+// userMessagePageCondition 返回(create_time, msg_id)大于上一页最后一条消息的条件, msgId为0时兼容只按create_time翻页
+func userMessagePageCondition(prefix string, ctime, msgId int64) (string, []interface{}) {
+	if msgId <= 0 {
+		return prefix + "create_time > ?", []interface{}{ctime}
+	}
+	return fmt.Sprintf("(%screate_time > ? or (%screate_time = ? and %smsg_id > ?))", prefix, prefix, prefix),
+		[]interface{}{ctime, ctime, msgId}
+}
+
+// FindUserMessageIdsAfter 按消息id升序查询会话中(fromMsgId, toMsgId]范围内未删除的消息id
+func (d defaultUserMessageModel) FindUserMessageIdsAfter(userId, sessionId, fromMsgId, toMsgId int64, count int) ([]int64, error) {
+	msgIds := make([]int64, 0)
+	strSql := "select msg_id from " + d.genUserMessageTableName(userId) +
+		" where user_id = ? and session_id = ? and msg_id > ? and msg_id <= ? and deleted = 0 order by msg_id limit ?"
+	err := d.db.Raw(strSql, userId, sessionId, fromMsgId, toMsgId, count).Scan(&msgIds).Error
+	return msgIds, err
+}
+
+func (d defaultUserMessageModel) GetUserMessagesBySeq(userId, sessionId, fromSeq, toSeq int64, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	strSql := "select * from " + d.genUserMessageTableName(userId) +
+		" where user_id = ? and session_id = ? and seq > ? and seq <= ? order by seq limit ?"
+	err := d.db.Raw(strSql, userId, sessionId, fromSeq, toSeq, count).Scan(&result).Error
+	return result, err
+}
+
+// GetUserThreadReplies 查询用户收到的根消息下的回复, 不包含状态操作消息和撤回消息
+func (d defaultUserMessageModel) GetUserThreadReplies(userId, sessionId, rootMsgId, ctime int64, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	strSql := "select * from " + d.genUserMessageTableName(userId) +
+		" where user_id = ? and session_id = ? and reply_msg_id = ? and msg_type >= 0 and msg_type != ? and deleted = 0 and create_time > ? order by create_time limit ?"
+	err := d.db.Raw(strSql, userId, sessionId, rootMsgId, MsgTypeRevoke, ctime, count).Scan(&result).Error
+	return result, err
+}
+
 func (d defaultUserMessageModel) DeleteMessages(userId int64, sessionId int64, messageIds []int64, from, to *int64) error {
 	if len(messageIds) > 0 {
-		sqlStr := fmt.Sprintf("update %s set deleted = 1 where user_id = ? and session_id = ? and msg_id in ?",
+		sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where user_id = ? and session_id = ? and msg_id in ?",
 			d.genUserMessageTableName(userId))
-		err := d.db.Exec(sqlStr, userId, sessionId, messageIds).Error
+		err := d.db.Exec(sqlStr, time.Now().UnixMilli(), userId, sessionId, messageIds).Error
 		return err
 	} else if from != nil && to != nil {
 		sqlStr := fmt.Sprintf(
-			"update %s set deleted = 1 where user_id = ? and session_id = ? and create_time >= ? and create_time <= ?",
+			"update %s set deleted = 1, update_time = ? where user_id = ? and session_id = ? and create_time >= ? and create_time <= ?",
 			d.genUserMessageTableName(userId))
-		err := d.db.Exec(sqlStr, userId, sessionId, from, to).Error
+		err := d.db.Exec(sqlStr, time.Now().UnixMilli(), userId, sessionId, from, to).Error
 		return err
 	} else {
 		return nil
@@ -120,24 +251,138 @@ func (d defaultUserMessageModel) DeleteMessages(userId int64, sessionId int64, m
 
 func (d defaultUserMessageModel) DeleteMessagesBySessionId(userId int64, sessionId int64) error {
 	sqlStr := fmt.Sprintf(
-		"update %s set deleted = 1 where user_id = ? and session_id = ? ",
+		"update %s set deleted = 1, update_time = ? where user_id = ? and session_id = ? ",
 		d.genUserMessageTableName(userId))
-	err := d.db.Exec(sqlStr, userId, sessionId).Error
+	err := d.db.Exec(sqlStr, time.Now().UnixMilli(), userId, sessionId).Error
 	return err
 }
 
 func (d defaultUserMessageModel) UpdateUserMessage(userId int64, sessionId int64, msgIds []int64, status int, content *string) error {
-	updateContent := ""
 	if content != nil {
-		updateContent = fmt.Sprintf(", msg_content = '%s' ", *content)
+		sqlStr := fmt.Sprintf(
+			"update %s set status = status | ?, msg_content = ? where user_id = ? and session_id = ? and msg_id in ? ",
+			d.genUserMessageTableName(userId))
+		return d.db.Exec(sqlStr, status, *content, userId, sessionId, msgIds).Error
 	}
 	sqlStr := fmt.Sprintf(
-		"update %s set status = status | ? %s where user_id = ? and session_id = ? and msg_id in ? ",
-		d.genUserMessageTableName(userId), updateContent)
+		"update %s set status = status | ? where user_id = ? and session_id = ? and msg_id in ? ",
+		d.genUserMessageTableName(userId))
 	err := d.db.Exec(sqlStr, status, userId, sessionId, msgIds).Error
 	return err
 }
 
+// UpdateUserMessagesContent 更新所有用户的消息副本内容, 按分表批量更新
+func (d defaultUserMessageModel) UpdateUserMessagesContent(userIds []int64, sessionId, msgId int64, content string) error {
+	shardUserIds := make(map[string][]int64)
+	for _, userId := range userIds {
+		tableName := d.genUserMessageTableName(userId)
+		shardUserIds[tableName] = append(shardUserIds[tableName], userId)
+	}
+	now := time.Now().UnixMilli()
+	for tableName, uIds := range shardUserIds {
+		sqlStr := fmt.Sprintf("update %s set status = status | ?, msg_content = ?, update_time = ? "+
+			"where user_id in ? and session_id = ? and msg_id = ? and deleted = 0", tableName)
+		if err := d.db.Exec(sqlStr, MsgStatusReedit, content, now, uIds, sessionId, msgId).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartBurnAfterReadCountdown 阅后即焚消息开始倒计时, 已开始倒计时的不重复设置
+func (d defaultUserMessageModel) StartBurnAfterReadCountdown(userId, sessionId int64, msgIds []int64, now int64) error {
+	sqlStr := fmt.Sprintf("update %s set expire_time = ? + ttl_ms where user_id = ? and session_id = ? and msg_id in ? "+
+		"and burn_after_read = 1 and expire_time = 0 and deleted = 0", d.genUserMessageTableName(userId))
+	return d.db.Exec(sqlStr, now, userId, sessionId, msgIds).Error
+}
+
+// StartReaderBurnCountdown 按发件人副本的阅后即焚设置开始读者副本的倒计时, 不依赖读者副本上的阅后即焚字段
+func (d defaultUserMessageModel) StartReaderBurnCountdown(userId, sessionId, msgId, ttlMs, now int64) error {
+	sqlStr := fmt.Sprintf("update %s set burn_after_read = 1, ttl_ms = ?, expire_time = ? where user_id = ? and session_id = ? and msg_id = ? "+
+		"and expire_time = 0 and deleted = 0", d.genUserMessageTableName(userId))
+	return d.db.Exec(sqlStr, ttlMs, now+ttlMs, userId, sessionId, msgId).Error
+}
+
+func (d defaultUserMessageModel) FindExpiredUserMessages(shard int64, now int64, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	strSql := fmt.Sprintf("select * from user_message_%d where deleted = 0 and expire_time > 0 and expire_time <= ? limit ?", shard)
+	err := d.db.Raw(strSql, now, count).Scan(&result).Error
+	return result, err
+}
+
+func (d defaultUserMessageModel) ExpireUserMessage(userId, sessionId, msgId int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set deleted = 1, update_time = ? where user_id = ? and session_id = ? and msg_id = ? and deleted = 0",
+		d.genUserMessageTableName(userId))
+	tx := d.db.Exec(sqlStr, time.Now().UnixMilli(), userId, sessionId, msgId)
+	return tx.RowsAffected, tx.Error
+}
+
+// FindMessageOwners 按(user_id, session_id)顺序分页查询分表中有消息的用户会话, 结果只包含user_id和session_id
+func (d defaultUserMessageModel) FindMessageOwners(shard, fromUserId, fromSessionId int64, count int) ([]*UserMessage, error) {
+	result := make([]*UserMessage, 0)
+	strSql := fmt.Sprintf("select user_id, session_id from user_message_%d where user_id > ? or (user_id = ? and session_id > ?) "+
+		"group by user_id, session_id order by user_id, session_id limit ?", shard)
+	err := d.db.Raw(strSql, fromUserId, fromUserId, fromSessionId, count).Scan(&result).Error
+	return result, err
+}
+
+// FindNthLatestMsgId 查询用户在会话中倒数第n条消息的msg_id, 消息不足n条返回0
+func (d defaultUserMessageModel) FindNthLatestMsgId(userId, sessionId, n int64) (int64, error) {
+	result := make([]int64, 0)
+	strSql := "select msg_id from " + d.genUserMessageTableName(userId) + " where user_id = ? and session_id = ? " +
+		"order by msg_id desc limit 1 offset ?"
+	err := d.db.Raw(strSql, userId, sessionId, n-1).Scan(&result).Error
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0], nil
+}
+
+// FindMaxSeqBefore 查询用户在会话中msg_id小于before的消息的最大序号
+func (d defaultUserMessageModel) FindMaxSeqBefore(userId, sessionId, before int64) (int64, error) {
+	result := make([]int64, 0)
+	strSql := "select coalesce(max(seq), 0) from " + d.genUserMessageTableName(userId) + " where user_id = ? and session_id = ? and msg_id < ?"
+	err := d.db.Raw(strSql, userId, sessionId, before).Scan(&result).Error
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0], nil
+}
+
+// FindSessionMinMsgId 查询所有分表中会话仍被成员持有的最小msg_id, 没有消息返回0
+func (d defaultUserMessageModel) FindSessionMinMsgId(sessionId int64) (int64, error) {
+	minMsgId := int64(0)
+	for i := int64(0); i < d.shards; i++ {
+		result := make([]int64, 0)
+		strSql := fmt.Sprintf("select coalesce(min(msg_id), 0) from user_message_%d where session_id = ?", i)
+		if err := d.db.Raw(strSql, sessionId).Scan(&result).Error; err != nil {
+			return 0, err
+		}
+		if len(result) > 0 && result[0] > 0 && (minMsgId == 0 || result[0] < minMsgId) {
+			minMsgId = result[0]
+		}
+	}
+	return minMsgId, nil
+}
+
+// PurgeMessagesBefore 物理删除用户在会话中msg_id小于before的消息, 每次最多删除count条
+func (d defaultUserMessageModel) PurgeMessagesBefore(userId, sessionId, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from %s where user_id = ? and session_id = ? and msg_id < ? limit ?", d.genUserMessageTableName(userId))
+	tx := d.db.Exec(sqlStr, userId, sessionId, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+// PurgeDeletedMessages 物理删除分表中update_time早于before的已软删除消息, 每次最多删除count条
+func (d defaultUserMessageModel) PurgeDeletedMessages(shard, before int64, count int) (int64, error) {
+	sqlStr := fmt.Sprintf("delete from user_message_%d where deleted = 1 and update_time < ? limit ?", shard)
+	tx := d.db.Exec(sqlStr, before, count)
+	return tx.RowsAffected, tx.Error
+}
+
+func (d defaultUserMessageModel) Shards() int64 {
+	return d.shards
+}
+
 func (d defaultUserMessageModel) genUserMessageTableName(userId int64) string {
 	return fmt.Sprintf("user_message_%d", userId%(d.shards))
 }
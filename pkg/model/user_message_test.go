@@ -0,0 +1,113 @@
+package model
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// openTestDB 需要可用的mysql测试库, 通过环境变量TEST_MYSQL_DSN指定, 未指定时跳过; 会重建sqlFiles中的0号分表
+func openTestDB(t *testing.T, sqlFiles ...string) *gorm.DB {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN not set")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open mysql %v", err)
+	}
+	for _, sqlFile := range sqlFiles {
+		ddl, errRead := os.ReadFile("../../sql/" + sqlFile + ".sql")
+		if errRead != nil {
+			t.Fatalf("read %s %v", sqlFile, errRead)
+		}
+		tableName := sqlFile + "_0"
+		if err = db.Exec("drop table if exists " + tableName).Error; err != nil {
+			t.Fatalf("drop %s %v", tableName, err)
+		}
+		if err = db.Exec(strings.ReplaceAll(string(ddl), "%s", "0")).Error; err != nil {
+			t.Fatalf("create %s %v", tableName, err)
+		}
+		t.Cleanup(func() {
+			db.Exec("drop table if exists " + tableName)
+		})
+	}
+	return db
+}
+
+func TestGetDeviceUserMessagesPaging(t *testing.T) {
+	db := openTestDB(t, "user_message", "user_device_cursor")
+	logger := logrus.NewEntry(logrus.New())
+	messageModel := NewUserMessageModel(db, logger, nil, 1)
+	cursorModel := NewUserDeviceCursorModel(db, logger, nil, 1)
+
+	const uId, platform, device = int64(1), "Android", "d1"
+	// 会话10每3条消息同一创建时间, 设备游标停在105; 会话20没有游标
+	expected := make([]*UserMessage, 0)
+	insert := func(sId, msgId, cTime int64, afterCursor bool) {
+		sqlStr := "insert into user_message_0 (msg_id, client_id, user_id, session_id, from_user_id, msg_type, msg_content, create_time) " +
+			"values (?, ?, ?, ?, ?, ?, ?, ?)"
+		if err := db.Exec(sqlStr, msgId, msgId, uId, sId, 2, 1, "m", cTime).Error; err != nil {
+			t.Fatalf("insert %d %v", msgId, err)
+		}
+		if afterCursor {
+			expected = append(expected, &UserMessage{MsgId: msgId, CreateTime: cTime})
+		}
+	}
+	for msgId := int64(101); msgId <= 130; msgId++ {
+		insert(10, msgId, 1000+(msgId-101)/3, msgId > 105)
+	}
+	for msgId := int64(201); msgId <= 210; msgId++ {
+		insert(20, msgId, 1000+msgId-201, true)
+	}
+	if err := cursorModel.AdvanceCursor(uId, platform, device, 10, 105); err != nil {
+		t.Fatalf("AdvanceCursor %v", err)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].CreateTime == expected[j].CreateTime {
+			return expected[i].MsgId < expected[j].MsgId
+		}
+		return expected[i].CreateTime < expected[j].CreateTime
+	})
+	wantMsgIds := make([]int64, 0, len(expected))
+	for _, m := range expected {
+		wantMsgIds = append(wantMsgIds, m.MsgId)
+	}
+
+	cases := []struct {
+		name  string
+		count int
+	}{
+		{"one per page", 1},
+		{"page smaller than pending", 7},
+		{"single page", 100},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := make([]int64, 0)
+			var cTime, msgId int64
+			for page := 0; page <= len(wantMsgIds); page++ {
+				messages, err := messageModel.GetDeviceUserMessages(uId, cursorModel.GenUserDeviceCursorTableName(uId), platform, device, cTime, msgId, 0, c.count)
+				if err != nil {
+					t.Fatalf("GetDeviceUserMessages %v", err)
+				}
+				for _, m := range messages {
+					got = append(got, m.MsgId)
+				}
+				if len(messages) < c.count {
+					break
+				}
+				cTime, msgId = messages[len(messages)-1].CreateTime, messages[len(messages)-1].MsgId
+			}
+			if !reflect.DeepEqual(got, wantMsgIds) {
+				t.Errorf("paged msg ids = %v, want %v", got, wantMsgIds)
+			}
+		})
+	}
+}
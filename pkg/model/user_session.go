@@ -38,11 +38,38 @@ type (
 		Status       int     `gorm:"status" json:"status"`
 		NoteName     string  `gorm:"note_name" json:"note_name"`
 		NoteAvatar   string  `gorm:"note_name" json:"note_avatar"`
+		UnreadCount  int     `gorm:"unread_count" json:"unread_count"`
+		MentionCount int     `gorm:"mention_count" json:"mention_count"`
+		LastMsgId    int64   `gorm:"last_msg_id" json:"last_msg_id"`
+		LastMsgType  int     `gorm:"last_msg_type" json:"last_msg_type"`
+		LastMsgFUid  int64   `gorm:"last_msg_fuid" json:"last_msg_fuid"`
+		LastMsgBody  *string `gorm:"last_msg_body" json:"last_msg_body"`
+		LastMsgTime  int64   `gorm:"last_msg_time" json:"last_msg_time"`
+		Draft        *string `gorm:"draft" json:"draft"`
+		DraftRMsgId  int64   `gorm:"draft_rmsg_id" json:"draft_rmsg_id"`
+		DraftTime    int64   `gorm:"draft_time" json:"draft_time"`
+		ReadSeq      int64   `gorm:"read_seq" json:"read_seq"`
+		ReadMsgTime  int64   `gorm:"read_msg_time" json:"read_msg_time"`
+		PurgedSeq    int64   `gorm:"purged_seq" json:"purged_seq"`
 		CreateTime   int64   `gorm:"create_time" json:"create_time"`
 		UpdateTime   int64   `gorm:"update_time" json:"update_time"`
 		Deleted      int8    `gorm:"deleted" json:"deleted"`
 	}
 
+	// LastMessage 会话最后一条消息快照, 用于会话列表展示
+	LastMessage struct {
+		MsgId      int64
+		MsgType    int
+		FromUserId int64
+		Body       string
+		CreateTime int64
+	}
+
+	UserSessionUnread struct {
+		UnreadCount  int `gorm:"unread_count" json:"unread_count"`
+		MentionCount int `gorm:"mention_count" json:"mention_count"`
+	}
+
 	UserSessionModel interface {
 		FindUserSessionByEntityId(userId, entityId int64, sessionType int, containDeleted bool) (*UserSession, error)
 		UpdateUserSessionType(userIds []int64, sessionId int64, sessionType int) error
@@ -51,6 +78,18 @@ type (
 		QueryLatestUserSessions(userId, mTime int64, offset, count int, types []int) ([]*UserSession, error)
 		QueryUserSessions(userId int64, offset, count int, types []int, searchName *string) ([]*UserSession, int, error)
 		GetUserSession(userId, sessionId int64) (*UserSession, error)
+		IncrUnreadCount(userIds []int64, sessionId int64, mentionUIds []int64) error
+		DecrUnreadCount(userId, sessionId int64, count, mentionCount int) error
+		SumUnreadCount(userId int64) (*UserSessionUnread, error)
+		FindUserSessionsByType(userId int64, sessionType int) ([]*UserSession, error)
+		FindUserSessionIds(userId int64) ([]int64, error)
+		UpdateLastMessage(userIds []int64, sessionId int64, lastMessage *LastMessage) error
+		UpdateDraft(userId, sessionId int64, draft *string, rMsgId, draftTime int64) (int64, error)
+		UpdateReadCursor(userId, sessionId, readSeq, readMsgTime int64) (int64, error)
+		UpdatePurgedSeq(userId, sessionId, seq int64) error
+		ResetLastMessage(userId, sessionId int64, lastMessage *LastMessage) error
+		RevokeLastMessage(sessionId, msgId int64) error
+		UpdateLastMessageBody(sessionId, msgId int64, body string) error
 		GenUserSessionTableName(userId int64) string
 	}
 
@@ -234,6 +273,183 @@ func (d defaultUserSessionModel) GetUserSession(userId, sessionId int64) (*UserS
 	return userSession, nil
 }
 
+func (d defaultUserSessionModel) IncrUnreadCount(userIds []int64, sessionId int64, mentionUIds []int64) (err error) {
+	mentioned := make(map[int64]bool)
+	for _, uId := range mentionUIds {
+		mentioned[uId] = true
+	}
+	// 分表uid数组, 被@的用户同时增加@我的消息数
+	sharedUIds := make(map[int64][]int64)
+	sharedMentionUIds := make(map[int64][]int64)
+	for _, uId := range userIds {
+		share := uId % d.shards
+		if mentioned[uId] {
+			sharedMentionUIds[share] = append(sharedMentionUIds[share], uId)
+		} else {
+			sharedUIds[share] = append(sharedUIds[share], uId)
+		}
+	}
+
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	// 发送消息时更新最后一条消息会修改update_time, 这里不重复修改
+	for k, v := range sharedUIds {
+		sql := fmt.Sprintf("update %s set unread_count = unread_count + 1 where session_id = ? and user_id in ? and deleted = 0", d.GenUserSessionTableName(k))
+		if err = tx.Exec(sql, sessionId, v).Error; err != nil {
+			return err
+		}
+	}
+	for k, v := range sharedMentionUIds {
+		sql := fmt.Sprintf("update %s set unread_count = unread_count + 1, mention_count = mention_count + 1 where session_id = ? and user_id in ? and deleted = 0", d.GenUserSessionTableName(k))
+		if err = tx.Exec(sql, sessionId, v).Error; err != nil {
+			return err
+		}
+	}
+	return
+}
+
+func (d defaultUserSessionModel) DecrUnreadCount(userId, sessionId int64, count, mentionCount int) error {
+	sqlStr := fmt.Sprintf("update %s set unread_count = greatest(unread_count - ?, 0), mention_count = greatest(mention_count - ?, 0), update_time = ? "+
+		"where user_id = ? and session_id = ?", d.GenUserSessionTableName(userId))
+	return d.db.Exec(sqlStr, count, mentionCount, time.Now().UnixMilli(), userId, sessionId).Error
+}
+
+func (d defaultUserSessionModel) SumUnreadCount(userId int64) (*UserSessionUnread, error) {
+	result := &UserSessionUnread{}
+	sqlStr := fmt.Sprintf("select ifnull(sum(unread_count), 0) as unread_count, ifnull(sum(mention_count), 0) as mention_count from %s "+
+		"where user_id = ? and type != ? and deleted = 0", d.GenUserSessionTableName(userId))
+	err := d.db.Raw(sqlStr, userId, SuperGroupSessionType).Scan(result).Error
+	return result, err
+}
+
+func (d defaultUserSessionModel) FindUserSessionsByType(userId int64, sessionType int) ([]*UserSession, error) {
+	userSessions := make([]*UserSession, 0)
+	sqlStr := fmt.Sprintf("select * from %s where user_id = ? and type = ? and deleted = 0", d.GenUserSessionTableName(userId))
+	err := d.db.Raw(sqlStr, userId, sessionType).Scan(&userSessions).Error
+	return userSessions, err
+}
+
+func (d defaultUserSessionModel) FindUserSessionIds(userId int64) ([]int64, error) {
+	sessionIds := make([]int64, 0)
+	sqlStr := fmt.Sprintf("select session_id from %s where user_id = ? and deleted = 0", d.GenUserSessionTableName(userId))
+	err := d.db.Raw(sqlStr, userId).Scan(&sessionIds).Error
+	return sessionIds, err
+}
+
+// UpdateLastMessage 更新最后一条消息快照, 只会被更新的消息覆盖
+func (d defaultUserSessionModel) UpdateLastMessage(userIds []int64, sessionId int64, lastMessage *LastMessage) (err error) {
+	sharedUIds := make(map[int64][]int64)
+	for _, uId := range userIds {
+		share := uId % d.shards
+		sharedUIds[share] = append(sharedUIds[share], uId)
+	}
+
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UnixMilli()
+	for k, v := range sharedUIds {
+		sql := fmt.Sprintf("update %s set last_msg_id = ?, last_msg_type = ?, last_msg_fuid = ?, last_msg_body = ?, last_msg_time = ?, update_time = ? "+
+			"where session_id = ? and user_id in ? and last_msg_id < ?", d.GenUserSessionTableName(k))
+		err = tx.Exec(sql, lastMessage.MsgId, lastMessage.MsgType, lastMessage.FromUserId, lastMessage.Body, lastMessage.CreateTime, now,
+			sessionId, v, lastMessage.MsgId).Error
+		if err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// UpdateDraft 保存草稿并更新会话修改时间以便多端同步, draft为空时清除草稿
+func (d defaultUserSessionModel) UpdateDraft(userId, sessionId int64, draft *string, rMsgId, draftTime int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set draft = ?, draft_rmsg_id = ?, draft_time = ?, update_time = ? "+
+		"where user_id = ? and session_id = ? and deleted = 0", d.GenUserSessionTableName(userId))
+	tx := d.db.Exec(sqlStr, draft, rMsgId, draftTime, draftTime, userId, sessionId)
+	return tx.RowsAffected, tx.Error
+}
+
+// UpdateReadCursor 推进超级群已读游标, 游标没有前进时不更新, 返回影响行数
+func (d defaultUserSessionModel) UpdateReadCursor(userId, sessionId, readSeq, readMsgTime int64) (int64, error) {
+	sqlStr := fmt.Sprintf("update %s set read_seq = greatest(read_seq, ?), read_msg_time = greatest(read_msg_time, ?), update_time = ? "+
+		"where user_id = ? and session_id = ? and deleted = 0 and (read_seq < ? or read_msg_time < ?)", d.GenUserSessionTableName(userId))
+	tx := d.db.Exec(sqlStr, readSeq, readMsgTime, time.Now().UnixMilli(), userId, sessionId, readSeq, readMsgTime)
+	return tx.RowsAffected, tx.Error
+}
+
+// UpdatePurgedSeq 记录用户在会话中已被清理的最大消息序号, 只会增大
+func (d defaultUserSessionModel) UpdatePurgedSeq(userId, sessionId, seq int64) error {
+	sqlStr := fmt.Sprintf("update %s set purged_seq = ? where user_id = ? and session_id = ? and purged_seq < ?", d.GenUserSessionTableName(userId))
+	return d.db.Exec(sqlStr, seq, userId, sessionId, seq).Error
+}
+
+// ResetLastMessage 最后一条消息被删除后重置快照, lastMessage为空时清空快照
+func (d defaultUserSessionModel) ResetLastMessage(userId, sessionId int64, lastMessage *LastMessage) error {
+	if lastMessage == nil {
+		lastMessage = &LastMessage{}
+	}
+	sqlStr := fmt.Sprintf("update %s set last_msg_id = ?, last_msg_type = ?, last_msg_fuid = ?, last_msg_body = ?, last_msg_time = ?, update_time = ? "+
+		"where user_id = ? and session_id = ?", d.GenUserSessionTableName(userId))
+	return d.db.Exec(sqlStr, lastMessage.MsgId, lastMessage.MsgType, lastMessage.FromUserId, lastMessage.Body, lastMessage.CreateTime,
+		time.Now().UnixMilli(), userId, sessionId).Error
+}
+
+// RevokeLastMessage 最后一条消息被撤回时将快照标记为撤回并清空内容, 按session_id更新所有分表, 无需加载成员列表
+func (d defaultUserSessionModel) RevokeLastMessage(sessionId, msgId int64) (err error) {
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UnixMilli()
+	for i := int64(0); i < d.shards; i++ {
+		sql := fmt.Sprintf("update %s set last_msg_type = ?, last_msg_body = '', update_time = ? "+
+			"where session_id = ? and last_msg_id = ?", d.GenUserSessionTableName(i))
+		if err = tx.Exec(sql, MsgTypeRevoke, now, sessionId, msgId).Error; err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// UpdateLastMessageBody 最后一条消息被重新编辑时更新快照内容, 按session_id更新所有分表
+func (d defaultUserSessionModel) UpdateLastMessageBody(sessionId, msgId int64, body string) (err error) {
+	tx := d.db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UnixMilli()
+	for i := int64(0); i < d.shards; i++ {
+		sql := fmt.Sprintf("update %s set last_msg_body = ?, update_time = ? "+
+			"where session_id = ? and last_msg_id = ?", d.GenUserSessionTableName(i))
+		if err = tx.Exec(sql, body, now, sessionId, msgId).Error; err != nil {
+			return err
+		}
+	}
+	return
+}
+
 func (d defaultUserSessionModel) GenUserSessionTableName(userId int64) string {
 	return fmt.Sprintf("user_session_%d", userId%(d.shards))
 }
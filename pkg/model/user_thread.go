@@ -0,0 +1,88 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/thk-im/thk-im-base-server/snowflake"
+	"gorm.io/gorm"
+)
+
+type (
+	UserThread struct {
+		Id         int64 `gorm:"id" json:"id"`
+		UserId     int64 `gorm:"user_id" json:"user_id"`
+		SessionId  int64 `gorm:"session_id" json:"session_id"`
+		RootMsgId  int64 `gorm:"root_msg_id" json:"root_msg_id"`
+		CreateTime int64 `gorm:"create_time" json:"create_time"`
+		UpdateTime int64 `gorm:"update_time" json:"update_time"`
+	}
+
+	UserThreadModel interface {
+		JoinThread(userIds []int64, sessionId, rootMsgId, joinTime int64) error
+		FindUserThreads(userId int64, sessionId *int64, offset, count int) ([]*UserThread, error)
+		DeleteUserThreadsBefore(userId, sessionId, before int64) error
+		DeleteSessionThreadsBefore(sessionId, before int64, count int) (int64, error)
+	}
+
+	defaultUserThreadModel struct {
+		shards        int64
+		db            *gorm.DB
+		logger        *logrus.Entry
+		snowflakeNode *snowflake.Node
+	}
+)
+
+// JoinThread 记录用户参与的话题, 已参与则更新最后参与时间
+func (d defaultUserThreadModel) JoinThread(userIds []int64, sessionId, rootMsgId, joinTime int64) error {
+	for _, userId := range userIds {
+		sqlStr := fmt.Sprintf("insert into %s (user_id, session_id, root_msg_id, create_time, update_time) values (?, ?, ?, ?, ?) "+
+			"on duplicate key update update_time = greatest(update_time, ?)", d.genUserThreadTableName(userId))
+		if err := d.db.Exec(sqlStr, userId, sessionId, rootMsgId, joinTime, joinTime, joinTime).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d defaultUserThreadModel) FindUserThreads(userId int64, sessionId *int64, offset, count int) ([]*UserThread, error) {
+	result := make([]*UserThread, 0)
+	sqlBuffer := bytes.NewBufferString("select * from " + d.genUserThreadTableName(userId) + " where user_id = ? ")
+	var err error
+	if sessionId != nil {
+		sqlBuffer.WriteString("and session_id = ? order by update_time desc limit ? offset ?")
+		err = d.db.Raw(sqlBuffer.String(), userId, *sessionId, count, offset).Scan(&result).Error
+	} else {
+		sqlBuffer.WriteString("order by update_time desc limit ? offset ?")
+		err = d.db.Raw(sqlBuffer.String(), userId, count, offset).Scan(&result).Error
+	}
+	return result, err
+}
+
+// DeleteUserThreadsBefore 删除用户在会话中根消息id小于before的话题记录
+func (d defaultUserThreadModel) DeleteUserThreadsBefore(userId, sessionId, before int64) error {
+	sqlStr := fmt.Sprintf("delete from %s where user_id = ? and session_id = ? and root_msg_id < ?", d.genUserThreadTableName(userId))
+	return d.db.Exec(sqlStr, userId, sessionId, before).Error
+}
+
+// DeleteSessionThreadsBefore 删除所有分表中会话根消息id小于before的话题记录, 每个分表每次最多删除count条
+func (d defaultUserThreadModel) DeleteSessionThreadsBefore(sessionId, before int64, count int) (int64, error) {
+	total := int64(0)
+	for i := int64(0); i < d.shards; i++ {
+		sqlStr := fmt.Sprintf("delete from user_thread_%d where session_id = ? and root_msg_id < ? limit ?", i)
+		tx := d.db.Exec(sqlStr, sessionId, before, count)
+		if tx.Error != nil {
+			return total, tx.Error
+		}
+		total += tx.RowsAffected
+	}
+	return total, nil
+}
+
+func (d defaultUserThreadModel) genUserThreadTableName(userId int64) string {
+	return fmt.Sprintf("user_thread_%d", userId%(d.shards))
+}
+
+func NewUserThreadModel(db *gorm.DB, logger *logrus.Entry, snowflakeNode *snowflake.Node, shards int64) UserThreadModel {
+	return defaultUserThreadModel{db: db, logger: logger, snowflakeNode: snowflakeNode, shards: shards}
+}
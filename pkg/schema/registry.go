@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var (
+	ErrVersionNotSupport = errors.New("schema version not support")
+)
+
+type (
+	// MessageSchema 一种消息类型某个版本的schema, 对应schema目录下的一个json文件
+	MessageSchema struct {
+		MsgType int     `json:"msg_type"`
+		Version int     `json:"version"`
+		Body    *Schema `json:"body"`
+		ExtData *Schema `json:"ext_data"`
+	}
+
+	// Registry 消息类型到schema的注册表, 同一消息类型可以有多个版本, 加载后只读
+	Registry struct {
+		schemas map[int][]*MessageSchema
+	}
+)
+
+// Has 消息类型是否注册了schema
+func (r *Registry) Has(msgType int) bool {
+	return len(r.schemas[msgType]) > 0
+}
+
+// Validate 校验消息体和扩展数据, version为0时只要符合任一版本即可, 否则按指定版本校验
+func (r *Registry) Validate(msgType, version int, body string, extData *string) error {
+	schemas := r.schemas[msgType]
+	if len(schemas) == 0 {
+		return nil
+	}
+	if version > 0 {
+		for _, s := range schemas {
+			if s.Version == version {
+				return s.validate(body, extData)
+			}
+		}
+		return ErrVersionNotSupport
+	}
+	var firstErr error
+	for _, s := range schemas {
+		err := s.validate(body, extData)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *MessageSchema) validate(body string, extData *string) error {
+	if m.Body != nil {
+		if err := validateDocument(m.Body, body, "body"); err != nil {
+			return err
+		}
+	}
+	if m.ExtData != nil && extData != nil && *extData != "" {
+		if err := validateDocument(m.ExtData, *extData, "ext_data"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDocument schema类型为string时直接校验原文, 否则按json解析后校验
+func validateDocument(s *Schema, document string, path string) error {
+	if len(s.Type) == 1 && s.Type[0] == "string" {
+		return s.Validate(document, path)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return fmt.Errorf("%s: invalid json", path)
+	}
+	return s.Validate(value, path)
+}
+
+// LoadRegistry 加载目录下所有json格式的消息schema文件, 同一类型按版本从新到旧排列
+func LoadRegistry(dir string) (*Registry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	registry := &Registry{schemas: make(map[int][]*MessageSchema)}
+	for _, file := range files {
+		data, errRead := os.ReadFile(file)
+		if errRead != nil {
+			return nil, errRead
+		}
+		messageSchema := &MessageSchema{}
+		if err = json.Unmarshal(data, messageSchema); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if messageSchema.Version <= 0 {
+			return nil, fmt.Errorf("%s: version should > 0", file)
+		}
+		for _, s := range []*Schema{messageSchema.Body, messageSchema.ExtData} {
+			if s == nil {
+				continue
+			}
+			if err = s.compile(); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+		}
+		for _, exist := range registry.schemas[messageSchema.MsgType] {
+			if exist.Version == messageSchema.Version {
+				return nil, fmt.Errorf("%s: duplicate version %d of type %d", file, messageSchema.Version, messageSchema.MsgType)
+			}
+		}
+		registry.schemas[messageSchema.MsgType] = append(registry.schemas[messageSchema.MsgType], messageSchema)
+	}
+	for _, schemas := range registry.schemas {
+		sort.Slice(schemas, func(i, j int) bool {
+			return schemas[i].Version > schemas[j].Version
+		})
+	}
+	return registry, nil
+}
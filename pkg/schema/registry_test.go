@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	registry, err := LoadRegistry("../../etc/schemas")
+	if err != nil {
+		t.Fatalf("LoadRegistry() err = %v", err)
+	}
+	extData := `{"a": 1}`
+	cases := []struct {
+		name    string
+		msgType int
+		version int
+		body    string
+		extData *string
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "unregistered type", msgType: 999, body: "anything"},
+		{name: "text", msgType: 1, body: "hello"},
+		{name: "empty text", msgType: 1, body: "", anyErr: true},
+		{name: "image matches v1", msgType: 4, body: `{"url": "u", "width": 1, "height": 1}`},
+		{name: "image v2 missing thumbnail", msgType: 4, version: 2, body: `{"url": "u", "width": 1, "height": 1}`, anyErr: true},
+		{name: "image v2", msgType: 4, version: 2, body: `{"url": "u", "thumbnail_url": "t", "width": 1, "height": 1}`},
+		{name: "unknown version", msgType: 4, version: 9, body: `{}`, wantErr: ErrVersionNotSupport, anyErr: true},
+		{name: "invalid json", msgType: 4, body: `{`, anyErr: true},
+		{name: "ext data without schema", msgType: 1, body: "hello", extData: &extData},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := registry.Validate(c.msgType, c.version, c.body, c.extData)
+			if (err != nil) != c.anyErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, c.anyErr)
+			}
+			if c.wantErr != nil && err != c.wantErr {
+				t.Errorf("Validate() err = %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRegistryInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no version", map[string]string{"a.json": `{"msg_type": 1, "body": {"type": "string"}}`}},
+		{"duplicate version", map[string]string{
+			"a.json": `{"msg_type": 1, "version": 1, "body": {"type": "string"}}`,
+			"b.json": `{"msg_type": 1, "version": 1, "body": {"type": "string"}}`,
+		}},
+		{"bad pattern", map[string]string{"a.json": `{"msg_type": 1, "version": 1, "body": {"type": "string", "pattern": "("}}`}},
+		{"unsupported keyword", map[string]string{"a.json": `{"msg_type": 1, "version": 1, "body": {"allOf": []}}`}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range c.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadRegistry(dir); err == nil {
+				t.Errorf("LoadRegistry() err = nil, want error")
+			}
+		})
+	}
+}
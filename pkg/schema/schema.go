@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"unicode/utf8"
+)
+
+type (
+	// Types json schema的type字段, 可以是单个类型或类型数组
+	Types []string
+
+	// Schema json schema的子集: type/enum/const/字符串长度与pattern/数值范围/对象属性/数组元素
+	Schema struct {
+		Type                 Types              `json:"type"`
+		Enum                 []interface{}      `json:"enum"`
+		Const                interface{}        `json:"const"`
+		MinLength            *int               `json:"minLength"`
+		MaxLength            *int               `json:"maxLength"`
+		Pattern              string             `json:"pattern"`
+		Minimum              *float64           `json:"minimum"`
+		Maximum              *float64           `json:"maximum"`
+		Properties           map[string]*Schema `json:"properties"`
+		Required             []string           `json:"required"`
+		AdditionalProperties *bool              `json:"additionalProperties"`
+		Items                *Schema            `json:"items"`
+		MinItems             *int               `json:"minItems"`
+		MaxItems             *int               `json:"maxItems"`
+
+		pattern *regexp.Regexp
+	}
+)
+
+var (
+	// supportedKeywords 支持的校验关键字, 以及不参与校验的注释类关键字
+	supportedKeywords = map[string]bool{
+		"type": true, "enum": true, "const": true, "minLength": true, "maxLength": true, "pattern": true,
+		"minimum": true, "maximum": true, "properties": true, "required": true, "additionalProperties": true,
+		"items": true, "minItems": true, "maxItems": true,
+		"$schema": true, "$comment": true, "title": true, "description": true, "default": true, "examples": true,
+	}
+)
+
+// UnmarshalJSON 出现不支持的关键字($ref/oneOf/format等)时报错, 避免schema被静默放宽
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return err
+	}
+	for keyword := range keywords {
+		if !supportedKeywords[keyword] {
+			return fmt.Errorf("keyword %s not supported", keyword)
+		}
+	}
+	type schemaAlias Schema
+	return json.Unmarshal(data, (*schemaAlias)(s))
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*t = multi
+	return nil
+}
+
+// compile 预编译pattern, 加载schema时调用
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = pattern
+	}
+	for _, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// Validate 校验json.Unmarshal得到的值, path为出错字段路径
+func (s *Schema) Validate(value interface{}, path string) error {
+	if len(s.Type) > 0 && !s.matchType(value) {
+		return fmt.Errorf("%s: type should be %v", path, []string(s.Type))
+	}
+	if len(s.Enum) > 0 {
+		matched := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: not in enum", path)
+		}
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.Const, value) {
+		return fmt.Errorf("%s: should be %v", path, s.Const)
+	}
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: length should >= %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: length should <= %d", path, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s: not match pattern", path)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: should >= %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: should <= %v", path, *s.Maximum)
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				return fmt.Errorf("%s.%s: required", path, key)
+			}
+		}
+		for key, property := range v {
+			propertySchema, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s.%s: not allowed", path, key)
+				}
+				continue
+			}
+			if err := propertySchema.Validate(property, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: items should >= %d", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: items should <= %d", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.Validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) matchType(value interface{}) bool {
+	for _, t := range s.Type {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		schema  string
+		value   string
+		wantErr bool
+	}{
+		{"type match", `{"type": "integer"}`, `1`, false},
+		{"type mismatch", `{"type": "integer"}`, `1.5`, true},
+		{"multi type", `{"type": ["string", "null"]}`, `null`, false},
+		{"enum match", `{"enum": ["png", "gif"]}`, `"png"`, false},
+		{"enum mismatch", `{"enum": ["png", "gif"]}`, `"bmp"`, true},
+		{"const mismatch", `{"const": 1}`, `2`, true},
+		{"min length", `{"type": "string", "minLength": 2}`, `"中"`, true},
+		{"max length counts runes", `{"type": "string", "maxLength": 2}`, `"中文"`, false},
+		{"pattern mismatch", `{"type": "string", "pattern": "^https://"}`, `"http://a"`, true},
+		{"minimum", `{"type": "number", "minimum": 1}`, `0`, true},
+		{"maximum", `{"type": "number", "maximum": 1}`, `1`, false},
+		{"required missing", `{"type": "object", "required": ["url"]}`, `{}`, true},
+		{"additional not allowed", `{"type": "object", "additionalProperties": false}`, `{"a": 1}`, true},
+		{"additional allowed by default", `{"type": "object"}`, `{"a": 1}`, false},
+		{"nested property", `{"type": "object", "properties": {"w": {"type": "integer", "minimum": 1}}}`, `{"w": 0}`, true},
+		{"items", `{"type": "array", "items": {"type": "string"}}`, `["a", 1]`, true},
+		{"max items", `{"type": "array", "maxItems": 1}`, `[1, 2]`, true},
+		{"annotations ignored", `{"title": "t", "description": "d", "type": "string"}`, `"a"`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Schema{}
+			if err := json.Unmarshal([]byte(c.schema), s); err != nil {
+				t.Fatalf("unmarshal schema: %v", err)
+			}
+			if err := s.compile(); err != nil {
+				t.Fatalf("compile schema: %v", err)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(c.value), &value); err != nil {
+				t.Fatalf("unmarshal value: %v", err)
+			}
+			if err := s.Validate(value, "body"); (err != nil) != c.wantErr {
+				t.Errorf("Validate() err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaUnsupportedKeyword(t *testing.T) {
+	cases := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{"supported", `{"type": "object", "properties": {"format": {"type": "string"}}}`, false},
+		{"ref", `{"$ref": "#/definitions/a"}`, true},
+		{"one of", `{"oneOf": [{"type": "string"}]}`, true},
+		{"nested format", `{"type": "object", "properties": {"url": {"type": "string", "format": "uri"}}}`, true},
+		{"items any of", `{"type": "array", "items": {"anyOf": [{"type": "string"}]}}`, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := json.Unmarshal([]byte(c.schema), &Schema{})
+			if (err != nil) != c.wantErr {
+				t.Errorf("Unmarshal() err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
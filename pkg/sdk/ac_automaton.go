@@ -0,0 +1,106 @@
+package sdk
+
+import "unicode"
+
+type (
+	acNode struct {
+		children map[rune]*acNode
+		fail     *acNode
+		// depth 当前节点对应的词长度(rune数)
+		depth int
+		// outputs 以当前节点结尾的词所属的分类下标
+		outputs []int
+		// output fail链上最近的有输出的节点, 用于找出当前位置结尾的较短词
+		output *acNode
+	}
+
+	// acMatch 命中的词在文本中的rune区间[Start, End)及所属分类
+	acMatch struct {
+		Start    int
+		End      int
+		Category int
+	}
+
+	// acAutomaton Aho-Corasick多模式匹配自动机, 构建后只读, 可并发使用
+	acAutomaton struct {
+		root *acNode
+	}
+)
+
+func newAcNode(depth int) *acNode {
+	return &acNode{children: make(map[rune]*acNode), depth: depth}
+}
+
+// newAcAutomaton 构建自动机, words的key为分类下标, 匹配忽略大小写
+func newAcAutomaton(words map[int][]string) *acAutomaton {
+	root := newAcNode(0)
+	for category, ws := range words {
+		for _, w := range ws {
+			runes := []rune(w)
+			if len(runes) == 0 {
+				continue
+			}
+			node := root
+			for _, r := range runes {
+				r = unicode.ToLower(r)
+				child, ok := node.children[r]
+				if !ok {
+					child = newAcNode(node.depth + 1)
+					node.children[r] = child
+				}
+				node = child
+			}
+			node.outputs = append(node.outputs, category)
+		}
+	}
+
+	// 按层遍历建立fail指针
+	queue := make([]*acNode, 0)
+	for _, child := range root.children {
+		child.fail = root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for r, child := range node.children {
+			fail := node.fail
+			for fail != nil && fail.children[r] == nil {
+				fail = fail.fail
+			}
+			if fail == nil {
+				child.fail = root
+			} else {
+				child.fail = fail.children[r]
+			}
+			if len(child.fail.outputs) > 0 {
+				child.output = child.fail
+			} else {
+				child.output = child.fail.output
+			}
+			queue = append(queue, child)
+		}
+	}
+	return &acAutomaton{root: root}
+}
+
+// Match 返回text中所有命中的词
+func (a *acAutomaton) Match(text []rune) []acMatch {
+	matches := make([]acMatch, 0)
+	node := a.root
+	for i, r := range text {
+		r = unicode.ToLower(r)
+		for node != a.root && node.children[r] == nil {
+			node = node.fail
+		}
+		if next, ok := node.children[r]; ok {
+			node = next
+		}
+		for n := node; n != nil; n = n.output {
+			for _, category := range n.outputs {
+				matches = append(matches, acMatch{Start: i + 1 - n.depth, End: i + 1, Category: category})
+			}
+		}
+	}
+	return matches
+}
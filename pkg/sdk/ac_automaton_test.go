@@ -0,0 +1,45 @@
+package sdk
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAcAutomatonMatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		words map[int][]string
+		text  string
+		want  []acMatch
+	}{
+		{"no match", map[int][]string{0: {"abc"}}, "abd", []acMatch{}},
+		{"single word", map[int][]string{0: {"abc"}}, "xabcx", []acMatch{{1, 4, 0}}},
+		{"ignore case", map[int][]string{0: {"AbC"}}, "aBc", []acMatch{{0, 3, 0}}},
+		{"repeated", map[int][]string{0: {"ab"}}, "abab", []acMatch{{0, 2, 0}, {2, 4, 0}}},
+		{"overlapping", map[int][]string{0: {"aba"}}, "ababa", []acMatch{{0, 3, 0}, {2, 5, 0}}},
+		{"suffix word via fail link", map[int][]string{0: {"abcd"}, 1: {"bc"}}, "abce", []acMatch{{1, 3, 1}}},
+		{"nested words", map[int][]string{0: {"she", "he"}, 1: {"hers"}}, "ushers",
+			[]acMatch{{1, 4, 0}, {2, 4, 0}, {2, 6, 1}}},
+		{"unicode runes", map[int][]string{0: {"敏感"}}, "这是敏感词", []acMatch{{2, 4, 0}}},
+		{"same word in two categories", map[int][]string{0: {"ab"}, 1: {"ab"}}, "ab", []acMatch{{0, 2, 0}, {0, 2, 1}}},
+		{"empty word ignored", map[int][]string{0: {""}}, "abc", []acMatch{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := newAcAutomaton(c.words).Match([]rune(c.text))
+			sort.Slice(got, func(i, j int) bool {
+				if got[i].End != got[j].End {
+					return got[i].End < got[j].End
+				}
+				if got[i].Start != got[j].Start {
+					return got[i].Start < got[j].Start
+				}
+				return got[i].Category < got[j].Category
+			})
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Match(%q) = %v, want %v", c.text, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package sdk
+
+import (
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	SensitiveActionReject = "reject" // 拒绝发送
+	SensitiveActionMask   = "mask"   // 敏感词替换为*后发送
+	SensitiveActionReview = "review" // 正常发送, 标记待人工审核
+)
+
+type (
+	// SensitiveCategory 敏感词分类, 同一分类的词使用相同的处理方式
+	SensitiveCategory struct {
+		Name   string   `yaml:"Name"`
+		Action string   `yaml:"Action"`
+		Words  []string `yaml:"Words"`
+	}
+
+	SensitiveWords struct {
+		Categories []*SensitiveCategory `yaml:"Categories"`
+	}
+
+	sensitiveMatcher struct {
+		automaton  *acAutomaton
+		categories []*SensitiveCategory
+	}
+
+	// localMsgCheckerApi 进程内敏感词检测, 词库文件变更后自动重新加载
+	localMsgCheckerApi struct {
+		wordFile     string
+		messageTypes map[int]bool
+		logger       *logrus.Entry
+		mutex        sync.RWMutex
+		matcher      *sensitiveMatcher
+		modTime      time.Time
+	}
+)
+
+func (d *localMsgCheckerApi) CheckMessage(req *dto.CheckMessageReq, claims baseDto.ThkClaims) error {
+	if len(d.messageTypes) > 0 && !d.messageTypes[req.MessageType] {
+		return nil
+	}
+	d.mutex.RLock()
+	matcher := d.matcher
+	d.mutex.RUnlock()
+	if matcher == nil || req.MessageContent == "" {
+		return nil
+	}
+	content := []rune(req.MessageContent)
+	matches := matcher.automaton.Match(content)
+	if len(matches) == 0 {
+		return nil
+	}
+	masked := false
+	for _, match := range matches {
+		category := matcher.categories[match.Category]
+		switch category.Action {
+		case SensitiveActionReject:
+			d.logger.WithFields(logrus.Fields(claims)).Infof("CheckMessage reject: %d %d %s", req.SessionId, req.FromUId, category.Name)
+			return errorx.ErrMessageContentSensitive
+		case SensitiveActionMask:
+			for i := match.Start; i < match.End; i++ {
+				content[i] = '*'
+			}
+			masked = true
+		case SensitiveActionReview:
+			if !containsString(req.ReviewCategories, category.Name) {
+				req.ReviewCategories = append(req.ReviewCategories, category.Name)
+			}
+		}
+	}
+	if masked {
+		req.MessageContent = string(content)
+	}
+	return nil
+}
+
+// reload 词库文件修改时间变化时重新构建自动机, 加载失败保留旧词库
+func (d *localMsgCheckerApi) reload() error {
+	info, err := os.Stat(d.wordFile)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(d.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(d.wordFile)
+	if err != nil {
+		return err
+	}
+	sensitiveWords := &SensitiveWords{}
+	if err = yaml.Unmarshal(data, sensitiveWords); err != nil {
+		return err
+	}
+	words := make(map[int][]string)
+	for i, category := range sensitiveWords.Categories {
+		words[i] = category.Words
+	}
+	matcher := &sensitiveMatcher{
+		automaton:  newAcAutomaton(words),
+		categories: sensitiveWords.Categories,
+	}
+	d.mutex.Lock()
+	d.matcher = matcher
+	d.mutex.Unlock()
+	d.modTime = info.ModTime()
+	d.logger.Infof("reload sensitive words: %s %d categories", d.wordFile, len(sensitiveWords.Categories))
+	return nil
+}
+
+func (d *localMsgCheckerApi) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := d.reload(); err != nil {
+				d.logger.Errorf("reload sensitive words: %s %v", d.wordFile, err)
+			}
+		}
+	}()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewLocalMsgCheckerApi 创建本地敏感词检测, messageTypes为空时检测所有消息类型, reloadInterval大于0时定时检查词库文件变更
+func NewLocalMsgCheckerApi(wordFile string, messageTypes []int, reloadInterval time.Duration, logger *logrus.Entry) (MsgCheckerApi, error) {
+	checker := &localMsgCheckerApi{
+		wordFile:     wordFile,
+		messageTypes: make(map[int]bool),
+		logger:       logger.WithField("checker", "local"),
+	}
+	for _, t := range messageTypes {
+		checker.messageTypes[t] = true
+	}
+	if err := checker.reload(); err != nil {
+		return nil, err
+	}
+	if reloadInterval > 0 {
+		checker.watch(reloadInterval)
+	}
+	return checker, nil
+}
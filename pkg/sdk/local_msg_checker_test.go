@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/errorx"
+)
+
+const testSensitiveWords = `Categories:
+  - Name: politics
+    Action: reject
+    Words: ["禁词"]
+  - Name: abuse
+    Action: mask
+    Words: ["bad", "坏话"]
+  - Name: ads
+    Action: review
+    Words: ["广告", "加微信"]
+`
+
+func TestLocalMsgCheckerCheckMessage(t *testing.T) {
+	wordFile := filepath.Join(t.TempDir(), "sensitive_words.yaml")
+	if err := os.WriteFile(wordFile, []byte(testSensitiveWords), 0644); err != nil {
+		t.Fatalf("write word file: %v", err)
+	}
+	checker, err := NewLocalMsgCheckerApi(wordFile, []int{1}, 0, logrus.NewEntry(logrus.New()))
+	if err != nil {
+		t.Fatalf("NewLocalMsgCheckerApi: %v", err)
+	}
+	cases := []struct {
+		name       string
+		msgType    int
+		content    string
+		wantErr    error
+		wantBody   string
+		wantReview []string
+	}{
+		{"clean", 1, "你好", nil, "你好", nil},
+		{"reject", 1, "这是禁词", errorx.ErrMessageContentSensitive, "这是禁词", nil},
+		{"mask", 1, "you are BAD, 坏话", nil, "you are ***, **", nil},
+		{"review once per category", 1, "广告广告加微信", nil, "广告广告加微信", []string{"ads"}},
+		{"mask and review", 1, "bad广告", nil, "***广告", []string{"ads"}},
+		{"unchecked message type", 2, "这是禁词", nil, "这是禁词", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &dto.CheckMessageReq{MessageType: c.msgType, MessageContent: c.content}
+			err := checker.CheckMessage(req, baseDto.ThkClaims{})
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("CheckMessage() err = %v, want %v", err, c.wantErr)
+			}
+			if req.MessageContent != c.wantBody {
+				t.Errorf("MessageContent = %q, want %q", req.MessageContent, c.wantBody)
+			}
+			if !reflect.DeepEqual(req.ReviewCategories, c.wantReview) {
+				t.Errorf("ReviewCategories = %v, want %v", req.ReviewCategories, c.wantReview)
+			}
+		})
+	}
+}
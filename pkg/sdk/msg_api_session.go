@@ -33,7 +33,7 @@ func (d defaultMsgApi) QuerySessionUserCount(sessionId int64, claims baseDto.Thk
 		return nil, e
 	} else {
 		if res.Body() == nil || len(res.Body()) == 0 {
-			d.logger.WithFields(logrus.Fields(claims)).Info("QuerySessionUserCount: %v %s", sessionId, "Body is nil")
+			d.logger.WithFields(logrus.Fields(claims)).Infof("QuerySessionUserCount: %v %s", sessionId, "Body is nil")
 			return nil, nil
 		}
 		resp := &dto.SessionUserCountRes{}
@@ -186,7 +186,7 @@ func (d defaultMsgApi) QueryLatestSessionUsers(sessionId int64, req *dto.QuerySe
 		return nil, e
 	} else {
 		if res.Body() == nil || len(res.Body()) == 0 {
-			d.logger.WithFields(logrus.Fields(claims)).Info("QueryLatestSessionUsers: %v %s", req, "Body is nil")
+			d.logger.WithFields(logrus.Fields(claims)).Infof("QueryLatestSessionUsers: %v %s", req, "Body is nil")
 			return nil, nil
 		}
 		resp := &dto.QuerySessionUsersRes{}
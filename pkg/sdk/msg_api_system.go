@@ -170,7 +170,7 @@ func (d defaultMsgApi) SysQueryLatestSessionUsers(sessionId int64, req *dto.Quer
 		return nil, e
 	} else {
 		if res.Body() == nil || len(res.Body()) == 0 {
-			d.logger.WithFields(logrus.Fields(claims)).Info("SysQueryLatestSessionUsers: %v %s", req, "Body is nil")
+			d.logger.WithFields(logrus.Fields(claims)).Infof("SysQueryLatestSessionUsers: %v %s", req, "Body is nil")
 			return nil, nil
 		}
 		resp := &dto.QuerySessionUsersRes{}
@@ -0,0 +1,38 @@
+package sdk
+
+import (
+	baseDto "github.com/thk-im/thk-im-base-server/dto"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/dto"
+)
+
+type (
+	// msgCheckerChain 按顺序执行多个检测, 任一检测返回错误即终止, 前面检测对内容的修改对后续检测可见
+	msgCheckerChain struct {
+		checkers []MsgCheckerApi
+	}
+)
+
+func (d msgCheckerChain) CheckMessage(req *dto.CheckMessageReq, claims baseDto.ThkClaims) error {
+	for _, checker := range d.checkers {
+		if err := checker.CheckMessage(req, claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMsgCheckerChain 组合多个检测, 忽略nil, 没有可用检测时返回nil
+func NewMsgCheckerChain(checkers ...MsgCheckerApi) MsgCheckerApi {
+	chain := msgCheckerChain{checkers: make([]MsgCheckerApi, 0, len(checkers))}
+	for _, checker := range checkers {
+		if checker != nil {
+			chain.checkers = append(chain.checkers, checker)
+		}
+	}
+	if len(chain.checkers) == 0 {
+		return nil
+	} else if len(chain.checkers) == 1 {
+		return chain.checkers[0]
+	}
+	return chain
+}
@@ -0,0 +1,34 @@
+package task
+
+import (
+	"github.com/thk-im/thk-im-msgapi-server/pkg/app"
+	"github.com/thk-im/thk-im-msgapi-server/pkg/logic"
+	"time"
+)
+
+const (
+	messageOutboxRelayInterval = 3 * time.Second
+	scheduledMessageInterval   = 1 * time.Second
+	expiredMessageInterval     = 10 * time.Second
+)
+
+// StartMsgApiTasks 启动msgapi进程内的后台任务
+func StartMsgApiTasks(appCtx *app.Context) {
+	messageLogic := logic.NewMessageLogic(appCtx)
+	startTicker(messageOutboxRelayInterval, messageLogic.RelayMessageOutboxes) // 投递未成功投递的消息
+	startTicker(scheduledMessageInterval, messageLogic.SendScheduledMessages)  // 发送到期的定时消息
+	startTicker(expiredMessageInterval, messageLogic.SweepExpiredMessages)     // 销毁过期的消息
+	if interval := appCtx.MsgApiConfig().IM.MessageRetention.Interval; interval > 0 {
+		startTicker(time.Duration(interval)*time.Second, messageLogic.PurgeMessages) // 清理超出保留规则和已软删除的消息
+	}
+}
+
+func startTicker(interval time.Duration, job func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			job()
+		}
+	}()
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `message_edit_history_%s`
+(
+    `id`          BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`  BIGINT NOT NULL,
+    `msg_id`      BIGINT NOT NULL,
+    `user_id`     BIGINT NOT NULL COMMENT '编辑人id',
+    `msg_content` TEXT   NOT NULL COMMENT '编辑前的消息内容',
+    `create_time` BIGINT NOT NULL DEFAULT 0 COMMENT '编辑时间',
+    INDEX `MESSAGE_EDIT_HISTORY_IDX` (`session_id`, `msg_id`, `create_time`)
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS `message_outbox_%s`
+(
+    `id`                BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`        BIGINT  NOT NULL,
+    `msg_id`            BIGINT  NOT NULL,
+    `session_type`      INT     NOT NULL COMMENT '会话类型',
+    `msg_body`          TEXT    NOT NULL COMMENT '待投递消息内容',
+    `receivers`         TEXT    NOT NULL COMMENT '接收人uid数组',
+    `offline_receivers` TEXT    NOT NULL COMMENT '离线推送uid数组',
+    `status`            TINYINT NOT NULL DEFAULT 0 COMMENT '0待投递/1已投递/2投递失败',
+    `retry_count`       INT     NOT NULL DEFAULT 0 COMMENT '重试次数',
+    `next_retry_time`   BIGINT  NOT NULL DEFAULT 0 COMMENT '下次重试时间',
+    `create_time`       BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `update_time`       BIGINT  NOT NULL DEFAULT 0 COMMENT '更新时间',
+    INDEX `MESSAGE_OUTBOX_STATUS_IDX` (`status`, `next_retry_time`),
+    INDEX `MESSAGE_OUTBOX_DELIVERED_IDX` (`status`, `update_time`),
+    INDEX `MESSAGE_OUTBOX_SESSION_IDX` (`session_id`, `create_time`),
+    UNIQUE INDEX `MESSAGE_OUTBOX_MSG_IDX` (`session_id`, `msg_id`)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `message_reaction_%s`
+(
+    `id`          BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`  BIGINT      NOT NULL,
+    `msg_id`      BIGINT      NOT NULL,
+    `user_id`     BIGINT      NOT NULL,
+    `emoji`       VARCHAR(64) NOT NULL COMMENT '表情',
+    `create_time` BIGINT      NOT NULL DEFAULT 0 COMMENT '创建时间',
+    INDEX `MESSAGE_REACTION_MSG_IDX` (`session_id`, `msg_id`),
+    UNIQUE INDEX `MESSAGE_REACTION_IDX` (`session_id`, `msg_id`, `user_id`, `emoji`)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `message_read_%s`
+(
+    `id`          BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`  BIGINT NOT NULL,
+    `msg_id`      BIGINT NOT NULL,
+    `user_id`     BIGINT NOT NULL COMMENT '已读用户id',
+    `create_time` BIGINT NOT NULL DEFAULT 0 COMMENT '已读时间',
+    UNIQUE INDEX `MESSAGE_READ_IDX` (`session_id`, `msg_id`, `user_id`)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `message_review_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`    BIGINT       NOT NULL,
+    `msg_id`        BIGINT       NOT NULL,
+    `from_user_id`  BIGINT       NOT NULL COMMENT '消息发送人id',
+    `categories`    VARCHAR(200) NOT NULL COMMENT '命中的敏感词分类, 逗号分隔',
+    `msg_content`   TEXT         NOT NULL COMMENT '消息内容',
+    `status`        TINYINT      NOT NULL DEFAULT 0 COMMENT '审核状态 0待审核 1通过 2违规',
+    `create_time`   BIGINT       NOT NULL DEFAULT 0 COMMENT '创建时间',
+    INDEX `MESSAGE_REVIEW_IDX` (`session_id`, `create_time`)
+);
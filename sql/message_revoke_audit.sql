@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `message_revoke_audit_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`    BIGINT NOT NULL,
+    `msg_id`        BIGINT NOT NULL,
+    `from_user_id`  BIGINT NOT NULL COMMENT '消息发送人id',
+    `operator_id`   BIGINT NOT NULL COMMENT '撤回操作人id',
+    `operator_role` INT    NOT NULL COMMENT '撤回操作人角色',
+    `msg_content`   TEXT   NOT NULL COMMENT '被撤回的消息内容',
+    `create_time`   BIGINT NOT NULL DEFAULT 0 COMMENT '撤回时间',
+    INDEX `MESSAGE_REVOKE_AUDIT_IDX` (`session_id`, `create_time`)
+);
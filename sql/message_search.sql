@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `message_search_%s`
+(
+    `id`           BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`   BIGINT NOT NULL,
+    `msg_id`       BIGINT NOT NULL,
+    `from_user_id` BIGINT NOT NULL COMMENT '消息发送人id',
+    `msg_type`     INT    NOT NULL COMMENT '消息类型',
+    `msg_content`  TEXT   NOT NULL COMMENT '消息内容',
+    `create_time`  BIGINT NOT NULL DEFAULT 0 COMMENT '消息时间',
+    INDEX `MESSAGE_SEARCH_CTIME_IDX` (`session_id`, `create_time`),
+    UNIQUE INDEX `MESSAGE_SEARCH_IDX` (`session_id`, `msg_id`),
+    FULLTEXT INDEX `MESSAGE_SEARCH_CONTENT_IDX` (`msg_content`) WITH PARSER ngram
+);
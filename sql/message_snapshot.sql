@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `message_snapshot_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL COMMENT '快照id',
+    `session_id`    BIGINT     NOT NULL COMMENT '合并转发的目标会话id',
+    `from_sid`      BIGINT     NOT NULL COMMENT '被转发消息的来源会话id',
+    `from_user_id`  BIGINT     NOT NULL COMMENT '转发人id',
+    `msg_count`     INT        NOT NULL DEFAULT 0 COMMENT '快照内消息数',
+    `content`       MEDIUMTEXT NOT NULL COMMENT '快照内消息列表json',
+    `create_time`   BIGINT     NOT NULL DEFAULT 0 COMMENT '创建时间',
+    INDEX `MESSAGE_SNAPSHOT_SESSION_IDX` (`session_id`, `id`)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `message_thread_%s`
+(
+    `id`                BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`        BIGINT NOT NULL,
+    `root_msg_id`       BIGINT NOT NULL COMMENT '根消息id',
+    `reply_count`       INT    NOT NULL DEFAULT 0 COMMENT '回复数',
+    `last_reply_msg_id` BIGINT NOT NULL DEFAULT 0 COMMENT '最后回复消息id',
+    `last_reply_time`   BIGINT NOT NULL DEFAULT 0 COMMENT '最后回复时间',
+    `create_time`       BIGINT NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `update_time`       BIGINT NOT NULL DEFAULT 0 COMMENT '更新时间',
+    UNIQUE INDEX `MESSAGE_THREAD_IDX` (`session_id`, `root_msg_id`)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `scheduled_message_%s`
+(
+    `id`           BIGINT PRIMARY KEY NOT NULL,
+    `type`         INT     NOT NULL COMMENT '1会话消息/2系统消息',
+    `from_user_id` BIGINT  NOT NULL COMMENT '发送者id, 0为系统',
+    `session_id`   BIGINT  NOT NULL DEFAULT 0 COMMENT '会话id, 系统消息为0',
+    `msg_type`     INT     NOT NULL COMMENT '消息类型',
+    `content`      TEXT    NOT NULL COMMENT '发送请求内容',
+    `send_at`      BIGINT  NOT NULL COMMENT '计划发送时间 毫秒',
+    `status`       TINYINT NOT NULL DEFAULT 0 COMMENT '0待发送/1发送中/2已发送/3已取消/4发送失败',
+    `msg_id`       BIGINT  NOT NULL DEFAULT 0 COMMENT '发送成功后的消息id',
+    `create_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `update_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '更新时间',
+    INDEX `SCHEDULED_MESSAGE_SEND_IDX` (`status`, `send_at`),
+    INDEX `SCHEDULED_MESSAGE_STATUS_IDX` (`status`, `update_time`),
+    INDEX `SCHEDULED_MESSAGE_USER_IDX` (`from_user_id`, `session_id`, `send_at`)
+);
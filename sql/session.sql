@@ -7,6 +7,15 @@ CREATE TABLE IF NOT EXISTS `session_%s`
     `mute`          INT                NOT NULL DEFAULT 0 COMMENT '禁言',
     `type`          INT                NOT NULL COMMENT '1单聊/2群聊/3超级群',
     `ext_data`      TEXT COMMENT '扩展字段',
+    `msg_seq`       BIGINT             NOT NULL DEFAULT 0 COMMENT '已预留的消息序号上限',
+    `last_msg_id`   BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息id, 仅超级群使用',
+    `last_msg_type` INT                NOT NULL DEFAULT 0 COMMENT '最后一条消息类型',
+    `last_msg_fuid` BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息发送人',
+    `last_msg_body` TEXT COMMENT '最后一条消息内容摘要',
+    `last_msg_time` BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息时间',
+    `retention_days` INT               NOT NULL DEFAULT 0 COMMENT '消息保留天数, 0使用会话类型配置, -1永久保留',
+    `retention_count` BIGINT           NOT NULL DEFAULT 0 COMMENT '消息保留条数, 0使用会话类型配置, -1不限制',
+    `purged_seq`    BIGINT             NOT NULL DEFAULT 0 COMMENT '已被清理的最大消息序号, 仅超级群使用',
     `update_time`   BIGINT             NOT NULL DEFAULT 0 COMMENT '更新时间',
     `create_time`   BIGINT             NOT NULL DEFAULT 0 COMMENT '创建时间',
     `deleted`       TINYINT            NOT NULL DEFAULT 0 COMMENT '会话删除状态'
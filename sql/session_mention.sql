@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `session_mention_%s`
+(
+    `id`           BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`   BIGINT NOT NULL,
+    `msg_id`       BIGINT NOT NULL,
+    `from_user_id` BIGINT NOT NULL COMMENT '消息发送人id',
+    `create_time`  BIGINT NOT NULL DEFAULT 0 COMMENT '消息时间',
+    INDEX `SESSION_MENTION_CTIME_IDX` (`session_id`, `create_time`),
+    UNIQUE INDEX `SESSION_MENTION_IDX` (`session_id`, `msg_id`)
+);
@@ -4,17 +4,25 @@ CREATE TABLE IF NOT EXISTS `session_message_%s`
     `msg_id`       BIGINT  NOT NULL,
     `client_id`    BIGINT  NOT NULL,
     `session_id`   BIGINT  NOT NULL,
+    `seq`          BIGINT  NOT NULL DEFAULT 0 COMMENT '会话内消息序号',
     `from_user_id` BIGINT  NOT NULL COMMENT '发送者id',
     `msg_type`     INT     NOT NULL COMMENT '消息类型',
     `msg_content`  TEXT    NOT NULL COMMENT '消息内容',
     `at_users`     TEXT COMMENT '@谁, uid数据',
     `reply_msg_id` BIGINT COMMENT '回复消息id',
     `ext_data`     TEXT    COMMENT '扩展字段',
+    `ttl_ms`       BIGINT  NOT NULL DEFAULT 0 COMMENT '消息存活时长(毫秒), 0为永久',
+    `burn_after_read` TINYINT NOT NULL DEFAULT 0 COMMENT '阅后即焚, 已读后开始倒计时',
+    `expire_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '过期时间, 0为不过期',
     `create_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间',
     `update_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '更新时间',
     `deleted`      TINYINT NOT NULL DEFAULT 0 COMMENT '消息删除状态',
     INDEX `SESSION_MESSAGE_S_IDX` (`session_id`),
     INDEX `USER_MESSAGE_CTIME_IDX` (`create_time`),
+    INDEX `SESSION_MESSAGE_SEQ_IDX` (`session_id`, `seq`),
+    INDEX `SESSION_MESSAGE_CTIME_IDX` (`session_id`, `create_time`),
+    INDEX `SESSION_MESSAGE_EXPIRE_IDX` (`deleted`, `expire_time`),
+    INDEX `SESSION_MESSAGE_REPLY_IDX` (`session_id`, `reply_msg_id`),
     UNIQUE INDEX `SESSION_MESSAGE_IDX` (`session_id`, `msg_id`),
     UNIQUE INDEX `SESSION_CLIENT_MESSAGE_IDX` (`session_id`, `from_user_id`, `client_id`)
 );
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `session_pin_%s`
+(
+    `id`          BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `session_id`  BIGINT NOT NULL,
+    `msg_id`      BIGINT NOT NULL COMMENT '置顶消息id',
+    `user_id`     BIGINT NOT NULL COMMENT '置顶操作人id',
+    `create_time` BIGINT NOT NULL DEFAULT 0 COMMENT '置顶时间',
+    INDEX `SESSION_PIN_CTIME_IDX` (`session_id`, `create_time`),
+    UNIQUE INDEX `SESSION_PIN_IDX` (`session_id`, `msg_id`)
+);
@@ -9,8 +9,10 @@ CREATE TABLE IF NOT EXISTS `session_user_%s`
     `status`      INT     NOT NULL DEFAULT 0 COMMENT '2^1(不接收消息) 2^2(静音)',
     `note_avatar` TEXT COMMENT '用户在session里面的备注头像',
     `note_name`   VARCHAR(64) COMMENT '用户在session里面的备注名',
+    `read_seq`    BIGINT  NOT NULL DEFAULT 0 COMMENT '已读消息序号, 仅超级群使用',
+    `read_msg_time` BIGINT NOT NULL DEFAULT 0 COMMENT '已读消息的服务端时间(取自消息id), 仅超级群使用',
     `update_time` BIGINT  NOT NULL DEFAULT 0 COMMENT '更新时间',
-    `create_time` BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `create_time` BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间, 即加入会话的时间, 退出后重新加入时重置',
     `deleted`     TINYINT NOT NULL DEFAULT 0 COMMENT '会话删除状态',
     UNIQUE INDEX `SESSION_USER_IDX` (`session_id`, `user_id`, `type`)
 );
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `user_device_cursor_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `user_id`       BIGINT       NOT NULL,
+    `platform`      VARCHAR(32)  NOT NULL COMMENT '平台 Android/IOS/Web',
+    `device`        VARCHAR(128) NOT NULL COMMENT '设备标识',
+    `session_id`    BIGINT       NOT NULL,
+    `cursor_msg_id` BIGINT       NOT NULL DEFAULT 0 COMMENT '该设备在会话内已连续ack的最大消息id',
+    `create_time`   BIGINT       NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `update_time`   BIGINT       NOT NULL DEFAULT 0 COMMENT '更新时间',
+    UNIQUE INDEX `USER_DEVICE_CURSOR_IDX` (`user_id`, `platform`, `device`, `session_id`)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `user_favorite_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL COMMENT '收藏id',
+    `user_id`       BIGINT NOT NULL,
+    `session_id`    BIGINT NOT NULL COMMENT '消息来源会话id',
+    `msg_id`        BIGINT NOT NULL,
+    `msg_type`      INT    NOT NULL,
+    `from_user_id`  BIGINT NOT NULL COMMENT '消息发送人id',
+    `msg_content`   TEXT   NOT NULL COMMENT '收藏时的消息内容',
+    `ext_data`      TEXT COMMENT '收藏时的消息扩展字段',
+    `msg_time`      BIGINT NOT NULL DEFAULT 0 COMMENT '消息发送时间',
+    `create_time`   BIGINT NOT NULL DEFAULT 0 COMMENT '收藏时间',
+    INDEX `USER_FAVORITE_Time_IDX` (`user_id`, `create_time`),
+    UNIQUE INDEX `USER_FAVORITE_IDX` (`user_id`, `session_id`, `msg_id`)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `user_favorite_object_%s`
+(
+    `id`            BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `user_id`       BIGINT NOT NULL,
+    `favorite_id`   BIGINT NOT NULL COMMENT '收藏id',
+    `object_id`     BIGINT NOT NULL COMMENT '收藏消息引用的对象id',
+    `create_time`   BIGINT NOT NULL DEFAULT 0 COMMENT '创建时间',
+    UNIQUE INDEX `USER_FAVORITE_OBJECT_IDX` (`user_id`, `object_id`, `favorite_id`)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `user_mention_%s`
+(
+    `id`           BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `user_id`      BIGINT  NOT NULL COMMENT '被@的用户id',
+    `session_id`   BIGINT  NOT NULL,
+    `msg_id`       BIGINT  NOT NULL,
+    `from_user_id` BIGINT  NOT NULL COMMENT '消息发送人id',
+    `at_all`       TINYINT NOT NULL DEFAULT 0 COMMENT '是否为@全体成员',
+    `create_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '消息时间',
+    INDEX `USER_MENTION_CTIME_IDX` (`user_id`, `create_time`),
+    INDEX `USER_MENTION_SESSION_IDX` (`session_id`, `msg_id`),
+    UNIQUE INDEX `USER_MENTION_IDX` (`user_id`, `session_id`, `msg_id`)
+);
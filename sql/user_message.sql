@@ -5,6 +5,7 @@ CREATE TABLE IF NOT EXISTS `user_message_%s`
     `client_id`    BIGINT  NOT NULL,
     `user_id`      BIGINT  NOT NULL,
     `session_id`   BIGINT  NOT NULL,
+    `seq`          BIGINT  NOT NULL DEFAULT 0 COMMENT '会话内消息序号',
     `from_user_id` BIGINT  NOT NULL COMMENT '发送者id',
     `msg_type`     INT     NOT NULL COMMENT '消息类型',
     `msg_content`  TEXT    NOT NULL COMMENT '消息内容',
@@ -12,9 +13,16 @@ CREATE TABLE IF NOT EXISTS `user_message_%s`
     `reply_msg_id` BIGINT COMMENT '回复消息id',
     `ext_data`     TEXT    COMMENT '扩展字段',
     `status`       TINYINT NOT NULL DEFAULT 0 COMMENT '用户消息状态:0:默认,2^0:已经发送给用户,2^1:客户端已读, 2^2:服务端已读, 2^3:重新编辑',
+    `ttl_ms`       BIGINT  NOT NULL DEFAULT 0 COMMENT '消息存活时长(毫秒), 0为永久',
+    `burn_after_read` TINYINT NOT NULL DEFAULT 0 COMMENT '阅后即焚, 已读后开始倒计时',
+    `expire_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '过期时间, 0为不过期',
     `create_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '创建时间',
     `update_time`  BIGINT  NOT NULL DEFAULT 0 COMMENT '更新时间',
     `deleted`      TINYINT NOT NULL DEFAULT 0 COMMENT '消息删除状态',
     INDEX `USER_MESSAGE_Time_IDX` (`user_id`, `create_time`),
+    INDEX `USER_MESSAGE_SEQ_IDX` (`user_id`, `session_id`, `seq`),
+    INDEX `USER_MESSAGE_EXPIRE_IDX` (`deleted`, `expire_time`),
+    INDEX `USER_MESSAGE_SESSION_IDX` (`session_id`, `msg_id`),
+    INDEX `USER_MESSAGE_REPLY_IDX` (`user_id`, `session_id`, `reply_msg_id`),
     UNIQUE INDEX `USER_MESSAGE_IDX` (`user_id`, `session_id`, `msg_id`)
 );
\ No newline at end of file
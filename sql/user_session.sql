@@ -16,8 +16,21 @@ CREATE TABLE IF NOT EXISTS `user_session_%s`
     `note_avatar`   TEXT COMMENT '用户在session里面的备注头像',
     `note_name`     VARCHAR(64) COMMENT '用户在session里面的备注名',
     `ext_data`      TEXT COMMENT '扩展字段',
+    `unread_count`  INT                NOT NULL DEFAULT 0 COMMENT '未读消息数, 超级群不使用',
+    `mention_count` INT                NOT NULL DEFAULT 0 COMMENT '未读@我的消息数, 超级群不使用',
+    `last_msg_id`   BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息id, 超级群不使用',
+    `last_msg_type` INT                NOT NULL DEFAULT 0 COMMENT '最后一条消息类型',
+    `last_msg_fuid` BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息发送人',
+    `last_msg_body` TEXT COMMENT '最后一条消息内容摘要',
+    `last_msg_time` BIGINT             NOT NULL DEFAULT 0 COMMENT '最后一条消息时间',
+    `draft`         TEXT COMMENT '草稿内容',
+    `draft_rmsg_id` BIGINT             NOT NULL DEFAULT 0 COMMENT '草稿回复的消息id',
+    `draft_time`    BIGINT             NOT NULL DEFAULT 0 COMMENT '草稿更新时间',
+    `read_seq`      BIGINT             NOT NULL DEFAULT 0 COMMENT '已读消息序号, 仅超级群使用',
+    `read_msg_time` BIGINT             NOT NULL DEFAULT 0 COMMENT '已读消息的服务端时间(取自消息id), 仅超级群使用',
+    `purged_seq`    BIGINT             NOT NULL DEFAULT 0 COMMENT '已被清理的最大消息序号, 超级群不使用',
     `update_time`   BIGINT             NOT NULL DEFAULT 0 COMMENT '更新时间',
-    `create_time`   BIGINT             NOT NULL DEFAULT 0 COMMENT '创建时间',
+    `create_time`   BIGINT             NOT NULL DEFAULT 0 COMMENT '创建时间, 即加入会话的时间, 退出后重新加入时重置',
     `deleted`       TINYINT            NOT NULL DEFAULT 0 COMMENT '会话删除状态',
     INDEX `USER_SESSION_Time_IDX` (`user_id`, `update_time`),
     UNIQUE INDEX `USER_SESSION_IDX` (`session_id`, `user_id`, `entity_id`, `type`)
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `user_thread_%s`
+(
+    `id`          BIGINT PRIMARY KEY NOT NULL auto_increment,
+    `user_id`     BIGINT NOT NULL,
+    `session_id`  BIGINT NOT NULL,
+    `root_msg_id` BIGINT NOT NULL COMMENT '根消息id',
+    `create_time` BIGINT NOT NULL DEFAULT 0 COMMENT '参与时间',
+    `update_time` BIGINT NOT NULL DEFAULT 0 COMMENT '最后参与时间',
+    INDEX `USER_THREAD_UTIME_IDX` (`user_id`, `update_time`),
+    INDEX `USER_THREAD_SESSION_IDX` (`session_id`, `root_msg_id`),
+    UNIQUE INDEX `USER_THREAD_IDX` (`user_id`, `session_id`, `root_msg_id`)
+);